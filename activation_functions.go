@@ -82,3 +82,41 @@ func ActivationGaussian(v float64) float64 {
 func ActivationGaussianDerivative(v float64) float64 {
 	return -2.0 * v * math.Exp(-1.0*v*v)
 }
+
+// ActivationIdentity is identity function (no activation)
+/*
+	See the reference: http://www.wolframalpha.com/input/?i=x
+*/
+func ActivationIdentity(v float64) float64 {
+	return v
+}
+
+// ActivationIdentityDerivative is derivative of identity function
+/*
+	See the reference: http://www.wolframalpha.com/input/?i=(x)%27
+*/
+func ActivationIdentityDerivative(v float64) float64 {
+	return 1.0
+}
+
+// ActivationReLU is rectified linear unit function (max(0, x))
+/*
+	See the reference: http://www.wolframalpha.com/input/?i=max(0,x)
+*/
+func ActivationReLU(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// ActivationReLUDerivative is derivative of rectified linear unit function
+/*
+	See the reference: http://www.wolframalpha.com/input/?i=(max(0,x))%27
+*/
+func ActivationReLUDerivative(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	return 1.0
+}
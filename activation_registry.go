@@ -0,0 +1,105 @@
+package cnns
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Activation Named activation function paired with its derivative
+type Activation struct {
+	Name       string
+	Func       func(v float64) float64
+	Derivative func(v float64) float64
+}
+
+var (
+	activationsMu sync.RWMutex
+	activations   = map[string]*Activation{
+		"tanh":     {Name: "tanh", Func: ActivationTanh, Derivative: ActivationTanhDerivative},
+		"sigmoid":  {Name: "sigmoid", Func: ActivationSygmoid, Derivative: ActivationSygmoidDerivative},
+		"arctan":   {Name: "arctan", Func: ActivationArcTan, Derivative: ActivationArcTanDerivative},
+		"softplus": {Name: "softplus", Func: ActivationSoftPlus, Derivative: ActivationSoftPlusDerivative},
+		"gaussian": {Name: "gaussian", Func: ActivationGaussian, Derivative: ActivationGaussianDerivative},
+		"identity": {Name: "identity", Func: ActivationIdentity, Derivative: ActivationIdentityDerivative},
+		"relu":     {Name: "relu", Func: ActivationReLU, Derivative: ActivationReLUDerivative},
+	}
+)
+
+// RegisterActivation Register user's activation function, so it can be set by name and saved to JSON file
+/*
+	name - unique name of activation function (case insensitive)
+	f - activation function
+	derivative - derivative of activation function
+*/
+func RegisterActivation(name string, f, derivative func(v float64) float64) error {
+	if f == nil || derivative == nil {
+		return fmt.Errorf("Both activation function and its derivative should be provided for '%s'", name)
+	}
+	key := strings.ToLower(name)
+	activationsMu.Lock()
+	defer activationsMu.Unlock()
+	if _, ok := activations[key]; ok {
+		return fmt.Errorf("Activation function '%s' is registered already", name)
+	}
+	activations[key] = &Activation{Name: key, Func: f, Derivative: derivative}
+	return nil
+}
+
+// unregisterActivation Remove activation function from registry (e.g. to clean up after tests)
+func unregisterActivation(name string) {
+	activationsMu.Lock()
+	defer activationsMu.Unlock()
+	delete(activations, strings.ToLower(name))
+}
+
+// GetActivation Returns registered activation function by its name
+func GetActivation(name string) (*Activation, error) {
+	activationsMu.RLock()
+	defer activationsMu.RUnlock()
+	activation, ok := activations[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Activation function '%s' is not registered", name)
+	}
+	return activation, nil
+}
+
+// ListActivations Returns sorted names of registered activation functions
+func ListActivations() []string {
+	activationsMu.RLock()
+	defer activationsMu.RUnlock()
+	names := make([]string, 0, len(activations))
+	for name := range activations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findActivationName Returns name of registered activation function for provided pair of functions or empty string if there is no such pair
+/*
+	Functions are compared by code pointers, so closures created by the same function literal are indistinguishable
+*/
+func findActivationName(f, derivative func(v float64) float64) string {
+	if f == nil || derivative == nil {
+		return ""
+	}
+	fPtr := reflect.ValueOf(f).Pointer()
+	derivativePtr := reflect.ValueOf(derivative).Pointer()
+	activationsMu.RLock()
+	defer activationsMu.RUnlock()
+	for name, activation := range activations {
+		if reflect.ValueOf(activation.Func).Pointer() == fPtr && reflect.ValueOf(activation.Derivative).Pointer() == derivativePtr {
+			return name
+		}
+	}
+	return ""
+}
+
+// activationLayer Layer with activation function which could be set by name (e.g. fully-connected layer)
+type activationLayer interface {
+	// SetActivation Set registered activation function and its derivative by name (see RegisterActivation())
+	SetActivation(name string) error
+}
@@ -0,0 +1,95 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+)
+
+func TestActivationRegistry(t *testing.T) {
+	for _, name := range []string{"tanh", "sigmoid", "arctan", "softplus", "gaussian", "identity", "relu"} {
+		activation, err := GetActivation(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		// Check derivative numerically
+		for _, v := range []float64{-1.3, -0.2, 0.4, 2.1} {
+			numerical := (activation.Func(v+1e-6) - activation.Func(v-1e-6)) / 2e-6
+			if math.Abs(numerical-activation.Derivative(v)) > 1e-6 {
+				t.Errorf("Derivative of '%s' at %f should be %f, but got %f", name, v, numerical, activation.Derivative(v))
+			}
+		}
+	}
+	_, err := GetActivation("unknown")
+	if err == nil {
+		t.Errorf("Unknown activation function should cause error")
+	}
+
+	square := func(v float64) float64 { return v * v }
+	squareDerivative := func(v float64) float64 { return 2 * v }
+	err = RegisterActivation("Square", square, squareDerivative)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer unregisterActivation("square")
+	err = RegisterActivation("square", square, squareDerivative)
+	if err == nil {
+		t.Errorf("Activation function can't be registered twice")
+	}
+
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 1).(*FullyConnectedLayer)
+	if fc.GetActivationName() != "tanh" {
+		t.Errorf("Default activation function should be 'tanh', but got '%s'", fc.GetActivationName())
+	}
+	fc.SetActivationFunc(ActivationSygmoid)
+	fc.SetActivationDerivativeFunc(ActivationSygmoidDerivative)
+	if fc.GetActivationName() != "sigmoid" {
+		t.Errorf("Activation function should be 'sigmoid', but got '%s'", fc.GetActivationName())
+	}
+	err = fc.SetActivation("square")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fc.GetActivationName() != "square" {
+		t.Errorf("Activation function should be 'square', but got '%s'", fc.GetActivationName())
+	}
+	if fc.ActivationFunc(3) != 9 {
+		t.Errorf("Activation function should be square, but got %f for 3", fc.ActivationFunc(3))
+	}
+}
+
+func TestSetActivationWithoutActivationFunc(t *testing.T) {
+	size := &tensor.TDsize{X: 4, Y: 4, Z: 2}
+	layers := []Layer{
+		NewConvLayer(size, 1, 3, 1),
+		NewPoolingLayer(size, 2, 2, "max", "valid"),
+		NewGlobalPoolingLayer(size, "avg"),
+		NewBatchNormLayer(size, "channel"),
+		NewDropoutLayer(size, 0.5),
+		NewReLULayer(size),
+		NewLeakyReLULayer(size, 0.1),
+		NewPReLULayer(size),
+		NewELULayer(size, 1.0),
+		NewSELULayer(size),
+		NewGELULayer(size),
+		NewSoftmaxLayer(size),
+	}
+	for _, layer := range layers {
+		if _, ok := layer.(activationLayer); ok {
+			t.Errorf("Layer '%s' should not support setting activation function by name", layer.GetType())
+		}
+		// Sequential rejects such layers
+		seq := NewSequential(size).Add(layer).Activation("tanh")
+		if errors.Cause(seq.err) != ErrInvalidLayerConfiguration {
+			t.Errorf("Setting activation function for '%s' layer should cause ErrInvalidLayerConfiguration, but got %v", layer.GetType(), seq.err)
+		}
+	}
+	if _, ok := NewFullyConnectedLayer(size, 2).(activationLayer); !ok {
+		t.Errorf("Fully-connected layer should support setting activation function by name")
+	}
+}
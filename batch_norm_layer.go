@@ -0,0 +1,507 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+type batchNormType int
+
+const (
+	batchNormCHANNEL = iota + 1
+	batchNormFEATURE
+)
+
+func (bnt batchNormType) String() string {
+	switch bnt {
+	case batchNormCHANNEL:
+		return "channel"
+	case batchNormFEATURE:
+		return "feature"
+	default:
+		return fmt.Sprintf("Batch normalization type #%d is not defined", bnt)
+	}
+}
+
+// BatchNormLayer Batch normalization layer
+/*
+	Oj - Input data
+	Ok - Output data: γ * x̂ + β
+	Normalized - x̂ = (x - μ) / sqrt(σ² + ε), normalized input data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+	Gamma - γ, trainable scale (one per channel or per feature)
+	Beta - β, trainable shift (one per channel or per feature)
+	GammaState, BetaState - optimizer's states for γ and β
+	GammaGradients, BetaGradients - ΔE/Δγ and ΔE/Δβ, gradients accumulated over mini-batch
+	RunningMean, RunningVariance - moving averages of mean and variance (used in inference mode)
+	BatchMean, BatchVariance - statistics of current mini-batch (used in training mode)
+	Momentum - factor for moving averages: running = Momentum * running + (1 - Momentum) * batch
+	Epsilon - small constant for numerical stability
+	NormType - "channel" (statistics per channel; channels are stacked the same way as ExtractChannel() expects) or "feature" (statistics per single value)
+
+	In training mode statistics of mini-batch are used and gradients are evaluated with respect to them also:
+		ΔE/Δx = γ / sqrt(σ² + ε) * (ΔE/ΔO - mean(ΔE/ΔO) - x̂ * mean(ΔE/ΔO * x̂)), where means are taken over mini-batch
+	WholeNet.CalculateBatchGradients() (Train() and Fit() call it for every mini-batch) does it for whole mini-batch: statistics of mini-batch and sums of incoming gradients
+	are evaluated before FeedForward() and CalculateGradients() are called for every sample.
+	FeedForward() in training mode returns ErrNoBatchStatistics if statistics of mini-batch have not been evaluated (see WholeNet.PrepareBatchStatistics()),
+	CalculateGradients() in training mode does the same if sums of incoming gradients have not been evaluated (only WholeNet.CalculateBatchGradients() does it).
+	Every channel (or feature) should have at least 2 values in mini-batch, otherwise variance is zero and output collapses to β: see minBatchSize()
+*/
+type BatchNormLayer struct {
+	Oj              *mat.Dense
+	Ok              *mat.Dense
+	Normalized      *mat.Dense
+	LocalDelta      *mat.Dense
+	Gamma           *mat.Dense
+	Beta            *mat.Dense
+	GammaState      *OptimizerState
+	BetaState       *OptimizerState
+	GammaGradients  *mat.Dense
+	BetaGradients   *mat.Dense
+	RunningMean     *mat.Dense
+	RunningVariance *mat.Dense
+	BatchMean       *mat.Dense
+	BatchVariance   *mat.Dense
+	Momentum        float64
+	Epsilon         float64
+	NormType        batchNormType
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	batchSum            []float64
+	batchSquaresSum     []float64
+	batchCount          int
+	batchReady          bool
+	errorsSum           []float64
+	errorsNormalizedSum []float64
+	gradientsReady      bool
+	accumulatedSamples  int
+	trainMode           bool
+}
+
+// NewBatchNormLayer - Constructor for new batch normalization layer. You need to specify input size and type of normalization
+/*
+	inSize - input layer's size
+	normType - "channel" (e.g. after convolutional layer) or "feature" (e.g. after fully-connected layer)
+*/
+func NewBatchNormLayer(inSize *tensor.TDsize, normType string) Layer {
+	newLayer := &BatchNormLayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Normalized: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Momentum:   0.9,
+		Epsilon:    1e-5,
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	switch strings.ToLower(normType) {
+	case "channel":
+		newLayer.NormType = batchNormCHANNEL
+		break
+	case "feature":
+		newLayer.NormType = batchNormFEATURE
+		break
+	default:
+		fmt.Printf("Warning: type '%s' for batch normalization layer is not supported. Use 'channel' or 'feature'\n", normType)
+		newLayer.NormType = batchNormCHANNEL
+		break
+	}
+	groups := newLayer.groupsNum()
+	newLayer.Gamma = mat.NewDense(groups, 1, nil)
+	newLayer.Beta = mat.NewDense(groups, 1, nil)
+	newLayer.GammaState = NewOptimizerState(groups, 1)
+	newLayer.BetaState = NewOptimizerState(groups, 1)
+	newLayer.GammaGradients = mat.NewDense(groups, 1, nil)
+	newLayer.BetaGradients = mat.NewDense(groups, 1, nil)
+	newLayer.RunningMean = mat.NewDense(groups, 1, nil)
+	newLayer.RunningVariance = mat.NewDense(groups, 1, nil)
+	newLayer.BatchMean = mat.NewDense(groups, 1, nil)
+	newLayer.BatchVariance = mat.NewDense(groups, 1, nil)
+	newLayer.batchSum = make([]float64, groups)
+	newLayer.batchSquaresSum = make([]float64, groups)
+	newLayer.errorsSum = make([]float64, groups)
+	newLayer.errorsNormalizedSum = make([]float64, groups)
+	for g := 0; g < groups; g++ {
+		newLayer.Gamma.Set(g, 0, 1.0)
+		newLayer.RunningVariance.Set(g, 0, 1.0)
+	}
+	return newLayer
+}
+
+// groupsNum Returns number of normalized groups (channels or features)
+func (bn *BatchNormLayer) groupsNum() int {
+	if bn.NormType == batchNormFEATURE {
+		return bn.inputSize.Total()
+	}
+	return bn.inputSize.Z
+}
+
+// group Returns index of group (channel or feature) for i-th element of raw data
+func (bn *BatchNormLayer) group(i int) int {
+	if bn.NormType == batchNormFEATURE {
+		return i
+	}
+	// Every channel is X*Y contiguous values
+	return i / (bn.inputSize.X * bn.inputSize.Y)
+}
+
+// SetCustomWeights Set user's weights for batch normalization layer (make it carefully)
+/*
+	weights - slice of length 2 (γ and β) or 4 (γ, β, running mean and running variance)
+*/
+func (bn *BatchNormLayer) SetCustomWeights(weights []*mat.Dense) {
+	if len(weights) != 2 && len(weights) != 4 {
+		fmt.Println("You can provide array of length 2 (gamma and beta) or 4 (gamma, beta, running mean and running variance) only (for batch normalization layer)")
+		return
+	}
+	groups := bn.groupsNum()
+	for i := range weights {
+		r, c := weights[i].Dims()
+		if r*c != groups {
+			fmt.Printf("Every array should contain %d values (for batch normalization layer)\n", groups)
+			return
+		}
+	}
+	bn.Gamma = mat.NewDense(groups, 1, nil)
+	bn.Gamma.Copy(weights[0])
+	bn.Beta = mat.NewDense(groups, 1, nil)
+	bn.Beta.Copy(weights[1])
+	bn.GammaState = NewOptimizerState(groups, 1)
+	bn.BetaState = NewOptimizerState(groups, 1)
+	bn.GammaGradients.Zero()
+	bn.BetaGradients.Zero()
+	bn.accumulatedSamples = 0
+	if len(weights) == 4 {
+		bn.RunningMean = mat.NewDense(groups, 1, nil)
+		bn.RunningMean.Copy(weights[2])
+		bn.RunningVariance = mat.NewDense(groups, 1, nil)
+		bn.RunningVariance.Copy(weights[3])
+	}
+}
+
+// GetInputSize Returns dimensions of incoming data for batch normalization layer
+func (bn *BatchNormLayer) GetInputSize() *tensor.TDsize {
+	return bn.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of batch normalization layer
+func (bn *BatchNormLayer) GetOutputSize() *tensor.TDsize {
+	return bn.OutputSize
+}
+
+// GetActivatedOutput Returns batch normalization layer's output
+func (bn *BatchNormLayer) GetActivatedOutput() *mat.Dense {
+	return bn.Ok
+}
+
+// GetWeights Returns batch normalization layer's γ, β, running mean and running variance
+func (bn *BatchNormLayer) GetWeights() []*mat.Dense {
+	return []*mat.Dense{bn.Gamma, bn.Beta, bn.RunningMean, bn.RunningVariance}
+}
+
+// GetGradients Returns batch normalization layer's gradients
+func (bn *BatchNormLayer) GetGradients() *mat.Dense {
+	return bn.LocalDelta
+}
+
+// resetBatchStatistics Drop statistics (and sums of gradients) of previous mini-batch
+func (bn *BatchNormLayer) resetBatchStatistics() {
+	for g := range bn.batchSum {
+		bn.batchSum[g] = 0
+		bn.batchSquaresSum[g] = 0
+	}
+	bn.batchCount = 0
+	bn.batchReady = false
+	bn.resetBatchGradients()
+}
+
+// accumulateBatchStatistics Accumulate statistics for single sample of mini-batch
+func (bn *BatchNormLayer) accumulateBatchStatistics(input *mat.Dense) error {
+	if input.RawMatrix().Rows*input.RawMatrix().Cols != bn.inputSize.Total() {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't accumulate statistics on batch normalization layer")
+	}
+	rawInput := input.RawMatrix().Data
+	for i := range rawInput {
+		g := bn.group(i)
+		bn.batchSum[g] += rawInput[i]
+		bn.batchSquaresSum[g] += rawInput[i] * rawInput[i]
+	}
+	bn.batchCount++
+	return nil
+}
+
+// mergeBatchStatistics Adds statistics accumulated by replica to layer's ones and resets replica's ones
+func (bn *BatchNormLayer) mergeBatchStatistics(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	for g := range bn.batchSum {
+		bn.batchSum[g] += replicaBN.batchSum[g]
+		bn.batchSquaresSum[g] += replicaBN.batchSquaresSum[g]
+	}
+	bn.batchCount += replicaBN.batchCount
+	replicaBN.resetBatchStatistics()
+}
+
+// finalizeBatchStatistics Evaluate statistics of mini-batch after all samples have been accumulated. Running mean and variance are updated also
+func (bn *BatchNormLayer) finalizeBatchStatistics() error {
+	// Number of values in every group
+	m := float64(bn.batchCount * bn.inputSize.Total() / bn.groupsNum())
+	if m < 2 {
+		return errors.Wrapf(ErrInvalidLayerConfiguration, "Batch normalization layer (%s) needs at least %d samples in mini-batch, but got %d", bn.NormType, bn.minBatchSize(), bn.batchCount)
+	}
+	for g := range bn.batchSum {
+		mean := bn.batchSum[g] / m
+		variance := math.Max(bn.batchSquaresSum[g]/m-mean*mean, 0)
+		bn.BatchMean.Set(g, 0, mean)
+		bn.BatchVariance.Set(g, 0, variance)
+		// Unbiased estimation of variance is used for moving average
+		unbiased := variance
+		if m > 1 {
+			unbiased = variance * m / (m - 1)
+		}
+		bn.RunningMean.Set(g, 0, bn.Momentum*bn.RunningMean.At(g, 0)+(1-bn.Momentum)*mean)
+		bn.RunningVariance.Set(g, 0, bn.Momentum*bn.RunningVariance.At(g, 0)+(1-bn.Momentum)*unbiased)
+	}
+	bn.batchReady = true
+	return nil
+}
+
+// shareBatchStatistics Copies statistics of mini-batch to replica
+func (bn *BatchNormLayer) shareBatchStatistics(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	replicaBN.BatchMean.Copy(bn.BatchMean)
+	replicaBN.BatchVariance.Copy(bn.BatchVariance)
+	replicaBN.batchCount = bn.batchCount
+	replicaBN.batchReady = true
+}
+
+// resetBatchGradients Drop sums of incoming gradients of previous mini-batch
+func (bn *BatchNormLayer) resetBatchGradients() {
+	for g := range bn.errorsSum {
+		bn.errorsSum[g] = 0
+		bn.errorsNormalizedSum[g] = 0
+	}
+	bn.gradientsReady = false
+}
+
+// accumulateBatchGradients Accumulate sums of incoming gradients (ΔE/ΔO and ΔE/ΔO * x̂) for single sample. Sample should be fed to layer right before
+func (bn *BatchNormLayer) accumulateBatchGradients(errorsDense *mat.Dense) error {
+	rawErrors := errorsDense.RawMatrix().Data
+	rawNormalized := bn.Normalized.RawMatrix().Data
+	if len(rawErrors) != len(rawNormalized) {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't accumulate gradients on batch normalization layer")
+	}
+	for j := range rawErrors {
+		g := bn.group(j)
+		bn.errorsSum[g] += rawErrors[j]
+		bn.errorsNormalizedSum[g] += rawErrors[j] * rawNormalized[j]
+	}
+	return nil
+}
+
+// mergeBatchGradients Adds sums of incoming gradients accumulated by replica to layer's ones and resets replica's ones
+func (bn *BatchNormLayer) mergeBatchGradients(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	for g := range bn.errorsSum {
+		bn.errorsSum[g] += replicaBN.errorsSum[g]
+		bn.errorsNormalizedSum[g] += replicaBN.errorsNormalizedSum[g]
+	}
+	replicaBN.resetBatchGradients()
+}
+
+// finalizeBatchGradients Marks sums of incoming gradients as ready for CalculateGradients()
+func (bn *BatchNormLayer) finalizeBatchGradients() {
+	bn.gradientsReady = true
+}
+
+// shareBatchGradients Copies sums of incoming gradients to replica
+func (bn *BatchNormLayer) shareBatchGradients(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	copy(replicaBN.errorsSum, bn.errorsSum)
+	copy(replicaBN.errorsNormalizedSum, bn.errorsNormalizedSum)
+	replicaBN.gradientsReady = true
+}
+
+// minBatchSize Returns minimal number of samples in mini-batch for training: every channel (or feature) needs at least 2 values
+func (bn *BatchNormLayer) minBatchSize() int {
+	valuesPerGroup := bn.inputSize.Total() / bn.groupsNum()
+	if valuesPerGroup >= 2 {
+		return 1
+	}
+	return 2
+}
+
+// FeedForward - Feed data to batch normalization layer
+func (bn *BatchNormLayer) FeedForward(t *mat.Dense) error {
+	if t.RawMatrix().Rows*t.RawMatrix().Cols != bn.inputSize.Total() {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call FeedForward() on batch normalization layer")
+	}
+	bn.Oj = t
+	if bn.trainMode && !bn.batchReady {
+		return errors.Wrap(ErrNoBatchStatistics, "Can't call FeedForward() on batch normalization layer in training mode (see WholeNet.PrepareBatchStatistics())")
+	}
+	bn.doActivation()
+	return nil
+}
+
+// statistics Returns mean and variance which should be used in current mode
+func (bn *BatchNormLayer) statistics() (*mat.Dense, *mat.Dense) {
+	if bn.trainMode {
+		return bn.BatchMean, bn.BatchVariance
+	}
+	return bn.RunningMean, bn.RunningVariance
+}
+
+// doActivation Batch normalization layer's output activation
+func (bn *BatchNormLayer) doActivation() {
+	mean, variance := bn.statistics()
+	rawOj := bn.Oj.RawMatrix().Data
+	rawOk := bn.Ok.RawMatrix().Data
+	rawNormalized := bn.Normalized.RawMatrix().Data
+	for j := range rawOj {
+		g := bn.group(j)
+		rawNormalized[j] = (rawOj[j] - mean.At(g, 0)) / math.Sqrt(variance.At(g, 0)+bn.Epsilon)
+		rawOk[j] = bn.Gamma.At(g, 0)*rawNormalized[j] + bn.Beta.At(g, 0)
+	}
+}
+
+// CalculateGradients Evaluate batch normalization layer's gradients. In training mode sums of incoming gradients over mini-batch are needed (see WholeNet.CalculateBatchGradients())
+func (bn *BatchNormLayer) CalculateGradients(errorsDense *mat.Dense) error {
+	rawErrors := errorsDense.RawMatrix().Data
+	if len(rawErrors) != len(bn.LocalDelta.RawMatrix().Data) {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call CalculateGradients() on batch normalization layer")
+	}
+	if bn.trainMode && !bn.gradientsReady {
+		return errors.Wrap(ErrNoBatchStatistics, "Can't call CalculateGradients() on batch normalization layer in training mode (see WholeNet.CalculateBatchGradients())")
+	}
+	_, variance := bn.statistics()
+	rawDelta := bn.LocalDelta.RawMatrix().Data
+	rawNormalized := bn.Normalized.RawMatrix().Data
+	// Number of values in every group of mini-batch
+	m := float64(bn.batchCount * bn.inputSize.Total() / bn.groupsNum())
+	for i := range rawDelta {
+		g := bn.group(i)
+		// ΔE/Δγ = ΔE/ΔO * x̂, ΔE/Δβ = ΔE/ΔO
+		bn.GammaGradients.Set(g, 0, bn.GammaGradients.At(g, 0)+rawErrors[i]*rawNormalized[i])
+		bn.BetaGradients.Set(g, 0, bn.BetaGradients.At(g, 0)+rawErrors[i])
+		scale := bn.Gamma.At(g, 0) / math.Sqrt(variance.At(g, 0)+bn.Epsilon)
+		if bn.trainMode {
+			// ΔE/Δx = γ / sqrt(σ² + ε) * (ΔE/ΔO - mean(ΔE/ΔO) - x̂ * mean(ΔE/ΔO * x̂))
+			rawDelta[i] = scale * (rawErrors[i] - bn.errorsSum[g]/m - rawNormalized[i]*bn.errorsNormalizedSum[g]/m)
+		} else {
+			// Running statistics are constants: ΔE/Δx = ΔE/ΔO * γ / sqrt(σ² + ε)
+			rawDelta[i] = scale * rawErrors[i]
+		}
+	}
+	bn.accumulatedSamples++
+	return nil
+}
+
+// UpdateWeights Update batch normalization layer's γ and β (gradients are averaged over accumulated samples)
+func (bn *BatchNormLayer) UpdateWeights(lp *LearningParams) {
+	// Statistics of mini-batch are not valid after update of weights of previous layers
+	bn.batchReady = false
+	bn.gradientsReady = false
+	if bn.accumulatedSamples == 0 {
+		return
+	}
+	bn.GammaGradients.Scale(1.0/float64(bn.accumulatedSamples), bn.GammaGradients)
+	bn.BetaGradients.Scale(1.0/float64(bn.accumulatedSamples), bn.BetaGradients)
+	// γ and β are not regularized (the same way as biases)
+	lp.updateParameters(bn.Gamma, bn.GammaGradients, bn.GammaState, true)
+	lp.updateParameters(bn.Beta, bn.BetaGradients, bn.BetaState, true)
+	bn.GammaGradients.Zero()
+	bn.BetaGradients.Zero()
+	bn.accumulatedSamples = 0
+}
+
+// PrintOutput Pretty print batch normalization layer's output
+func (bn *BatchNormLayer) PrintOutput() {
+	fmt.Println("Printing batch normalization Layer output...")
+	rows, _ := bn.Ok.Dims()
+	for r := 0; r < rows; r++ {
+		fmt.Printf("\t%v\n", bn.Ok.RawRowView(r))
+	}
+}
+
+// PrintWeights Pretty print batch normalization layer's γ, β and running statistics
+func (bn *BatchNormLayer) PrintWeights() {
+	fmt.Println("Printing batch normalization Layer weights...")
+	fmt.Printf("\tgamma: %v\n", bn.Gamma.RawMatrix().Data)
+	fmt.Printf("\tbeta: %v\n", bn.Beta.RawMatrix().Data)
+	fmt.Printf("\trunning mean: %v\n", bn.RunningMean.RawMatrix().Data)
+	fmt.Printf("\trunning variance: %v\n", bn.RunningVariance.RawMatrix().Data)
+}
+
+// SetActivationFunc Set activation function for layer
+func (bn *BatchNormLayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for batch normalization layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (bn *BatchNormLayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for batch normalization layer")
+}
+
+// GetStride Returns stride of layer
+func (bn *BatchNormLayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "batchnorm" as layer's type
+func (bn *BatchNormLayer) GetType() string {
+	return "batchnorm"
+}
+
+// SetTrainMode Switch batch normalization layer to training (true) or inference (false) mode
+func (bn *BatchNormLayer) SetTrainMode(mode bool) {
+	bn.trainMode = mode
+}
+
+// replicate Returns new batch normalization layer with the same configuration and own buffers (see Predict() and CalculateBatchGradients())
+func (bn *BatchNormLayer) replicate() Layer {
+	replica := NewBatchNormLayer(bn.inputSize, bn.NormType.String()).(*BatchNormLayer)
+	replica.Momentum = bn.Momentum
+	replica.Epsilon = bn.Epsilon
+	return replica
+}
+
+// mergeGradients Adds gradients accumulated by replica to layer's gradients and resets replica's ones
+func (bn *BatchNormLayer) mergeGradients(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	bn.GammaGradients.Add(bn.GammaGradients, replicaBN.GammaGradients)
+	bn.BetaGradients.Add(bn.BetaGradients, replicaBN.BetaGradients)
+	replicaBN.GammaGradients.Zero()
+	replicaBN.BetaGradients.Zero()
+	bn.accumulatedSamples += replicaBN.accumulatedSamples
+	replicaBN.accumulatedSamples = 0
+}
+
+// shareParameters Makes replica use the same γ, β and running statistics as layer (see Predict() and CalculateBatchGradients())
+func (bn *BatchNormLayer) shareParameters(replica Layer) {
+	replicaBN := replica.(*BatchNormLayer)
+	replicaBN.Gamma = bn.Gamma
+	replicaBN.Beta = bn.Beta
+	replicaBN.RunningMean = bn.RunningMean
+	replicaBN.RunningVariance = bn.RunningVariance
+	replicaBN.Epsilon = bn.Epsilon
+}
+
+// trainableParameters Returns γ, β and running statistics of batch normalization layer
+func (bn *BatchNormLayer) trainableParameters() []*mat.Dense {
+	return []*mat.Dense{bn.Gamma, bn.Beta, bn.RunningMean, bn.RunningVariance}
+}
+
+// optimizerStates Returns optimizer's states for γ and β of batch normalization layer
+func (bn *BatchNormLayer) optimizerStates() []*OptimizerState {
+	return []*OptimizerState{bn.GammaState, bn.BetaState}
+}
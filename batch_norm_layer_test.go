@@ -0,0 +1,227 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestBatchNormFeature(t *testing.T) {
+	bn := NewBatchNormLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, "feature")
+	net := WholeNet{Layers: []Layer{bn}, LP: NewLearningParametersDefault()}
+	batch := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{1, 10}),
+		mat.NewDense(2, 1, []float64{3, 20}),
+	}
+	net.SetTrainMode(true)
+	// Statistics of mini-batch should be evaluated before forward pass in training mode
+	err := bn.FeedForward(batch[0])
+	if errors.Cause(err) != ErrNoBatchStatistics {
+		t.Errorf("Forward pass without statistics of mini-batch should cause ErrNoBatchStatistics, but got %v", err)
+	}
+	// Single sample can't be normalized per feature
+	err = net.PrepareBatchStatistics(batch[:1])
+	if errors.Cause(err) != ErrInvalidLayerConfiguration {
+		t.Errorf("Feature normalization of single sample should cause ErrInvalidLayerConfiguration, but got %v", err)
+	}
+	err = net.checkBatchSize(1, 4)
+	if errors.Cause(err) != ErrInvalidLayerConfiguration {
+		t.Errorf("Mini-batch of single sample should cause ErrInvalidLayerConfiguration, but got %v", err)
+	}
+	err = net.checkBatchSize(2, 5)
+	if errors.Cause(err) != ErrInvalidLayerConfiguration {
+		t.Errorf("Last mini-batch of single sample should cause ErrInvalidLayerConfiguration, but got %v", err)
+	}
+	err = net.checkBatchSize(2, 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	layer := bn.(*BatchNormLayer)
+	layer.RunningMean.Zero()
+	layer.RunningVariance = mat.NewDense(2, 1, []float64{1, 1})
+	err = net.PrepareBatchStatistics(batch)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Every feature should be normalized over mini-batch: mean 0 and variance 1
+	correct := [][]float64{{-1, -1}, {1, 1}}
+	for i := range batch {
+		err = bn.FeedForward(batch[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for j, v := range bn.GetActivatedOutput().RawMatrix().Data {
+			if math.Abs(v-correct[i][j]) > 1e-3 {
+				t.Errorf("Output of sample %d in position %d should be %f, but got %f", i, j, correct[i][j], v)
+			}
+		}
+	}
+
+	// running = 0.9 * running + 0.1 * batch (variance is unbiased)
+	correctMean := []float64{0.1 * 2, 0.1 * 15}
+	correctVariance := []float64{0.9 + 0.1*2, 0.9 + 0.1*50}
+	for g := 0; g < 2; g++ {
+		if math.Abs(layer.RunningMean.At(g, 0)-correctMean[g]) > 1e-12 {
+			t.Errorf("Running mean of feature %d should be %f, but got %f", g, correctMean[g], layer.RunningMean.At(g, 0))
+		}
+		if math.Abs(layer.RunningVariance.At(g, 0)-correctVariance[g]) > 1e-12 {
+			t.Errorf("Running variance of feature %d should be %f, but got %f", g, correctVariance[g], layer.RunningVariance.At(g, 0))
+		}
+	}
+
+	// Inference mode uses running statistics
+	net.SetTrainMode(false)
+	err = net.FeedForward(batch[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for j, v := range net.GetOutput().RawMatrix().Data {
+		c := (batch[0].At(j, 0) - correctMean[j]) / math.Sqrt(correctVariance[j]+layer.Epsilon)
+		if math.Abs(v-c) > 1e-12 {
+			t.Errorf("Inference output in position %d should be %f, but got %f", j, c, v)
+		}
+	}
+}
+
+func TestBatchNormChannel(t *testing.T) {
+	// Two channels 2x2 stacked vertically
+	bn := NewBatchNormLayer(&tensor.TDsize{X: 2, Y: 2, Z: 2}, "channel")
+	bn.(*BatchNormLayer).SetTrainMode(true)
+	bn.SetCustomWeights([]*mat.Dense{
+		mat.NewDense(2, 1, []float64{2, 1}),
+		mat.NewDense(2, 1, []float64{0, 5}),
+	})
+	input := mat.NewDense(4, 2, []float64{
+		1, 2,
+		3, 4,
+		10, 10,
+		10, 10,
+	})
+	net := WholeNet{Layers: []Layer{bn}, LP: NewLearningParametersDefault()}
+	// Single sample is mini-batch itself
+	err := net.PrepareBatchStatistics([]*mat.Dense{input})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = bn.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	std := math.Sqrt(1.25 + 1e-5)
+	correct := []float64{
+		2 * (-1.5 / std), 2 * (-0.5 / std),
+		2 * (0.5 / std), 2 * (1.5 / std),
+		5, 5,
+		5, 5,
+	}
+	for i, v := range bn.GetActivatedOutput().RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-9 {
+			t.Errorf("Output in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+
+	// Gradients with respect to inputs need sums of incoming gradients over mini-batch
+	errorsDense := mat.NewDense(4, 2, []float64{1, 1, 1, 1, 1, 1, 1, 1})
+	err = bn.CalculateGradients(errorsDense)
+	if errors.Cause(err) != ErrNoBatchStatistics {
+		t.Errorf("Backward pass without sums of gradients should cause ErrNoBatchStatistics, but got %v", err)
+	}
+	// Gradient of MSE is (O - T), so every incoming gradient is 1
+	desired := mat.NewDense(4, 2, nil)
+	desired.Sub(bn.GetActivatedOutput(), errorsDense)
+	_, err = net.CalculateBatchGradients([]*mat.Dense{input}, []*mat.Dense{desired})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	layer := bn.(*BatchNormLayer)
+	if math.Abs(layer.BetaGradients.At(0, 0)-4) > 1e-12 || math.Abs(layer.BetaGradients.At(1, 0)-4) > 1e-12 {
+		t.Errorf("Gradients of beta should be [4, 4], but got %v", layer.BetaGradients.RawMatrix().Data)
+	}
+	// Shift of all values in channel does not change normalized output
+	for i, v := range layer.GetGradients().RawMatrix().Data {
+		if math.Abs(v) > 1e-9 {
+			t.Errorf("Gradient in position %d should be 0, but got %f", i, v)
+		}
+	}
+}
+
+func TestBatchNormGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	net, err := NewSequential(&tensor.TDsize{X: 3, Y: 1, Z: 1}).
+		Dense(2, WithBias(), WithRand(r)).
+		BatchNorm("feature").
+		Dense(2, WithBias(), WithRand(r)).
+		BatchNorm("feature").
+		Dense(2, WithRand(r)).
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bn := net.Layers[1].(*BatchNormLayer)
+	bn.Gamma = mat.NewDense(2, 1, []float64{1.5, 0.7})
+	bn.Beta = mat.NewDense(2, 1, []float64{0.2, -0.3})
+	inputs := make([]*mat.Dense, 3)
+	desired := make([]*mat.Dense, 3)
+	for i := range inputs {
+		inputs[i] = mat.NewDense(3, 1, []float64{r.NormFloat64(), r.NormFloat64(), r.NormFloat64()})
+		desired[i] = mat.NewDense(2, 1, []float64{r.NormFloat64(), r.NormFloat64()})
+	}
+	net.SetTrainMode(true)
+
+	_, err = net.CalculateBatchGradients(inputs, desired)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fc := net.Layers[0].(*FullyConnectedLayer)
+	weightsGradients := mat.DenseCopyOf(fc.WeightsGradients)
+	gammaGradients := mat.DenseCopyOf(bn.GammaGradients)
+	betaGradients := mat.DenseCopyOf(bn.BetaGradients)
+
+	// Gradients of MSE are evaluated for ½·Σ(O - T)², while its value is Σ(O - T)²
+	numerical := func(param *mat.Dense, i, j int) float64 {
+		h := 1e-6
+		v := param.At(i, j)
+		param.Set(i, j, v+h)
+		plus, err := net.CalculateBatchGradients(inputs, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		param.Set(i, j, v-h)
+		minus, err := net.CalculateBatchGradients(inputs, desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		param.Set(i, j, v)
+		return (plus - minus) / (2 * h) / 2
+	}
+	// Weights of previous layers get gradients through ΔE/Δx of both batch normalization layers
+	rows, cols := fc.Weights.Dims()
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			if n := numerical(fc.Weights, i, j); math.Abs(n-weightsGradients.At(i, j)) > 1e-5 {
+				t.Errorf("Gradient for weight (%d, %d) should be %f, but got %f", i, j, n, weightsGradients.At(i, j))
+			}
+		}
+	}
+	for g := 0; g < 2; g++ {
+		if n := numerical(bn.Gamma, g, 0); math.Abs(n-gammaGradients.At(g, 0)) > 1e-5 {
+			t.Errorf("Gradient for gamma #%d should be %f, but got %f", g, n, gammaGradients.At(g, 0))
+		}
+		if n := numerical(bn.Beta, g, 0); math.Abs(n-betaGradients.At(g, 0)) > 1e-5 {
+			t.Errorf("Gradient for beta #%d should be %f, but got %f", g, n, betaGradients.At(g, 0))
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package cnns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+/*
+	Binary model format (all numbers are little-endian):
+
+	Header:
+		magic   [4]byte - "CNNS"
+		version uint16  - version of format (see BinaryFormatVersion)
+		flags   uint16  - bit 0: tensors are stored as float32 (float64 otherwise)
+
+	Header is followed by sections:
+		kind    uint8   - type of section
+		length  uint64  - length of payload in bytes
+		payload [length]byte
+		crc     uint32  - CRC-32 (IEEE) of payload
+
+	Sections:
+		descriptor - JSON representation of network (same as NetJSON) with all tensors' data stripped (shapes are kept). Must be the first section
+		layer      - tensors of single layer:
+			index uint32 - index of layer in descriptor
+			for every weights' tensor of layer (and biases' tensor if layer has them):
+				count uint64 - number of elements
+				data  [count]float32 or [count]float64
+		end        - marks end of stream (empty payload)
+
+	Readers skip sections of unknown kinds (their checksums are verified still), so new kinds of sections can be added without breaking old readers.
+	New layer types need no changes of format: they are described in descriptor section and store tensors in layer sections.
+*/
+
+// BinaryFormatVersion Current version of binary model format. Files with greater version can't be read
+const BinaryFormatVersion = 1
+
+var binaryMagic = [4]byte{'C', 'N', 'N', 'S'}
+
+const (
+	binaryFlagFloat32 = 1 << 0
+)
+
+const (
+	binarySectionDescriptor = 1
+	binarySectionLayer      = 2
+	binarySectionEnd        = 255
+)
+
+// BinaryOption Optional parameter for binary export
+type BinaryOption func(*binaryOptions)
+
+type binaryOptions struct {
+	float32 bool
+}
+
+// WithFloat32 Store tensors as float32 (half of size of default float64 storage with loss of precision)
+func WithFloat32() BinaryOption {
+	return func(opts *binaryOptions) {
+		opts.float32 = true
+	}
+}
+
+// ExportToBinaryFile Save network structure and its weights to binary file
+/*
+	fname - filename
+	saveWeights - save weights too (otherwise only structure of network is saved)
+	options - optional parameters (see WithFloat32())
+
+	Existing file is replaced only if network has been exported successfully (see writeFileAtomic())
+*/
+func (wh *WholeNet) ExportToBinaryFile(fname string, saveWeights bool, options ...BinaryOption) error {
+	err := writeFileAtomic(fname, func(w io.Writer) error {
+		return wh.ExportBinary(w, saveWeights, options...)
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Can't write data to file '%s'", fname))
+	}
+	return nil
+}
+
+// ExportBinary Write network structure (and its weights if needed) in binary format to writer
+/*
+	w - destination
+	saveWeights - save weights too (otherwise only structure of network is saved)
+	options - optional parameters (see WithFloat32())
+*/
+func (wh *WholeNet) ExportBinary(w io.Writer, saveWeights bool, options ...BinaryOption) error {
+	data, err := wh.toJSON(saveWeights)
+	if err != nil {
+		return err
+	}
+	_, err = writeBinary(w, data, options...)
+	return err
+}
+
+// ImportFromBinaryFile Load network from binary file
+/*
+	fname - filename
+	randomWeights - see ImportFromFile()
+*/
+func (wh *WholeNet) ImportFromBinaryFile(fname string, randomWeights bool) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return wh.ImportBinary(file, randomWeights)
+}
+
+// ImportBinary Load network from binary format provided by reader
+/*
+	r - source
+	randomWeights - see ImportFromFile()
+*/
+func (wh *WholeNet) ImportBinary(r io.Reader, randomWeights bool) error {
+	data, err := readBinary(r)
+	if err != nil {
+		return err
+	}
+	return wh.fromJSON(data, randomWeights)
+}
+
+// ConvertJSONToBinary Convert network in JSON format (see ExportToFile()) to binary format (see ExportToBinaryFile())
+/*
+	r - source of JSON
+	w - destination of binary data
+	options - optional parameters (see WithFloat32())
+*/
+func ConvertJSONToBinary(r io.Reader, w io.Writer, options ...BinaryOption) error {
+	var data NetJSON
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return errors.Wrap(err, "Can't unmarshal network")
+	}
+	_, err = writeBinary(w, &data, options...)
+	return err
+}
+
+// ConvertBinaryToJSON Convert network in binary format (see ExportToBinaryFile()) to JSON format (see ExportToFile())
+/*
+	r - source of binary data
+	w - destination of JSON
+*/
+func ConvertBinaryToJSON(r io.Reader, w io.Writer) error {
+	data, err := readBinary(r)
+	if err != nil {
+		return err
+	}
+	saveJSON, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "Can't marshal network to JSON")
+	}
+	_, err = w.Write(saveJSON)
+	if err != nil {
+		return errors.Wrap(err, "Can't write network")
+	}
+	return nil
+}
+
+// countingWriter Writer which counts written bytes
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// writeBinary Write network in binary format. Returns number of written bytes
+func writeBinary(w io.Writer, data *NetJSON, options ...BinaryOption) (int64, error) {
+	opts := &binaryOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	if data.Network == nil {
+		return 0, fmt.Errorf("There is no network description")
+	}
+	cw := &countingWriter{w: w}
+
+	header := make([]byte, 8)
+	copy(header, binaryMagic[:])
+	binary.LittleEndian.PutUint16(header[4:], BinaryFormatVersion)
+	var flags uint16
+	if opts.float32 {
+		flags |= binaryFlagFloat32
+	}
+	binary.LittleEndian.PutUint16(header[6:], flags)
+	_, err := cw.Write(header)
+	if err != nil {
+		return cw.n, errors.Wrap(err, "Can't write header of binary model")
+	}
+
+	descriptor, err := json.Marshal(stripTensors(data))
+	if err != nil {
+		return cw.n, errors.Wrap(err, "Can't marshal descriptor of binary model")
+	}
+	err = writeBinarySection(cw, binarySectionDescriptor, descriptor)
+	if err != nil {
+		return cw.n, err
+	}
+
+	for i, layer := range data.Network.Layers {
+		tensors := layerTensors(layer)
+		if len(tensors) == 0 {
+			continue
+		}
+		payload := &bytes.Buffer{}
+		// Writing to bytes.Buffer never fails, so errors are not checked
+		index := make([]byte, 4)
+		binary.LittleEndian.PutUint32(index, uint32(i))
+		payload.Write(index)
+		for _, t := range tensors {
+			var values []float64
+			if t != nil {
+				values = t.Data
+			}
+			count := make([]byte, 8)
+			binary.LittleEndian.PutUint64(count, uint64(len(values)))
+			payload.Write(count)
+			if opts.float32 {
+				buf := make([]byte, 4*len(values))
+				for v := range values {
+					binary.LittleEndian.PutUint32(buf[4*v:], math.Float32bits(float32(values[v])))
+				}
+				payload.Write(buf)
+			} else {
+				buf := make([]byte, 8*len(values))
+				for v := range values {
+					binary.LittleEndian.PutUint64(buf[8*v:], math.Float64bits(values[v]))
+				}
+				payload.Write(buf)
+			}
+		}
+		err = writeBinarySection(cw, binarySectionLayer, payload.Bytes())
+		if err != nil {
+			return cw.n, errors.Wrapf(err, "Can't write tensors of layer #%d", i)
+		}
+	}
+
+	err = writeBinarySection(cw, binarySectionEnd, nil)
+	if err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// writeBinarySection Write single section of binary model
+func writeBinarySection(w io.Writer, kind uint8, payload []byte) error {
+	head := make([]byte, 9)
+	head[0] = kind
+	binary.LittleEndian.PutUint64(head[1:], uint64(len(payload)))
+	_, err := w.Write(head)
+	if err != nil {
+		return errors.Wrap(err, "Can't write section of binary model")
+	}
+	_, err = w.Write(payload)
+	if err != nil {
+		return errors.Wrap(err, "Can't write section of binary model")
+	}
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(payload))
+	_, err = w.Write(crc)
+	if err != nil {
+		return errors.Wrap(err, "Can't write section of binary model")
+	}
+	return nil
+}
+
+// readBinary Read network in binary format
+func readBinary(r io.Reader) (*NetJSON, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, errors.Wrap(ErrBinaryFormat, "Can't read header")
+	}
+	if !bytes.Equal(header[:4], binaryMagic[:]) {
+		return nil, errors.Wrap(ErrBinaryFormat, "Wrong magic number")
+	}
+	version := binary.LittleEndian.Uint16(header[4:])
+	if version == 0 || version > BinaryFormatVersion {
+		return nil, errors.Wrapf(ErrBinaryFormat, "Unsupported version %d (maximum supported is %d)", version, BinaryFormatVersion)
+	}
+	isFloat32 := binary.LittleEndian.Uint16(header[6:])&binaryFlagFloat32 != 0
+
+	var data *NetJSON
+	// Indices of layers whose sections have been read already
+	loaded := make(map[int]bool)
+	for {
+		kind, payload, err := readBinarySection(r)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case binarySectionDescriptor:
+			if data != nil {
+				return nil, errors.Wrap(ErrBinaryFormat, "Duplicate descriptor section")
+			}
+			data = &NetJSON{}
+			err = json.Unmarshal(payload, data)
+			if err != nil {
+				return nil, errors.Wrap(err, "Can't unmarshal descriptor of binary model")
+			}
+			if data.Network == nil {
+				return nil, errors.Wrap(ErrBinaryFormat, "There is no network description")
+			}
+			break
+		case binarySectionLayer:
+			if data == nil {
+				return nil, errors.Wrap(ErrBinaryFormat, "Layer section before descriptor section")
+			}
+			err = readLayerTensors(data, payload, isFloat32, loaded)
+			if err != nil {
+				return nil, err
+			}
+			break
+		case binarySectionEnd:
+			if data == nil {
+				return nil, errors.Wrap(ErrBinaryFormat, "There is no descriptor section")
+			}
+			return data, nil
+		default:
+			// Section of newer version of format: skip it
+			break
+		}
+	}
+}
+
+// readBinarySection Read single section of binary model and verify its checksum
+func readBinarySection(r io.Reader) (uint8, []byte, error) {
+	head := make([]byte, 9)
+	_, err := io.ReadFull(r, head)
+	if err != nil {
+		return 0, nil, errors.Wrap(ErrBinaryFormat, "Can't read section (is stream truncated?)")
+	}
+	kind := head[0]
+	length := binary.LittleEndian.Uint64(head[1:])
+	if length > math.MaxInt64 {
+		return 0, nil, errors.Wrap(ErrBinaryFormat, "Section is too large")
+	}
+	// Buffer grows while data arrives, so corrupted length does not cause huge allocation
+	payload := &bytes.Buffer{}
+	_, err = io.CopyN(payload, r, int64(length))
+	if err != nil {
+		return 0, nil, errors.Wrap(ErrBinaryFormat, "Can't read section (is stream truncated?)")
+	}
+	crc := make([]byte, 4)
+	_, err = io.ReadFull(r, crc)
+	if err != nil {
+		return 0, nil, errors.Wrap(ErrBinaryFormat, "Can't read checksum of section (is stream truncated?)")
+	}
+	if binary.LittleEndian.Uint32(crc) != crc32.ChecksumIEEE(payload.Bytes()) {
+		return 0, nil, errors.Wrapf(ErrBinaryChecksum, "Section of kind %d", kind)
+	}
+	return kind, payload.Bytes(), nil
+}
+
+// readLayerTensors Fill tensors of layer described in descriptor with data of layer section
+/*
+	loaded - indices of layers which have been filled already (section of the same layer twice means corrupted file)
+*/
+func readLayerTensors(data *NetJSON, payload []byte, isFloat32 bool, loaded map[int]bool) error {
+	if len(payload) < 4 {
+		return errors.Wrap(ErrBinaryFormat, "Layer section is too short")
+	}
+	index := int(binary.LittleEndian.Uint32(payload))
+	if index >= len(data.Network.Layers) {
+		return errors.Wrapf(ErrBinaryFormat, "Layer section refers to layer #%d, but there are %d layers only", index, len(data.Network.Layers))
+	}
+	if loaded[index] {
+		return errors.Wrapf(ErrBinaryFormat, "Layer section for layer #%d is duplicated", index)
+	}
+	loaded[index] = true
+	payload = payload[4:]
+	elementSize := 8
+	if isFloat32 {
+		elementSize = 4
+	}
+	tensors := layerTensors(data.Network.Layers[index])
+	for t := range tensors {
+		if len(payload) < 8 {
+			return errors.Wrapf(ErrBinaryFormat, "Tensors of layer #%d are truncated", index)
+		}
+		count := binary.LittleEndian.Uint64(payload)
+		payload = payload[8:]
+		if count > uint64(len(payload)/elementSize) {
+			return errors.Wrapf(ErrBinaryFormat, "Tensors of layer #%d are truncated", index)
+		}
+		if tensors[t] == nil {
+			if count != 0 {
+				return errors.Wrapf(ErrBinaryFormat, "Tensor #%d of layer #%d is not described in descriptor", t, index)
+			}
+			continue
+		}
+		if count == 0 {
+			continue
+		}
+		values := make([]float64, count)
+		for v := range values {
+			if isFloat32 {
+				values[v] = float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[4*v:])))
+			} else {
+				values[v] = math.Float64frombits(binary.LittleEndian.Uint64(payload[8*v:]))
+			}
+		}
+		tensors[t].Data = values
+		payload = payload[int(count)*elementSize:]
+	}
+	if len(payload) != 0 {
+		return errors.Wrapf(ErrBinaryFormat, "Unexpected data after tensors of layer #%d", index)
+	}
+	return nil
+}
+
+// layerTensors Returns tensors of layer in order of storing: weights and then biases (if layer has them)
+func layerTensors(layer *NetLayerJSON) []*NestedData {
+	tensors := make([]*NestedData, 0, len(layer.Weights)+1)
+	tensors = append(tensors, layer.Weights...)
+	if layer.Biases != nil {
+		tensors = append(tensors, layer.Biases)
+	}
+	return tensors
+}
+
+// stripTensors Returns copy of network description without tensors' data (layout of tensors is kept)
+func stripTensors(data *NetJSON) *NetJSON {
+	stripped := &NetJSON{
+		Network:    &NetworkJSON{Layers: make([]*NetLayerJSON, len(data.Network.Layers))},
+		Parameters: data.Parameters,
+		Loss:       data.Loss,
+	}
+	for i, layer := range data.Network.Layers {
+		strippedLayer := *layer
+		if layer.Weights != nil {
+			strippedLayer.Weights = make([]*NestedData, len(layer.Weights))
+			for w := range layer.Weights {
+				if layer.Weights[w] != nil {
+					strippedLayer.Weights[w] = &NestedData{Shape: layer.Weights[w].Shape}
+				}
+			}
+		}
+		if layer.Biases != nil {
+			strippedLayer.Biases = &NestedData{Shape: layer.Biases.Shape}
+		}
+		stripped.Network.Layers[i] = &strippedLayer
+	}
+	return stripped
+}
@@ -0,0 +1,305 @@
+package cnns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestBinaryFormat(t *testing.T) {
+	layersRand := rand.New(rand.NewSource(5))
+	net, err := NewSequential(&tensor.TDsize{X: 6, Y: 6, Z: 1}).
+		Conv(3, 2, 1, WithBias(), WithRand(layersRand)).
+		BatchNorm("channel").
+		PReLU().
+		MaxPool(2, 2).
+		Dropout(0.2).
+		Dense(3, WithBias(), WithRand(layersRand)).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	net.Loss = NewLossCategoricalCrossEntropy()
+	// Make statistics of batch normalization non-trivial
+	bn := net.Layers[1].(*BatchNormLayer)
+	bn.RunningMean.Set(1, 0, 0.3)
+	bn.RunningVariance.Set(0, 0, 1.7)
+
+	input := mat.NewDense(6, 6, nil)
+	for i := range input.RawMatrix().Data {
+		input.RawMatrix().Data[i] = layersRand.Float64() - 0.5
+	}
+	expected, err := net.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	binaryFile := filepath.Join(dir, "net.cnns")
+	jsonFile := filepath.Join(dir, "net.json")
+	err = net.ExportToBinaryFile(binaryFile, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = net.ExportToFile(jsonFile, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{}
+	err = imported.ImportFromBinaryFile(binaryFile, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	output, err := imported.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(expected, output) {
+		t.Errorf("Output of network restored from binary file should be\n%v\nbut got\n%v", mat.Formatted(expected), mat.Formatted(output))
+	}
+	if imported.getLoss().GetType() != net.getLoss().GetType() {
+		t.Errorf("Loss function should be '%s', but got '%s'", net.getLoss().GetType(), imported.getLoss().GetType())
+	}
+
+	// Float32 storage: smaller, slightly less precise
+	buf64 := &bytes.Buffer{}
+	err = net.ExportBinary(buf64, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf32 := &bytes.Buffer{}
+	err = net.ExportBinary(buf32, true, WithFloat32())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if buf32.Len() >= buf64.Len() {
+		t.Errorf("Float32 storage (%d bytes) should be smaller than float64 storage (%d bytes)", buf32.Len(), buf64.Len())
+	}
+	imported32 := WholeNet{}
+	err = imported32.ImportBinary(bytes.NewReader(buf32.Bytes()), false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	output, err = imported32.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.EqualApprox(expected, output, 1e-5) {
+		t.Errorf("Output of network restored from float32 storage should be close to\n%v\nbut got\n%v", mat.Formatted(expected), mat.Formatted(output))
+	}
+
+	// Converter: JSON -> binary -> JSON gives the same JSON
+	jsonBytes, err := ioutil.ReadFile(jsonFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	converted := &bytes.Buffer{}
+	err = ConvertJSONToBinary(bytes.NewReader(jsonBytes), converted)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(converted.Bytes(), buf64.Bytes()) {
+		t.Errorf("Binary data converted from JSON should be the same as exported one")
+	}
+	if converted.Len() >= len(jsonBytes) {
+		t.Errorf("Binary data (%d bytes) should be smaller than JSON (%d bytes)", converted.Len(), len(jsonBytes))
+	}
+	back := &bytes.Buffer{}
+	err = ConvertBinaryToJSON(converted, back)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(back.Bytes(), jsonBytes) {
+		t.Errorf("JSON converted from binary data should be the same as exported one")
+	}
+}
+
+func TestBinaryFormatStructureOnly(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 5, Y: 5, Z: 1}).
+		Conv(3, 2, 1, WithBias()).
+		Dense(2).
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	err = net.ExportBinary(buf, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	imported := WholeNet{}
+	err = imported.ImportBinary(buf, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(imported.Layers) != 2 || imported.Layers[0].(*ConvLayer).Biases == nil {
+		t.Errorf("Structure of network has not been restored")
+	}
+}
+
+func TestBinaryFormatCorruption(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 4, Y: 1, Z: 1}).
+		Dense(3, WithBias()).
+		Dense(2).
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	err = net.ExportBinary(buf, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := buf.Bytes()
+
+	// Flip single bit in the last float of tensors (end section is 13 bytes, checksum of layer section is 4 bytes)
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-13-4-2] ^= 0x01
+	err = (&WholeNet{}).ImportBinary(bytes.NewReader(corrupted), false)
+	if errors.Cause(err) != ErrBinaryChecksum {
+		t.Errorf("Corrupted data should cause checksum error, but got: %v", err)
+	}
+
+	// Truncated stream
+	err = (&WholeNet{}).ImportBinary(bytes.NewReader(data[:len(data)-20]), false)
+	if errors.Cause(err) != ErrBinaryFormat {
+		t.Errorf("Truncated data should cause format error, but got: %v", err)
+	}
+
+	// Not a binary model at all
+	err = (&WholeNet{}).ImportBinary(bytes.NewReader([]byte(`{"network":{}}`)), false)
+	if errors.Cause(err) != ErrBinaryFormat {
+		t.Errorf("JSON data should cause format error, but got: %v", err)
+	}
+
+	// Future version of format
+	future := append([]byte{}, data...)
+	binary.LittleEndian.PutUint16(future[4:], BinaryFormatVersion+1)
+	err = (&WholeNet{}).ImportBinary(bytes.NewReader(future), false)
+	if errors.Cause(err) != ErrBinaryFormat {
+		t.Errorf("Unsupported version should cause format error, but got: %v", err)
+	}
+
+	// Second section for the same layer: insert one (with 6 zero weights of layer #1) before end section
+	payload := make([]byte, 4+8+6*8)
+	binary.LittleEndian.PutUint32(payload, 1)
+	binary.LittleEndian.PutUint64(payload[4:], 6)
+	duplicate := &bytes.Buffer{}
+	err = writeBinarySection(duplicate, binarySectionLayer, payload)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	duplicated := append([]byte{}, data[:len(data)-13]...)
+	duplicated = append(duplicated, duplicate.Bytes()...)
+	duplicated = append(duplicated, data[len(data)-13:]...)
+	err = (&WholeNet{}).ImportBinary(bytes.NewReader(duplicated), false)
+	if errors.Cause(err) != ErrBinaryFormat {
+		t.Errorf("Duplicated layer section should cause format error, but got: %v", err)
+	}
+
+	// Sections of unknown kind are skipped: insert one before end section
+	unknown := &bytes.Buffer{}
+	err = writeBinarySection(unknown, 42, []byte("section of newer version"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	extended := append([]byte{}, data[:len(data)-13]...)
+	extended = append(extended, unknown.Bytes()...)
+	extended = append(extended, data[len(data)-13:]...)
+	imported := WholeNet{}
+	err = imported.ImportBinary(bytes.NewReader(extended), false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	weights := imported.Layers[0].(*FullyConnectedLayer).Weights.RawMatrix().Data
+	for i, w := range net.Layers[0].(*FullyConnectedLayer).Weights.RawMatrix().Data {
+		if math.Float64bits(w) != math.Float64bits(weights[i]) {
+			t.Errorf("Weight #%d should be %v, but got %v", i, w, weights[i])
+		}
+	}
+}
+
+func TestExportToBinaryFileKeepsFileOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.cnns")
+
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1}, 2)
+	net := WholeNet{
+		Layers: []Layer{fc},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToBinaryFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	saved, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	net.Layers = append(net.Layers, &unknownLayer{NewReLULayer(fc.GetOutputSize())})
+	err = net.ExportToBinaryFile(fname, true)
+	if err == nil {
+		t.Errorf("Export of unknown layer should cause error")
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(saved, data) {
+		t.Errorf("Failed export should keep existing file")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(files) != 1 {
+		t.Errorf("Failed export should not leave temporary files, but there are %d files", len(files))
+	}
+}
@@ -0,0 +1,342 @@
+package cnns
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// BatchInfo Information about processed mini-batch
+/*
+	Epoch - number of epoch (starting from 0)
+	Batch - number of mini-batch in epoch (starting from 0)
+	Size - number of samples in mini-batch
+	Loss - mean value of loss function over mini-batch (evaluated in training mode before weights update)
+*/
+type BatchInfo struct {
+	Epoch int
+	Batch int
+	Size  int
+	Loss  float64
+}
+
+// EpochInfo Information about finished epoch
+/*
+	Epoch - number of epoch (starting from 0)
+	TrainLoss - mean value of loss function over training data (evaluated in training mode while epoch goes)
+	HasValidation - true if validation data has been provided
+	ValidationLoss - mean value of loss function over validation data (evaluated in inference mode after epoch)
+	ValidationAccuracy - share of validation samples where index of max output is equal to index of max target (makes sense for classification only)
+	Duration - time spent on epoch (including validation)
+*/
+type EpochInfo struct {
+	Epoch              int
+	TrainLoss          float64
+	HasValidation      bool
+	ValidationLoss     float64
+	ValidationAccuracy float64
+	Duration           time.Duration
+}
+
+// Callback Hooks which are called while training (see Fit()). Return ErrStopTraining to stop training, any other error aborts training
+type Callback interface {
+	// OnBatchEnd Called after weights have been updated for mini-batch
+	OnBatchEnd(net *WholeNet, info BatchInfo) error
+	// OnEpochEnd Called after every epoch (and validation)
+	OnEpochEnd(net *WholeNet, info EpochInfo) error
+}
+
+// CallbackFuncs Callback made of functions. Nil functions are ignored
+type CallbackFuncs struct {
+	BatchEnd func(net *WholeNet, info BatchInfo) error
+	EpochEnd func(net *WholeNet, info EpochInfo) error
+}
+
+// OnBatchEnd See Callback.OnBatchEnd()
+func (callback *CallbackFuncs) OnBatchEnd(net *WholeNet, info BatchInfo) error {
+	if callback.BatchEnd == nil {
+		return nil
+	}
+	return callback.BatchEnd(net, info)
+}
+
+// OnEpochEnd See Callback.OnEpochEnd()
+func (callback *CallbackFuncs) OnEpochEnd(net *WholeNet, info EpochInfo) error {
+	if callback.EpochEnd == nil {
+		return nil
+	}
+	return callback.EpochEnd(net, info)
+}
+
+// History Per-epoch curves of training (see Fit())
+/*
+	Epochs - information about every finished epoch
+	Stopped - true if training has been stopped by callback (e.g. early stopping)
+*/
+type History struct {
+	Epochs  []EpochInfo
+	Stopped bool
+}
+
+// TrainLoss Returns mean values of loss function over training data for every epoch
+func (history *History) TrainLoss() []float64 {
+	values := make([]float64, len(history.Epochs))
+	for i := range history.Epochs {
+		values[i] = history.Epochs[i].TrainLoss
+	}
+	return values
+}
+
+// ValidationLoss Returns mean values of loss function over validation data for every epoch
+func (history *History) ValidationLoss() []float64 {
+	values := make([]float64, len(history.Epochs))
+	for i := range history.Epochs {
+		values[i] = history.Epochs[i].ValidationLoss
+	}
+	return values
+}
+
+// ValidationAccuracy Returns validation accuracy for every epoch
+func (history *History) ValidationAccuracy() []float64 {
+	values := make([]float64, len(history.Epochs))
+	for i := range history.Epochs {
+		values[i] = history.Epochs[i].ValidationAccuracy
+	}
+	return values
+}
+
+// trainingCallback Callback which should be notified when training starts and finishes (see Fit())
+type trainingCallback interface {
+	// onTrainBegin Called before training starts (and before state of callback is restored from checkpoint, see TrainOptions.Resume)
+	onTrainBegin()
+	// onTrainEnd Called after training has been finished without error (either stopped by callback or after the last epoch)
+	onTrainEnd(net *WholeNet) error
+}
+
+// parametersLayer Layer with trainable parameters (or statistics) which could be saved and restored
+type parametersLayer interface {
+	// trainableParameters Returns matrices with layer's parameters (not copies)
+	trainableParameters() []*mat.Dense
+}
+
+// snapshotParameters Returns copies of parameters of every layer (nil for layers without parameters)
+func (wh *WholeNet) snapshotParameters() [][]*mat.Dense {
+	snapshot := make([][]*mat.Dense, len(wh.Layers))
+	for l := range wh.Layers {
+		layer, ok := wh.Layers[l].(parametersLayer)
+		if !ok {
+			continue
+		}
+		parameters := layer.trainableParameters()
+		snapshot[l] = make([]*mat.Dense, len(parameters))
+		for i := range parameters {
+			snapshot[l][i] = mat.DenseCopyOf(parameters[i])
+		}
+	}
+	return snapshot
+}
+
+// restoreParameters Copies parameters from snapshot (see snapshotParameters()) to layers
+func (wh *WholeNet) restoreParameters(snapshot [][]*mat.Dense) error {
+	if len(snapshot) != len(wh.Layers) {
+		return fmt.Errorf("Snapshot has %d layers, but net has %d layers", len(snapshot), len(wh.Layers))
+	}
+	for l := range wh.Layers {
+		layer, ok := wh.Layers[l].(parametersLayer)
+		if !ok {
+			continue
+		}
+		parameters := layer.trainableParameters()
+		if len(parameters) != len(snapshot[l]) {
+			return fmt.Errorf("Snapshot of layer #%d has %d parameters matrices, but layer has %d", l, len(snapshot[l]), len(parameters))
+		}
+		for i := range parameters {
+			pr, pc := parameters[i].Dims()
+			sr, sc := snapshot[l][i].Dims()
+			if pr != sr || pc != sc {
+				return fmt.Errorf("Parameters #%d of layer #%d have dimensions %dx%d, but snapshot has %dx%d", i, l, pr, pc, sr, sc)
+			}
+			parameters[i].Copy(snapshot[l][i])
+		}
+	}
+	return nil
+}
+
+// EarlyStopping Callback which stops training when monitored loss has not been improved for Patience epochs
+/*
+	Patience - number of epochs without improvement before stopping
+	MinDelta - minimal decrease of loss which is treated as improvement
+	MonitorTrainLoss - monitor training loss instead of validation one (training loss is monitored if there is no validation data anyway)
+	RestoreBestWeights - restore parameters of the best epoch when training is finished (either stopped or after the last epoch)
+	BestEpoch - number of the best epoch
+	BestLoss - value of monitored loss on the best epoch
+	StoppedEpoch - number of epoch when training has been stopped (-1 if it has not been stopped)
+
+	State is reset when training starts (see Fit()), so the same callback could be used for several trainings
+*/
+type EarlyStopping struct {
+	Patience           int
+	MinDelta           float64
+	MonitorTrainLoss   bool
+	RestoreBestWeights bool
+
+	BestEpoch    int
+	BestLoss     float64
+	StoppedEpoch int
+
+	wait        int
+	bestWeights [][]*mat.Dense
+}
+
+// NewEarlyStopping Constructor for early stopping callback. Parameters of the best epoch are restored when training is finished
+/*
+	patience - number of epochs without improvement before stopping
+	minDelta - minimal decrease of loss which is treated as improvement
+*/
+func NewEarlyStopping(patience int, minDelta float64) *EarlyStopping {
+	if patience < 1 {
+		fmt.Println("Patience for early stopping should be at least 1. Setting default value which is 1")
+		patience = 1
+	}
+	return &EarlyStopping{
+		Patience:           patience,
+		MinDelta:           minDelta,
+		RestoreBestWeights: true,
+		BestEpoch:          -1,
+		BestLoss:           math.Inf(1),
+		StoppedEpoch:       -1,
+	}
+}
+
+// OnBatchEnd See Callback.OnBatchEnd()
+func (es *EarlyStopping) OnBatchEnd(net *WholeNet, info BatchInfo) error {
+	return nil
+}
+
+// OnEpochEnd See Callback.OnEpochEnd()
+func (es *EarlyStopping) OnEpochEnd(net *WholeNet, info EpochInfo) error {
+	loss := info.ValidationLoss
+	if es.MonitorTrainLoss || !info.HasValidation {
+		loss = info.TrainLoss
+	}
+	if loss < es.BestLoss-es.MinDelta {
+		es.BestLoss = loss
+		es.BestEpoch = info.Epoch
+		es.wait = 0
+		if es.RestoreBestWeights {
+			es.bestWeights = net.snapshotParameters()
+		}
+		return nil
+	}
+	es.wait++
+	if es.wait < es.Patience {
+		return nil
+	}
+	es.StoppedEpoch = info.Epoch
+	if es.RestoreBestWeights && es.bestWeights != nil {
+		err := net.restoreParameters(es.bestWeights)
+		if err != nil {
+			return err
+		}
+	}
+	return ErrStopTraining
+}
+
+// onTrainBegin See trainingCallback
+func (es *EarlyStopping) onTrainBegin() {
+	es.BestEpoch = -1
+	es.BestLoss = math.Inf(1)
+	es.StoppedEpoch = -1
+	es.wait = 0
+	es.bestWeights = nil
+}
+
+// onTrainEnd See trainingCallback
+func (es *EarlyStopping) onTrainEnd(net *WholeNet) error {
+	if !es.RestoreBestWeights || es.bestWeights == nil {
+		return nil
+	}
+	return net.restoreParameters(es.bestWeights)
+}
+
+// earlyStoppingJSON JSON representation of early stopping state (see Checkpoint.Callbacks)
+/*
+	BestLoss - value of monitored loss on the best epoch (omitted if there is no best epoch yet)
+	BestWeights - parameters of every layer on the best epoch (empty for layers without parameters, see snapshotParameters())
+*/
+type earlyStoppingJSON struct {
+	BestEpoch    int             `json:"best_epoch"`
+	BestLoss     *float64        `json:"best_loss,omitempty"`
+	StoppedEpoch int             `json:"stopped_epoch"`
+	Wait         int             `json:"wait"`
+	BestWeights  [][]*NestedData `json:"best_weights,omitempty"`
+}
+
+// checkpointState See statefulCallback
+func (es *EarlyStopping) checkpointState() (json.RawMessage, error) {
+	state := earlyStoppingJSON{
+		BestEpoch:    es.BestEpoch,
+		StoppedEpoch: es.StoppedEpoch,
+		Wait:         es.wait,
+	}
+	if !math.IsInf(es.BestLoss, 0) && !math.IsNaN(es.BestLoss) {
+		bestLoss := es.BestLoss
+		state.BestLoss = &bestLoss
+	}
+	if es.bestWeights != nil {
+		state.BestWeights = make([][]*NestedData, len(es.bestWeights))
+		for l := range es.bestWeights {
+			state.BestWeights[l] = make([]*NestedData, len(es.bestWeights[l]))
+			for i, parameters := range es.bestWeights[l] {
+				rows, cols := parameters.Dims()
+				state.BestWeights[l][i] = &NestedData{
+					Shape: []int{rows, cols},
+					Data:  append([]float64{}, parameters.RawMatrix().Data...),
+				}
+			}
+		}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't marshal state of early stopping")
+	}
+	return data, nil
+}
+
+// restoreCheckpointState See statefulCallback
+func (es *EarlyStopping) restoreCheckpointState(data json.RawMessage) error {
+	state := earlyStoppingJSON{}
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return errors.Wrap(err, "Can't unmarshal state of early stopping")
+	}
+	var bestWeights [][]*mat.Dense
+	if state.BestWeights != nil {
+		bestWeights = make([][]*mat.Dense, len(state.BestWeights))
+		for l := range state.BestWeights {
+			if len(state.BestWeights[l]) == 0 {
+				continue
+			}
+			bestWeights[l] = make([]*mat.Dense, len(state.BestWeights[l]))
+			for i, parameters := range state.BestWeights[l] {
+				if parameters == nil || len(parameters.Shape) != 2 || parameters.Shape[0]*parameters.Shape[1] != len(parameters.Data) || len(parameters.Data) == 0 {
+					return errors.Wrapf(ErrDimensionsAreNotEqual, "Can't restore the best parameters #%d of layer #%d for early stopping", i, l)
+				}
+				bestWeights[l][i] = mat.NewDense(parameters.Shape[0], parameters.Shape[1], append([]float64{}, parameters.Data...))
+			}
+		}
+	}
+	es.BestEpoch = state.BestEpoch
+	es.BestLoss = math.Inf(1)
+	if state.BestLoss != nil {
+		es.BestLoss = *state.BestLoss
+	}
+	es.StoppedEpoch = state.StoppedEpoch
+	es.wait = state.Wait
+	es.bestWeights = bestWeights
+	return nil
+}
@@ -0,0 +1,235 @@
+package cnns
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestFitHistory(t *testing.T) {
+	inputs := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{0, 0}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{1, 0}),
+		mat.NewDense(2, 1, []float64{1, 1}),
+		mat.NewDense(2, 1, []float64{0.9, 0.1}),
+	}
+	targets := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{1, 0}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+	}
+	net, err := NewSequential(&tensor.TDsize{X: 2, Y: 1, Z: 1}).
+		Dense(4, WithBias(), WithRand(rand.New(rand.NewSource(1)))).
+		Dense(2, WithBias(), WithRand(rand.New(rand.NewSource(2)))).
+		Activation("sigmoid").
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	net.SetSeed(1)
+	net.LP.SetBatchSize(2)
+	net.LP.SetEta(0.5)
+
+	batches := []BatchInfo{}
+	epochs := []EpochInfo{}
+	callback := &CallbackFuncs{
+		BatchEnd: func(net *WholeNet, info BatchInfo) error {
+			batches = append(batches, info)
+			return nil
+		},
+		EpochEnd: func(net *WholeNet, info EpochInfo) error {
+			epochs = append(epochs, info)
+			return nil
+		},
+	}
+	history, err := net.Fit(inputs, targets, &TrainOptions{
+		Epochs:            30,
+		ValidationData:    inputs,
+		ValidationDesired: targets,
+		Callbacks:         []Callback{callback},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(history.Epochs) != 30 || len(epochs) != 30 || history.Stopped {
+		t.Errorf("History should have 30 epochs, but got %d (callback got %d)", len(history.Epochs), len(epochs))
+		return
+	}
+	// 5 samples with mini-batch of 2 => 3 mini-batches per epoch
+	if len(batches) != 90 {
+		t.Errorf("Number of OnBatchEnd() calls should be 90, but got %d", len(batches))
+	}
+	if batches[2].Batch != 2 || batches[2].Size != 1 || batches[3].Epoch != 1 || batches[3].Batch != 0 {
+		t.Errorf("Wrong information about mini-batches: %+v", batches[:4])
+	}
+	for e := range history.Epochs {
+		if history.Epochs[e] != epochs[e] || history.Epochs[e].Epoch != e || !history.Epochs[e].HasValidation {
+			t.Errorf("Wrong information about epoch #%d: %+v", e, history.Epochs[e])
+		}
+	}
+	trainLoss := history.TrainLoss()
+	validationLoss := history.ValidationLoss()
+	if trainLoss[len(trainLoss)-1] >= trainLoss[0] || validationLoss[len(validationLoss)-1] >= validationLoss[0] {
+		t.Errorf("Loss should decrease while training: train %v, validation %v", trainLoss, validationLoss)
+	}
+	loss, accuracy, err := net.evaluate(inputs, targets)
+	if err != nil {
+		t.Error(err)
+	}
+	last := history.Epochs[len(history.Epochs)-1]
+	if loss != last.ValidationLoss || accuracy != last.ValidationAccuracy {
+		t.Errorf("Validation of last epoch should be %f (accuracy %f), but got %f (accuracy %f)", loss, accuracy, last.ValidationLoss, last.ValidationAccuracy)
+	}
+
+	// Stop training by callback
+	stop := &CallbackFuncs{
+		EpochEnd: func(net *WholeNet, info EpochInfo) error {
+			if info.Epoch == 2 {
+				return ErrStopTraining
+			}
+			return nil
+		},
+	}
+	history, err = net.Fit(inputs, targets, &TrainOptions{Epochs: 10, Callbacks: []Callback{stop}})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(history.Epochs) != 3 || !history.Stopped || history.Epochs[0].HasValidation {
+		t.Errorf("Training should be stopped after 3 epochs, but got %d epochs (stopped: %t)", len(history.Epochs), history.Stopped)
+	}
+}
+
+func TestEarlyStopping(t *testing.T) {
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 1, WithBias())
+	net := &WholeNet{Layers: []Layer{fc, NewReLULayer(fc.GetOutputSize())}}
+	es := NewEarlyStopping(2, 0.01)
+	losses := []float64{1.0, 0.5, 0.495, 0.7, 0.3}
+	for e, loss := range losses {
+		// Weights depend on epoch
+		fc.SetCustomWeights([]*mat.Dense{mat.NewDense(1, 2, []float64{float64(e), float64(e)}), mat.NewDense(1, 1, []float64{float64(e)})})
+		err := es.OnEpochEnd(net, EpochInfo{Epoch: e, TrainLoss: 100, HasValidation: true, ValidationLoss: loss})
+		if e < 3 && err != nil {
+			t.Errorf("Training should not be stopped on epoch #%d, but got %v", e, err)
+		}
+		if e == 3 {
+			if err != ErrStopTraining {
+				t.Errorf("Training should be stopped on epoch #%d, but got %v", e, err)
+			}
+			break
+		}
+	}
+	if es.BestEpoch != 1 || es.BestLoss != 0.5 || es.StoppedEpoch != 3 {
+		t.Errorf("Best epoch should be 1 with loss 0.5 and stopped epoch should be 3, but got %d, %f, %d", es.BestEpoch, es.BestLoss, es.StoppedEpoch)
+	}
+	if !mat.Equal(fc.GetWeights()[0], mat.NewDense(1, 2, []float64{1, 1})) || fc.GetWeights()[1].At(0, 0) != 1 {
+		t.Errorf("Weights of best epoch should be restored, but got %v and %v", fc.GetWeights()[0].RawMatrix().Data, fc.GetWeights()[1].RawMatrix().Data)
+	}
+}
+
+func TestEarlyStoppingFit(t *testing.T) {
+	inputs := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{1, 0}),
+		mat.NewDense(2, 1, []float64{1, 1}),
+	}
+	targets := []*mat.Dense{
+		mat.NewDense(1, 1, []float64{1}),
+		mat.NewDense(1, 1, []float64{0}),
+		mat.NewDense(1, 1, []float64{0.5}),
+	}
+	net, err := NewSequential(&tensor.TDsize{X: 2, Y: 1, Z: 1}).Seed(1).Dense(1, WithBias()).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Validation loss of the second training is greater than the best one of the first training
+	shifted := make([]*mat.Dense, len(targets))
+	for i := range targets {
+		shifted[i] = mat.NewDense(1, 1, []float64{targets[i].At(0, 0) + 2})
+	}
+	net.LP.SetBatchSize(1)
+	// Large learning rate makes loss oscillate, so the best epoch is not the last one
+	net.LP.SetEta(5)
+	weights := [][]*mat.Dense{}
+	snapshot := &CallbackFuncs{
+		EpochEnd: func(net *WholeNet, info EpochInfo) error {
+			weights = append(weights, net.snapshotParameters()[0])
+			return nil
+		},
+	}
+	es := NewEarlyStopping(100, 0)
+	for run := 0; run < 2; run++ {
+		weights = weights[:0]
+		validation := targets
+		if run == 1 {
+			validation = shifted
+		}
+		history, err := net.Fit(inputs, targets, &TrainOptions{Epochs: 6, ValidationData: inputs, ValidationDesired: validation, Callbacks: []Callback{snapshot, es}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if history.Stopped || es.StoppedEpoch != -1 {
+			t.Errorf("Run #%d: training should not be stopped", run)
+		}
+		// State of previous training is not carried over
+		bestEpoch := 0
+		for e, loss := range history.ValidationLoss() {
+			if loss < history.Epochs[bestEpoch].ValidationLoss {
+				bestEpoch = e
+			}
+		}
+		if es.BestEpoch != bestEpoch || es.BestLoss != history.Epochs[bestEpoch].ValidationLoss {
+			t.Errorf("Run #%d: best epoch should be %d with loss %f, but got %d with loss %f", run, bestEpoch, history.Epochs[bestEpoch].ValidationLoss, es.BestEpoch, es.BestLoss)
+			continue
+		}
+		// Parameters of the best epoch are restored after the last epoch too
+		parameters := net.snapshotParameters()[0]
+		for i := range parameters {
+			if !mat.Equal(parameters[i], weights[bestEpoch][i]) {
+				t.Errorf("Run #%d: parameters #%d of the best epoch #%d should be restored", run, i, bestEpoch)
+			}
+		}
+	}
+}
+
+func TestWrappedStopTraining(t *testing.T) {
+	inputs := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{0, 1}),
+		mat.NewDense(2, 1, []float64{1, 0}),
+	}
+	targets := []*mat.Dense{
+		mat.NewDense(1, 1, []float64{1}),
+		mat.NewDense(1, 1, []float64{0}),
+	}
+	net, err := NewSequential(&tensor.TDsize{X: 2, Y: 1, Z: 1}).Seed(1).Dense(1).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	net.LP.SetBatchSize(1)
+	callback := &CallbackFuncs{
+		BatchEnd: func(net *WholeNet, info BatchInfo) error {
+			if info.Batch == 1 {
+				return errors.Wrap(ErrStopTraining, "Enough")
+			}
+			return nil
+		},
+	}
+	history, err := net.Fit(inputs, targets, &TrainOptions{Epochs: 5, Callbacks: []Callback{callback}})
+	if err != nil {
+		t.Errorf("Wrapped ErrStopTraining should stop training without error, but got %s", err.Error())
+		return
+	}
+	if !history.Stopped || len(history.Epochs) != 0 {
+		t.Errorf("Training should be stopped in first epoch, but got %d finished epochs (stopped: %v)", len(history.Epochs), history.Stopped)
+	}
+}
@@ -0,0 +1,320 @@
+package cnns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Checkpoint Full state of training: network with weights, optimizer's states, position in training data and state of source of randomness
+/*
+	Net - network structure, weights and learning parameters (the same as ExportToFile() saves)
+	OptimizerStates - optimizer's states of every layer (empty for layers without parameters)
+	Epoch - number of finished epochs
+	Order - order of training samples for last finished epoch (next epoch shuffles it)
+	Random - state of net's source of randomness (nil if source has not been set by SetSeed() or Sequential.Seed()).
+		Random layers are seeded from it for every sample of mini-batch, so their sources of randomness are not saved (see CalculateBatchGradients())
+	History - history of finished epochs
+	Callbacks - states of callbacks in order of TrainOptions.Callbacks (e.g. wait counter and the best weights of EarlyStopping), null for callbacks without state.
+		It is empty if there are no callbacks with state. Otherwise training should be resumed with the same callbacks
+*/
+type Checkpoint struct {
+	Net             *NetJSON                `json:"net"`
+	OptimizerStates [][]*OptimizerStateJSON `json:"optimizer_states"`
+	Epoch           int                     `json:"epoch"`
+	Order           []int                   `json:"order"`
+	Random          *RandomStateJSON        `json:"random,omitempty"`
+	History         *History                `json:"history,omitempty"`
+	Callbacks       []json.RawMessage       `json:"callbacks,omitempty"`
+}
+
+// OptimizerStateJSON JSON representation of optimizer's state
+type OptimizerStateJSON struct {
+	Rows     int       `json:"rows"`
+	Cols     int       `json:"cols"`
+	Velocity []float64 `json:"velocity,omitempty"`
+	Cache    []float64 `json:"cache,omitempty"`
+	Step     int       `json:"step"`
+}
+
+// RandomStateJSON JSON representation of source of randomness: seed and number of draws (source is restored in constant time, see countingSource)
+type RandomStateJSON struct {
+	Seed  int64  `json:"seed"`
+	Draws uint64 `json:"draws"`
+}
+
+// optimizedLayer Layer with optimizer's states
+type optimizedLayer interface {
+	// optimizerStates Returns optimizer's states of layer (not copies)
+	optimizerStates() []*OptimizerState
+}
+
+// deprecatedStatesLayer Layer which keeps deprecated references to optimizer's states (for backward compatibility)
+type deprecatedStatesLayer interface {
+	// syncDeprecatedStates Points deprecated fields to actual optimizer's states
+	syncDeprecatedStates()
+}
+
+// statefulCallback Callback with state which is saved in checkpoints, so resumed training behaves the same way as uninterrupted one
+type statefulCallback interface {
+	// checkpointState Returns JSON representation of callback's state
+	checkpointState() (json.RawMessage, error)
+	// restoreCheckpointState Restore callback's state from its JSON representation
+	restoreCheckpointState(data json.RawMessage) error
+}
+
+// copyNestedData Returns copy of JSON representation of matrix (shape is copied also)
+func copyNestedData(data *NestedData) *NestedData {
+	if data == nil {
+		return nil
+	}
+	ans := &NestedData{Data: append([]float64{}, data.Data...)}
+	if data.Shape != nil {
+		ans.Shape = append([]int{}, data.Shape...)
+	}
+	return ans
+}
+
+// optimizerStateToJSON Prepare JSON representation of optimizer's state
+func optimizerStateToJSON(state *OptimizerState) *OptimizerStateJSON {
+	ans := &OptimizerStateJSON{
+		Step: state.Step,
+	}
+	if state.Velocity != nil && !state.Velocity.IsEmpty() {
+		ans.Rows, ans.Cols = state.Velocity.Dims()
+		ans.Velocity = mat.DenseCopyOf(state.Velocity).RawMatrix().Data
+	}
+	if state.Cache != nil && !state.Cache.IsEmpty() {
+		ans.Rows, ans.Cols = state.Cache.Dims()
+		ans.Cache = mat.DenseCopyOf(state.Cache).RawMatrix().Data
+	}
+	return ans
+}
+
+// optimizerStateFromJSON Restore optimizer's state from its JSON representation
+func optimizerStateFromJSON(data *OptimizerStateJSON) (*OptimizerState, error) {
+	state := &OptimizerState{
+		Step: data.Step,
+	}
+	if len(data.Velocity) > 0 {
+		if len(data.Velocity) != data.Rows*data.Cols {
+			return nil, errors.Wrap(ErrDimensionsAreNotEqual, "Can't restore velocity of optimizer's state")
+		}
+		state.Velocity = mat.NewDense(data.Rows, data.Cols, data.Velocity)
+	}
+	if len(data.Cache) > 0 {
+		if len(data.Cache) != data.Rows*data.Cols {
+			return nil, errors.Wrap(ErrDimensionsAreNotEqual, "Can't restore cache of optimizer's state")
+		}
+		state.Cache = mat.NewDense(data.Rows, data.Cols, data.Cache)
+	}
+	return state, nil
+}
+
+// newCheckpoint Capture full state of training
+/*
+	epoch - number of finished epochs
+	order - order of training samples for last finished epoch
+	history - history of finished epochs
+	callbacks - callbacks of training (states of ones which implement statefulCallback are saved)
+*/
+func (wh *WholeNet) newCheckpoint(epoch int, order []int, history *History, callbacks []Callback) (*Checkpoint, error) {
+	netJSON, err := wh.toJSON(true)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't prepare checkpoint")
+	}
+	// Weights in JSON representation refer to layers' data, so they should be copied (layers continue training)
+	for _, layer := range netJSON.Network.Layers {
+		for w := range layer.Weights {
+			layer.Weights[w] = copyNestedData(layer.Weights[w])
+		}
+		layer.Biases = copyNestedData(layer.Biases)
+	}
+	checkpoint := &Checkpoint{
+		Net:             netJSON,
+		OptimizerStates: make([][]*OptimizerStateJSON, len(wh.Layers)),
+		Epoch:           epoch,
+		Order:           append([]int{}, order...),
+	}
+	for l := range wh.Layers {
+		checkpoint.OptimizerStates[l] = []*OptimizerStateJSON{}
+		layer, ok := wh.Layers[l].(optimizedLayer)
+		if !ok {
+			continue
+		}
+		for _, state := range layer.optimizerStates() {
+			checkpoint.OptimizerStates[l] = append(checkpoint.OptimizerStates[l], optimizerStateToJSON(state))
+		}
+	}
+	if wh.randSource != nil {
+		checkpoint.Random = &RandomStateJSON{
+			Seed:  wh.randSource.seed,
+			Draws: wh.randSource.draws,
+		}
+	}
+	if history != nil {
+		checkpoint.History = &History{
+			Epochs:  append([]EpochInfo{}, history.Epochs...),
+			Stopped: history.Stopped,
+		}
+	}
+	// States are saved only if some callback has state, so checkpoint can be resumed with any stateless callbacks
+	for i := range callbacks {
+		callback, ok := callbacks[i].(statefulCallback)
+		if !ok {
+			continue
+		}
+		if checkpoint.Callbacks == nil {
+			checkpoint.Callbacks = make([]json.RawMessage, len(callbacks))
+		}
+		checkpoint.Callbacks[i], err = callback.checkpointState()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't save state of callback #%d to checkpoint", i)
+		}
+	}
+	return checkpoint, nil
+}
+
+// restoreCallbacks Restore states of callbacks from checkpoint (checkpoints without states of callbacks are skipped)
+func (checkpoint *Checkpoint) restoreCallbacks(callbacks []Callback) error {
+	if len(checkpoint.Callbacks) == 0 {
+		return nil
+	}
+	if len(checkpoint.Callbacks) != len(callbacks) {
+		return fmt.Errorf("Checkpoint has states of %d callbacks, but there are %d callbacks", len(checkpoint.Callbacks), len(callbacks))
+	}
+	for i := range callbacks {
+		callback, ok := callbacks[i].(statefulCallback)
+		if !ok {
+			continue
+		}
+		data := checkpoint.Callbacks[i]
+		if len(data) == 0 || string(data) == "null" {
+			return fmt.Errorf("Checkpoint has no state of callback #%d", i)
+		}
+		err := callback.restoreCheckpointState(data)
+		if err != nil {
+			return errors.Wrapf(err, "Can't restore state of callback #%d from checkpoint", i)
+		}
+	}
+	return nil
+}
+
+// SaveToFile Save checkpoint to JSON file. Existing file is replaced only if checkpoint has been written successfully (see writeFileAtomic())
+func (checkpoint *Checkpoint) SaveToFile(fname string) error {
+	err := writeFileAtomic(fname, func(w io.Writer) error {
+		_, err := checkpoint.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Can't write checkpoint to file '%s'", fname))
+	}
+	return nil
+}
+
+// WriteTo Write checkpoint as JSON to writer. It implements io.WriterTo
+func (checkpoint *Checkpoint) WriteTo(w io.Writer) (int64, error) {
+	saveJSON, err := json.Marshal(checkpoint)
+	if err != nil {
+		return 0, errors.Wrap(err, "Can't marshal checkpoint to JSON")
+	}
+	n, err := w.Write(saveJSON)
+	if err != nil {
+		return int64(n), errors.Wrap(err, "Can't write checkpoint")
+	}
+	return int64(n), nil
+}
+
+// LoadCheckpoint Load checkpoint from JSON file (see TrainOptions.CheckpointFile)
+func LoadCheckpoint(fname string) (*Checkpoint, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadCheckpoint(file)
+}
+
+// ReadCheckpoint Load checkpoint from JSON provided by reader. Reader is read until EOF
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	dataBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't read checkpoint")
+	}
+	checkpoint := &Checkpoint{}
+	err = json.Unmarshal(dataBytes, checkpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't unmarshal checkpoint")
+	}
+	return checkpoint, nil
+}
+
+// RestoreCheckpoint Restore network from checkpoint: layers with weights, learning parameters, loss function, optimizer's states and state of source of randomness.
+// Existing layers of network are replaced. Pass the same checkpoint to Fit() via TrainOptions.Resume to continue training:
+/*
+	checkpoint, err := cnns.LoadCheckpoint("checkpoint.json")
+	net := &cnns.WholeNet{}
+	err = net.RestoreCheckpoint(checkpoint)
+	history, err := net.Fit(inputs, desired, &cnns.TrainOptions{Epochs: 20, Resume: checkpoint})
+*/
+func (wh *WholeNet) RestoreCheckpoint(checkpoint *Checkpoint) error {
+	if checkpoint == nil || checkpoint.Net == nil {
+		return fmt.Errorf("Checkpoint is empty")
+	}
+	// Network is restored separately, so existing one is kept untouched if checkpoint is not valid
+	restored := &WholeNet{}
+	if wh.LP != nil {
+		lp := *wh.LP
+		restored.LP = &lp
+	}
+	err := restored.fromJSON(checkpoint.Net, false)
+	if err != nil {
+		return errors.Wrap(err, "Can't restore network from checkpoint")
+	}
+	if len(checkpoint.OptimizerStates) != len(restored.Layers) {
+		return fmt.Errorf("Checkpoint has optimizer's states for %d layers, but network has %d layers", len(checkpoint.OptimizerStates), len(restored.Layers))
+	}
+	for l := range restored.Layers {
+		layer, ok := restored.Layers[l].(optimizedLayer)
+		if !ok {
+			continue
+		}
+		states := layer.optimizerStates()
+		if len(states) != len(checkpoint.OptimizerStates[l]) {
+			return fmt.Errorf("Checkpoint has %d optimizer's states for layer #%d, but layer has %d", len(checkpoint.OptimizerStates[l]), l, len(states))
+		}
+		for i := range states {
+			state, err := optimizerStateFromJSON(checkpoint.OptimizerStates[l][i])
+			if err != nil {
+				return errors.Wrapf(err, "Can't restore optimizer's state #%d of layer #%d", i, l)
+			}
+			// States are referenced by layers, so they are updated in-place
+			*states[i] = *state
+		}
+		if deprecated, ok := restored.Layers[l].(deprecatedStatesLayer); ok {
+			deprecated.syncDeprecatedStates()
+		}
+	}
+
+	wh.Layers = restored.Layers
+	if wh.LP == nil {
+		wh.LP = restored.LP
+	} else {
+		*wh.LP = *restored.LP
+	}
+	wh.Loss = restored.Loss
+	if checkpoint.Random != nil {
+		wh.randSource = restoreCountingSource(checkpoint.Random.Seed, checkpoint.Random.Draws)
+		wh.setRand(rand.New(wh.randSource))
+	} else {
+		// Layers are new, so they get net's source of randomness
+		wh.setRand(wh.rand)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package cnns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	for _, workersNum := range []int{1, 3} {
+		t.Run(fmt.Sprintf("workers=%d", workersNum), func(t *testing.T) {
+			testCheckpointResume(t, workersNum)
+		})
+	}
+}
+
+// testCheckpointResume Compare uninterrupted training and training resumed from checkpoint (dropout layers are seeded from net's source, so they are restored also)
+func testCheckpointResume(t *testing.T, workersNum int) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	checkpointFile := filepath.Join(dir, "checkpoint.json")
+	bestFile := filepath.Join(dir, "best.json")
+
+	r := rand.New(rand.NewSource(11))
+	inputs := make([]*mat.Dense, 12)
+	targets := make([]*mat.Dense, len(inputs))
+	for i := range inputs {
+		inputs[i] = mat.NewDense(12, 6, nil)
+		for j := range inputs[i].RawMatrix().Data {
+			inputs[i].RawMatrix().Data[j] = r.Float64()
+		}
+		targets[i] = mat.NewDense(3, 1, nil)
+		targets[i].Set(i%3, 0, 1)
+	}
+	build := func() *WholeNet {
+		layersRand := rand.New(rand.NewSource(1))
+		net, err := NewSequential(&tensor.TDsize{X: 6, Y: 6, Z: 2}).
+			Conv(3, 2, 1, WithBias(), WithRand(layersRand)).
+			BatchNorm("channel").
+			PReLU().
+			Dropout(0.2).
+			Dense(3, WithBias(), WithRand(layersRand)).
+			Softmax().
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		net.LP.SetBatchSize(5)
+		net.LP.Optimizer = NewOptimizerAdam()
+		net.Loss = NewLossCategoricalCrossEntropy()
+		net.SetSeed(5)
+		return net
+	}
+
+	// Uninterrupted training
+	full := build()
+	fullStopping := NewEarlyStopping(10, 0)
+	fullHistory, err := full.Fit(inputs, targets, &TrainOptions{Epochs: 6, Workers: workersNum, ValidationData: inputs[:4], ValidationDesired: targets[:4], Callbacks: []Callback{fullStopping}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Training is interrupted after 3 epochs
+	interrupted := build()
+	stop := &CallbackFuncs{
+		EpochEnd: func(net *WholeNet, info EpochInfo) error {
+			if info.Epoch == 2 {
+				return ErrStopTraining
+			}
+			return nil
+		},
+	}
+	_, err = interrupted.Fit(inputs, targets, &TrainOptions{
+		Epochs:             6,
+		Workers:            workersNum,
+		ValidationData:     inputs[:4],
+		ValidationDesired:  targets[:4],
+		Callbacks:          []Callback{NewEarlyStopping(10, 0), stop},
+		CheckpointFile:     checkpointFile,
+		CheckpointEvery:    3,
+		CheckpointBestFile: bestFile,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkpoint, err := LoadCheckpoint(checkpointFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if checkpoint.Epoch != 3 || len(checkpoint.History.Epochs) != 3 || checkpoint.Random == nil {
+		t.Errorf("Checkpoint should be made after 3 epochs, but got epoch %d", checkpoint.Epoch)
+		return
+	}
+	best, err := LoadCheckpoint(bestFile)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	bestEpoch := 0
+	for e, info := range checkpoint.History.Epochs {
+		if info.ValidationLoss < checkpoint.History.Epochs[bestEpoch].ValidationLoss {
+			bestEpoch = e
+		}
+	}
+	if best.Epoch != bestEpoch+1 {
+		t.Errorf("Best checkpoint should be made after %d epochs, but got %d", bestEpoch+1, best.Epoch)
+	}
+
+	// Resume training in fresh net
+	resumed := &WholeNet{}
+	err = resumed.RestoreCheckpoint(checkpoint)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// State of early stopping is restored from checkpoint
+	resumedStopping := NewEarlyStopping(10, 0)
+	resumedHistory, err := resumed.Fit(inputs, targets, &TrainOptions{Epochs: 6, Workers: workersNum, ValidationData: inputs[:4], ValidationDesired: targets[:4], Callbacks: []Callback{resumedStopping, stop}, Resume: checkpoint})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(resumedHistory.Epochs) != len(fullHistory.Epochs) {
+		t.Errorf("Resumed history should have %d epochs, but got %d", len(fullHistory.Epochs), len(resumedHistory.Epochs))
+		return
+	}
+	for e := range fullHistory.Epochs {
+		if fullHistory.Epochs[e].TrainLoss != resumedHistory.Epochs[e].TrainLoss || fullHistory.Epochs[e].ValidationLoss != resumedHistory.Epochs[e].ValidationLoss {
+			t.Errorf("Losses of epoch #%d should be %f and %f, but got %f and %f", e, fullHistory.Epochs[e].TrainLoss, fullHistory.Epochs[e].ValidationLoss, resumedHistory.Epochs[e].TrainLoss, resumedHistory.Epochs[e].ValidationLoss)
+		}
+	}
+	for l := range full.Layers {
+		fullLayer, ok := full.Layers[l].(parametersLayer)
+		if !ok {
+			continue
+		}
+		fullParameters := fullLayer.trainableParameters()
+		resumedParameters := resumed.Layers[l].(parametersLayer).trainableParameters()
+		for i := range fullParameters {
+			if !mat.Equal(fullParameters[i], resumedParameters[i]) {
+				t.Errorf("Parameters #%d of layer #%d should be bit-identical after resuming", i, l)
+			}
+		}
+	}
+	if fullStopping.BestEpoch != resumedStopping.BestEpoch || fullStopping.BestLoss != resumedStopping.BestLoss || fullStopping.wait != resumedStopping.wait {
+		t.Errorf("State of early stopping should be the same after resuming: best epoch %d (%f), wait %d, but got %d (%f), wait %d", fullStopping.BestEpoch, fullStopping.BestLoss, fullStopping.wait, resumedStopping.BestEpoch, resumedStopping.BestLoss, resumedStopping.wait)
+	}
+	for l := range fullStopping.bestWeights {
+		for i := range fullStopping.bestWeights[l] {
+			if !mat.Equal(fullStopping.bestWeights[l][i], resumedStopping.bestWeights[l][i]) {
+				t.Errorf("The best parameters #%d of layer #%d of early stopping should be the same after resuming", i, l)
+			}
+		}
+	}
+	// Deprecated fields still reference restored momentum buffers
+	conv := resumed.Layers[0].(*ConvLayer)
+	fc := resumed.Layers[4].(*FullyConnectedLayer)
+	if conv.PreviousDeltaKernelsState[1] != conv.KernelsState[1].Velocity || fc.PreviousWeightsState != fc.WeightsState.Velocity {
+		t.Errorf("Deprecated PreviousDeltaKernelsState and PreviousWeightsState should reference velocities of optimizer's states")
+	}
+}
+
+func TestCountingSourceRestore(t *testing.T) {
+	src := newCountingSource(42)
+	r := rand.New(src)
+	for i := 0; i < 1000; i++ {
+		r.Float64()
+	}
+	restored := rand.New(restoreCountingSource(src.seed, src.draws))
+	for i := 0; i < 100; i++ {
+		if v, restoredV := r.Int63(), restored.Int63(); v != restoredV {
+			t.Errorf("Value #%d of restored source should be %d, but got %d", i, v, restoredV)
+			return
+		}
+	}
+}
+
+func TestRestoreCheckpointKeepsNetOnError(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}).
+		Conv(3, 2, 1, WithRand(rand.New(rand.NewSource(1)))).
+		Dense(2, WithRand(rand.New(rand.NewSource(2)))).
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkpoint, err := net.newCheckpoint(1, []int{0}, nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Weights are copied with their shapes
+	for l, layer := range checkpoint.Net.Network.Layers {
+		for w := range layer.Weights {
+			if len(layer.Weights[w].Shape) != 2 {
+				t.Errorf("Weights #%d of layer #%d should have shape, but got %v", w, l, layer.Weights[w].Shape)
+			}
+		}
+	}
+
+	restored, err := NewSequential(&tensor.TDsize{X: 3, Y: 1, Z: 1}).Dense(1).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	layers := append([]Layer{}, restored.Layers...)
+	checkpoint.OptimizerStates = checkpoint.OptimizerStates[:1]
+	err = restored.RestoreCheckpoint(checkpoint)
+	if err == nil {
+		t.Error("Checkpoint with optimizer's states for single layer should cause error")
+	}
+	if len(restored.Layers) != len(layers) || restored.Layers[0] != layers[0] {
+		t.Errorf("Layers of network should be kept if checkpoint is not valid")
+	}
+}
@@ -2,34 +2,79 @@ package cnns
 
 import (
 	"fmt"
-	"math/rand"
+	"strings"
 
 	"github.com/LdDl/cnns/tensor"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/mat"
 )
 
+type paddingMode int
+
+const (
+	paddingZERO = iota + 1
+	paddingEDGE
+	paddingREFLECT
+)
+
+func (pm paddingMode) String() string {
+	switch pm {
+	case paddingZERO:
+		return "zero"
+	case paddingEDGE:
+		return "edge"
+	case paddingREFLECT:
+		return "reflect"
+	default:
+		return fmt.Sprintf("Padding mode #%d is not defined", pm)
+	}
+}
+
 // ConvLayer Convolutional layer structure
 // Oj - O{j}, activated output from previous layer for j-th neuron (in other words: previous summation input)
 // Ok - O{k}, activated output from current layer for k-th node (in other words: activated summation input)
 // SumInput - non-activated output for current layer for k-th node (in other words: summation input)
+// Kernels - kernel for each filter: (KernelSize*Z) x KernelSize matrix with channels of kernel stacked vertically (Z - number of input channels)
+// KernelsState - optimizer's state for each kernel
+// KernelsGradients - gradients for each kernel accumulated over mini-batch (they are applied in UpdateWeights())
+// Biases - bias for each kernel (filter), nil if layer has no biases
+// BiasesState - optimizer's state for biases
+// BiasesGradients - gradients for biases accumulated over mini-batch
+// Padding - number of rows and columns added on each side of every input channel
+// PaddingMode - how padded values are filled (zero/edge/reflect)
+// PreviousDeltaKernelsState - Deprecated: use KernelsState[f].Velocity (they are the same matrices)
 type ConvLayer struct {
-	Oj                        *mat.Dense
-	Ok                        *mat.Dense
-	Kernels                   []*mat.Dense
+	Oj           *mat.Dense
+	Ok           *mat.Dense
+	Kernels      []*mat.Dense
+	KernelsState []*OptimizerState
+
+	// Deprecated: use KernelsState[f].Velocity
 	PreviousDeltaKernelsState []*mat.Dense
 
+	KernelsGradients []*mat.Dense
+
+	Biases          *mat.Dense
+	BiasesState     *OptimizerState
+	BiasesGradients *mat.Dense
+
 	LocalDeltas        []*mat.Dense
 	NextDeltaWeightSum *mat.Dense
 
-	Stride     int
-	KernelSize int
+	Stride      int
+	KernelSize  int
+	Padding     int
+	PaddingMode paddingMode
 
 	OutputSize *tensor.TDsize
 	inputSize  *tensor.TDsize
 
-	inChannels int
-	trainMode  bool
+	paddedOj           *mat.Dense
+	inChannels         int
+	accumulatedSamples int
+	trainMode          bool
+	// Error of configuration which is reported by FeedForward() and CalculateGradients() (e.g. padding 'same' for even kernel size)
+	configurationErr error
 }
 
 // NewConvLayer Constructor for convolutional layer. You need to specify striding step, size (square) of kernel, amount of kernels, input size.
@@ -38,60 +83,115 @@ type ConvLayer struct {
 	stride - step on convolve operation
 	kernelSize - width==height of kernel
 	numberFilters - number of kernels
+	options - optional parameters (e.g. WithBias(), WithPadding(), WithPaddingSize(), WithPaddingMode(), WithInitializer(), WithRand())
+
+	Padding "same" is (kernelSize - 1) / 2 on each side, so it is supported for odd kernel size only (see WithPadding()).
+	Constructor can't return error, so FeedForward() and CalculateGradients() return ErrInvalidLayerConfiguration for even kernel size or unknown padding
+	(Sequential.Conv() reports it while building net)
+	Reflect padding needs padding less than width and height of input, otherwise edge padding is used
 */
-func NewConvLayer(inSize *tensor.TDsize, stride, kernelSize, numberFilters int) Layer {
-	newLayer := &ConvLayer{
-		inputSize:                 inSize,
-		Stride:                    stride,
-		KernelSize:                kernelSize,
-		Oj:                        mat.NewDense(inSize.Z*inSize.X, inSize.Y, nil),
-		Ok:                        mat.NewDense(numberFilters*((inSize.X-kernelSize)/stride+1), (inSize.Y-kernelSize)/stride+1, nil),
-		Kernels:                   make([]*mat.Dense, numberFilters),
-		PreviousDeltaKernelsState: make([]*mat.Dense, numberFilters),
-		LocalDeltas:               make([]*mat.Dense, numberFilters),
-		NextDeltaWeightSum:        &mat.Dense{},
-		OutputSize:                &tensor.TDsize{X: (inSize.X-kernelSize)/stride + 1, Y: (inSize.Y-kernelSize)/stride + 1, Z: numberFilters},
-		inChannels:                inSize.Z,
-		trainMode:                 false,
+func NewConvLayer(inSize *tensor.TDsize, stride, kernelSize, numberFilters int, options ...LayerOption) Layer {
+	opts := newLayerOptions(options...)
+	padding := opts.padding
+	var configurationErr error
+	if opts.unknownPadding != "" {
+		configurationErr = errors.Wrapf(ErrInvalidLayerConfiguration, "padding '%s' is not supported. Use 'valid' or 'same'", opts.unknownPadding)
 	}
-	for f := 0; f < numberFilters; f++ {
-		if inSize.Z == 1 {
-			newLayer.Kernels[f] = mat.NewDense(kernelSize, kernelSize, nil)
-			for i := 0; i < kernelSize; i++ {
-				for h := 0; h < kernelSize; h++ {
-					newLayer.Kernels[f].Set(i, h, rand.Float64()-0.5)
-				}
-			}
-			newLayer.PreviousDeltaKernelsState[f] = mat.NewDense(kernelSize, kernelSize, nil)
-			newLayer.PreviousDeltaKernelsState[f].Zero()
-			continue
+	if opts.samePadding {
+		if kernelSize%2 == 0 {
+			configurationErr = errors.Wrapf(ErrInvalidLayerConfiguration, "padding 'same' is not supported for even kernel size %d", kernelSize)
 		}
-		newLayer.Kernels[f] = mat.NewDense(kernelSize*kernelSize, inSize.Z, nil)
-		for i := 0; i < kernelSize*kernelSize; i++ {
-			for h := 0; h < inSize.Z; h++ {
-				newLayer.Kernels[f].Set(i, h, rand.Float64()-0.5)
-			}
+		padding = (kernelSize - 1) / 2
+	}
+	outX := (inSize.X+2*padding-kernelSize)/stride + 1
+	outY := (inSize.Y+2*padding-kernelSize)/stride + 1
+	newLayer := &ConvLayer{
+		inputSize:          inSize,
+		Stride:             stride,
+		KernelSize:         kernelSize,
+		Padding:            padding,
+		Oj:                 mat.NewDense(inSize.Z*inSize.X, inSize.Y, nil),
+		Ok:                 mat.NewDense(numberFilters*outX, outY, nil),
+		Kernels:            make([]*mat.Dense, numberFilters),
+		KernelsState:       make([]*OptimizerState, numberFilters),
+		KernelsGradients:   make([]*mat.Dense, numberFilters),
+		LocalDeltas:        make([]*mat.Dense, numberFilters),
+		NextDeltaWeightSum: &mat.Dense{},
+		OutputSize:         &tensor.TDsize{X: outX, Y: outY, Z: numberFilters},
+		inChannels:         inSize.Z,
+		trainMode:          false,
+		configurationErr:   configurationErr,
+	}
+	switch strings.ToLower(opts.paddingMode) {
+	case "zero":
+		newLayer.PaddingMode = paddingZERO
+		break
+	case "edge":
+		newLayer.PaddingMode = paddingEDGE
+		break
+	case "reflect":
+		newLayer.PaddingMode = paddingREFLECT
+		if padding >= inSize.X || padding >= inSize.Y {
+			fmt.Printf("Warning: reflect padding %d should be less than input size %dx%d. Using 'edge' padding mode\n", padding, inSize.X, inSize.Y)
+			newLayer.PaddingMode = paddingEDGE
 		}
-		newLayer.PreviousDeltaKernelsState[f] = mat.NewDense(kernelSize*kernelSize, inSize.Z, nil)
-		newLayer.PreviousDeltaKernelsState[f].Zero()
+		break
+	default:
+		fmt.Printf("Warning: padding mode '%s' for convolutional layer is not supported. Use 'zero', 'edge' or 'reflect'\n", opts.paddingMode)
+		newLayer.PaddingMode = paddingZERO
+		break
+	}
+	fanIn := kernelSize * kernelSize * inSize.Z
+	fanOut := kernelSize * kernelSize * numberFilters
+	for f := 0; f < numberFilters; f++ {
+		// Channels of kernel are stacked vertically (the same way as channels of input), see ExtractChannel()
+		newLayer.Kernels[f] = mat.NewDense(kernelSize*inSize.Z, kernelSize, nil)
+		opts.initializer.Init(newLayer.Kernels[f], fanIn, fanOut, opts.rand)
+		newLayer.KernelsState[f] = NewOptimizerState(kernelSize*inSize.Z, kernelSize)
+		newLayer.KernelsGradients[f] = mat.NewDense(kernelSize*inSize.Z, kernelSize, nil)
+	}
+	newLayer.syncDeprecatedStates()
+	if opts.useBias {
+		newLayer.enableBiases()
 	}
 	return newLayer
 }
 
+// enableBiases Initialize zero biases for convolutional layer
+func (conv *ConvLayer) enableBiases() {
+	conv.Biases = mat.NewDense(len(conv.Kernels), 1, nil)
+	conv.BiasesState = NewOptimizerState(len(conv.Kernels), 1)
+	conv.BiasesGradients = mat.NewDense(len(conv.Kernels), 1, nil)
+}
+
 // SetCustomWeights Set user's weights for convolutional layer (make it carefully)
 /*
-	kernels - slice of kernels
+	kernels - slice of kernels. Biases (numberFilters x 1) can be provided as additional last element, then they are enabled
 */
 func (conv *ConvLayer) SetCustomWeights(kernels []*mat.Dense) {
-	if len(conv.Kernels) != len(kernels) {
-		fmt.Println("Amount of custom filters has to be equal to layer's amount of filters. Skipping...")
+	if len(conv.Kernels) != len(kernels) && len(conv.Kernels)+1 != len(kernels) {
+		fmt.Println("Amount of custom filters has to be equal to layer's amount of filters (or amount of filters + 1 if biases are provided). Skipping...")
 		return
 	}
+	if len(kernels) == len(conv.Kernels)+1 {
+		conv.enableBiases()
+		conv.Biases.CloneFrom(kernels[len(kernels)-1])
+		kernels = kernels[:len(kernels)-1]
+	}
 	for i := range kernels {
 		conv.Kernels[i].CloneFrom(kernels[i])
 		tr, tc := kernels[i].Dims()
-		conv.PreviousDeltaKernelsState[i] = mat.NewDense(tr, tc, nil)
-		conv.PreviousDeltaKernelsState[i].Zero()
+		conv.KernelsState[i] = NewOptimizerState(tr, tc)
+		conv.KernelsGradients[i] = mat.NewDense(tr, tc, nil)
+	}
+	conv.syncDeprecatedStates()
+}
+
+// syncDeprecatedStates Points deprecated PreviousDeltaKernelsState to velocities of optimizer's states
+func (conv *ConvLayer) syncDeprecatedStates() {
+	conv.PreviousDeltaKernelsState = make([]*mat.Dense, len(conv.KernelsState))
+	for f := range conv.KernelsState {
+		conv.PreviousDeltaKernelsState[f] = conv.KernelsState[f].Velocity
 	}
 }
 
@@ -110,8 +210,13 @@ func (conv *ConvLayer) GetActivatedOutput() *mat.Dense {
 	return conv.Ok
 }
 
-// GetWeights Returns convolutional layer's weights.
+// GetWeights Returns convolutional layer's weights (biases are returned as additional last element if layer has them).
 func (conv *ConvLayer) GetWeights() []*mat.Dense {
+	if conv.Biases != nil {
+		weights := make([]*mat.Dense, 0, len(conv.Kernels)+1)
+		weights = append(weights, conv.Kernels...)
+		return append(weights, conv.Biases)
+	}
 	return conv.Kernels
 }
 
@@ -122,7 +227,11 @@ func (conv *ConvLayer) GetGradients() *mat.Dense {
 
 // FeedForward Feed data to convolutional layer
 func (conv *ConvLayer) FeedForward(input *mat.Dense) error {
+	if conv.configurationErr != nil {
+		return errors.Wrap(conv.configurationErr, "Can't call FeedForward() on convolutional layer")
+	}
 	conv.Oj = input
+	conv.paddedOj = conv.pad(input)
 	err := conv.doActivation()
 	if err != nil {
 		return errors.Wrap(err, "Can't call FeedForward() on convolutional layer")
@@ -130,14 +239,95 @@ func (conv *ConvLayer) FeedForward(input *mat.Dense) error {
 	return nil
 }
 
+// pad Apply padding to each channel of input
+func (conv *ConvLayer) pad(input *mat.Dense) *mat.Dense {
+	if conv.Padding == 0 {
+		return input
+	}
+	inputRows, inputCols := input.Dims()
+	stacked := &mat.Dense{}
+	for c := 0; c < conv.inChannels; c++ {
+		partialMatrix := ExtractChannel(input, inputRows, inputCols, conv.inChannels, c)
+		var padded *mat.Dense
+		switch conv.PaddingMode {
+		case paddingEDGE:
+			padded = ContoursPadding(partialMatrix, conv.Padding)
+			break
+		case paddingREFLECT:
+			padded = ReflectPadding(partialMatrix, conv.Padding)
+			break
+		default:
+			padded = ZeroPadding(partialMatrix, conv.Padding)
+			break
+		}
+		if stacked.IsEmpty() {
+			stacked = padded
+		} else {
+			t := &mat.Dense{}
+			t.Stack(stacked, padded)
+			stacked = t
+		}
+	}
+	return stacked
+}
+
+// dilate Insert (stride - 1) zero rows and columns between values of matrix (gradients of strided convolution are evaluated as gradients of convolution with stride 1)
+func dilate(matrix *mat.Dense, stride int) *mat.Dense {
+	if stride <= 1 {
+		return matrix
+	}
+	rows, cols := matrix.Dims()
+	dilated := mat.NewDense((rows-1)*stride+1, (cols-1)*stride+1, nil)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			dilated.Set(y*stride, x*stride, matrix.At(y, x))
+		}
+	}
+	return dilated
+}
+
+// unpad Map gradients with respect to padded input back to gradients with respect to input (for single channel)
+/*
+	Padded value is a copy of some input value (for edge and reflect modes), so its gradient is added to gradient of that value.
+	Gradients of zeroes (zero mode) are just dropped
+*/
+func (conv *ConvLayer) unpad(paddedGradients *mat.Dense, rows, cols int) *mat.Dense {
+	if conv.Padding == 0 {
+		return paddedGradients
+	}
+	gradients := mat.NewDense(rows, cols, nil)
+	paddedRows, paddedCols := paddedGradients.Dims()
+	for y := 0; y < paddedRows; y++ {
+		sourceY := paddingSourceIndex(y, rows, conv.Padding, conv.PaddingMode)
+		if sourceY < 0 {
+			continue
+		}
+		for x := 0; x < paddedCols; x++ {
+			sourceX := paddingSourceIndex(x, cols, conv.Padding, conv.PaddingMode)
+			if sourceX < 0 {
+				continue
+			}
+			gradients.Set(sourceY, sourceX, gradients.At(sourceY, sourceX)+paddedGradients.At(y, x))
+		}
+	}
+	return gradients
+}
+
 // doActivation Convolutional layer's output activation
 func (conv *ConvLayer) doActivation() error {
 	resultMatrix := &mat.Dense{}
 	for i := range conv.Kernels {
-		feature, err := Convolve2D(conv.Oj, conv.Kernels[i], conv.inChannels, conv.Stride)
+		feature, err := Convolve2D(conv.paddedOj, conv.Kernels[i], conv.inChannels, conv.Stride)
 		if err != nil {
 			return errors.Wrap(err, "Can't call doActivation() on Convolutional Layer")
 		}
+		if conv.Biases != nil {
+			bias := conv.Biases.At(i, 0)
+			rawFeature := feature.RawMatrix().Data
+			for j := range rawFeature {
+				rawFeature[j] += bias
+			}
+		}
 		if resultMatrix.IsEmpty() {
 			resultMatrix = feature
 		} else {
@@ -152,22 +342,32 @@ func (conv *ConvLayer) doActivation() error {
 
 // CalculateGradients Evaluate convolutional layer's gradients
 func (conv *ConvLayer) CalculateGradients(lossGradients *mat.Dense) error {
+	if conv.configurationErr != nil {
+		return errors.Wrap(conv.configurationErr, "Can't call CalculateGradients() on convolutional layer")
+	}
 
 	channels := conv.inChannels
 	features := conv.OutputSize.Z
 	errRows, errCols := lossGradients.Dims()
-	inputRows, inputCols := conv.Oj.Dims()
+	// Gradients for kernels are evaluated with respect to padded input
+	inputRows, inputCols := conv.paddedOj.Dims()
 
 	for f := 0; f < features; f++ {
 		partialErrors := ExtractChannel(lossGradients, errRows, errCols, features, f)
+		if conv.Biases != nil {
+			// ΔE/Δb = Σ(ΔE/ΔO) over feature map
+			conv.BiasesGradients.Set(f, 0, conv.BiasesGradients.At(f, 0)+mat.Sum(partialErrors))
+		}
 		channelsStack := &mat.Dense{}
 		for c := 0; c < channels; c++ {
-			partialMatrix := ExtractChannel(conv.Oj, inputRows, inputCols, channels, c)
-			// dL/dF = Convolution(Input, LossGradient dL/dO)
-			partialLocalDeltas, err := Convolve2D(partialMatrix, partialErrors, 1, conv.Stride)
+			partialMatrix := ExtractChannel(conv.paddedOj, inputRows, inputCols, channels, c)
+			// dL/dF = Convolution(Input, LossGradient dL/dO dilated by stride)
+			partialLocalDeltas, err := Convolve2D(partialMatrix, dilate(partialErrors, conv.Stride), 1, 1)
 			if err != nil {
 				return errors.Wrap(err, "Can't call CalculateGradients() while calculate Convolution(Input, LossGradient dL/dO)")
 			}
+			// Last rows and columns of input are not covered by kernel if stride does not divide (input - kernel)
+			partialLocalDeltas = mat.DenseCopyOf(partialLocalDeltas.Slice(0, conv.KernelSize, 0, conv.KernelSize))
 			if channelsStack.IsEmpty() {
 				channelsStack = partialLocalDeltas
 			} else {
@@ -177,15 +377,18 @@ func (conv *ConvLayer) CalculateGradients(lossGradients *mat.Dense) error {
 			}
 		}
 		conv.LocalDeltas[f] = channelsStack
+		// Accumulate gradients (they are applied in UpdateWeights())
+		conv.KernelsGradients[f].Add(conv.KernelsGradients[f], channelsStack)
 	}
+	conv.accumulatedSamples++
 
 	conv.NextDeltaWeightSum = &mat.Dense{}
 	for f := 0; f < features; f++ {
 
-		// Add padding for each incoming loss gradient
+		// Add padding for each incoming loss gradient (dilated by stride, so positions of gradients match positions of kernel on input)
 		partialErrors := ExtractChannel(lossGradients, errRows, errCols, features, f)
 
-		padded := ZeroPadding(partialErrors, conv.KernelSize-1)
+		padded := ZeroPadding(dilate(partialErrors, conv.Stride), conv.KernelSize-1)
 
 		// Rotate each kernel by 180 degrees and do full convolution
 		kernelR, kernelC := conv.Kernels[f].Dims()
@@ -195,10 +398,18 @@ func (conv *ConvLayer) CalculateGradients(lossGradients *mat.Dense) error {
 			partialRotatedKernel := Rot2D180(partialKernel)
 
 			// error = dL/dX = FullConvolution(LossGradient dL/dO, rot180(kernel))
-			dLdX, err := Convolve2D(padded, partialRotatedKernel, 1, conv.Stride)
+			dLdX, err := Convolve2D(padded, partialRotatedKernel, 1, 1)
 			if err != nil {
 				return errors.Wrap(err, "Can't call CalculateGradients() while calculate FullConvolution(LossGradient dL/dO, rot180(kernel))")
 			}
+			// Last rows and columns of input are not covered by kernel if stride does not divide (input - kernel), so their gradients are zero
+			if rows, cols := dLdX.Dims(); rows < inputRows/channels || cols < inputCols {
+				full := mat.NewDense(inputRows/channels, inputCols, nil)
+				full.Slice(0, rows, 0, cols).(*mat.Dense).Copy(dLdX)
+				dLdX = full
+			}
+			// Full convolution gives gradients with respect to padded input
+			dLdX = conv.unpad(dLdX, conv.inputSize.X, conv.inputSize.Y)
 
 			// Stack channels for each feature
 			if channelStacked.IsEmpty() {
@@ -223,31 +434,25 @@ func (conv *ConvLayer) CalculateGradients(lossGradients *mat.Dense) error {
 	return nil
 }
 
-// UpdateWeights Update convolutional layer's weights
+// UpdateWeights Update convolutional layer's weights (gradients are averaged over accumulated samples)
 func (conv *ConvLayer) UpdateWeights(lp *LearningParams) {
-	features := len(conv.Kernels)
-
-	for f := 0; f < features; f++ {
-		kernel := conv.Kernels[f]
-		previousDeltaWeights := conv.PreviousDeltaKernelsState[f]
-		partialErrors := conv.LocalDeltas[f]
-
+	if conv.accumulatedSamples == 0 {
+		return
+	}
+	for f := range conv.Kernels {
 		// Evaluate ΔΣ(k)/Δw{j}{k}
 		// In FC layer we do: Δw.Mul(fc.LocalDelta, fc.Oj.T()), but fc.Oj.T() = 1.0 in case of convolutional layer. So we can skip this step
-		Δw := &mat.Dense{}
-		Δw.Scale(-1.0*lp.LearningRate, partialErrors)
-
-		// Inertia (as separated Scale() call)
-		// @todo - this should be optional
-		Δw.Scale(1.0-lp.Momentum, Δw)
-
-		previousDeltaWeights.Scale(lp.Momentum, previousDeltaWeights)
-		Δw.Add(Δw, previousDeltaWeights)
-		conv.PreviousDeltaKernelsState[f].CloneFrom(Δw)
-
-		// Update weights: w = w + Δw
-		kernel.Add(kernel, Δw)
+		conv.KernelsGradients[f].Scale(1.0/float64(conv.accumulatedSamples), conv.KernelsGradients[f])
+		// Update weights: optimizer does w = w + Δw
+		lp.updateParameters(conv.Kernels[f], conv.KernelsGradients[f], conv.KernelsState[f], false)
+		conv.KernelsGradients[f].Zero()
+	}
+	if conv.Biases != nil {
+		conv.BiasesGradients.Scale(1.0/float64(conv.accumulatedSamples), conv.BiasesGradients)
+		lp.updateParameters(conv.Biases, conv.BiasesGradients, conv.BiasesState, true)
+		conv.BiasesGradients.Zero()
 	}
+	conv.accumulatedSamples = 0
 }
 
 // PrintOutput Pretty print convolutional layer's output
@@ -270,6 +475,9 @@ func (conv *ConvLayer) PrintWeights() {
 				fmt.Printf("\t\t%v\n", partialKernel.RawRowView(r))
 			}
 		}
+		if conv.Biases != nil {
+			fmt.Printf("\tBias: %v\n", conv.Biases.At(f, 0))
+		}
 	}
 }
 
@@ -290,7 +498,140 @@ func (conv *ConvLayer) GetType() string {
 	return "conv"
 }
 
+// SetTrainMode Switch convolutional layer to training (true) or inference (false) mode
+func (conv *ConvLayer) SetTrainMode(mode bool) {
+	conv.trainMode = mode
+}
+
 // GetStride Returns stride of layer
 func (conv *ConvLayer) GetStride() int {
 	return conv.Stride
 }
+
+// replicate Returns new convolutional layer with the same configuration and own buffers (see Predict() and CalculateBatchGradients()). Kernels are shared by shareParameters()
+func (conv *ConvLayer) replicate() Layer {
+	options := []LayerOption{
+		WithPaddingSize(conv.Padding),
+		WithPaddingMode(conv.PaddingMode.String()),
+		// Do not waste random numbers: kernels are replaced by shareParameters() anyway
+		WithInitializer(NewInitializerConstant(0)),
+	}
+	if conv.Biases != nil {
+		options = append(options, WithBias())
+	}
+	replica := NewConvLayer(conv.inputSize, conv.Stride, conv.KernelSize, len(conv.Kernels), options...).(*ConvLayer)
+	// Kernels could be replaced by SetCustomWeights(), so shapes are taken from actual kernels
+	for f := range conv.Kernels {
+		r, c := conv.Kernels[f].Dims()
+		replica.Kernels[f] = mat.NewDense(r, c, nil)
+		replica.KernelsGradients[f] = mat.NewDense(r, c, nil)
+	}
+	return replica
+}
+
+// mergeGradients Adds gradients accumulated by replica to layer's gradients and resets replica's ones
+func (conv *ConvLayer) mergeGradients(replica Layer) {
+	replicaConv := replica.(*ConvLayer)
+	for f := range conv.KernelsGradients {
+		conv.KernelsGradients[f].Add(conv.KernelsGradients[f], replicaConv.KernelsGradients[f])
+		replicaConv.KernelsGradients[f].Zero()
+	}
+	if conv.Biases != nil {
+		conv.BiasesGradients.Add(conv.BiasesGradients, replicaConv.BiasesGradients)
+		replicaConv.BiasesGradients.Zero()
+	}
+	conv.accumulatedSamples += replicaConv.accumulatedSamples
+	replicaConv.accumulatedSamples = 0
+}
+
+// shareParameters Makes replica use the same kernels (and biases) as layer (see Predict() and CalculateBatchGradients())
+func (conv *ConvLayer) shareParameters(replica Layer) {
+	replicaConv := replica.(*ConvLayer)
+	replicaConv.Kernels = conv.Kernels
+	replicaConv.Biases = conv.Biases
+}
+
+// predictBatch Evaluates outputs for several inputs at once in inference mode: patches of every input (im2col) are stacked into single matrix,
+// so all kernels are applied by one matrix multiplication. Layer is not modified (see PredictBatch())
+func (conv *ConvLayer) predictBatch(inputs []*mat.Dense) ([]*mat.Dense, error) {
+	if conv.configurationErr != nil {
+		return nil, errors.Wrap(conv.configurationErr, "Can't call predictBatch() on convolutional layer")
+	}
+	// Every input should be (X*Z) x Y matrix, since sizes of output and patches are evaluated once for whole batch
+	for n, input := range inputs {
+		rows, cols := input.Dims()
+		if rows != conv.inputSize.X*conv.inputSize.Z || cols != conv.inputSize.Y {
+			return nil, errors.Wrapf(ErrDimensionsAreNotEqual, "Can't call predictBatch() on convolutional layer for input #%d: it should be %dx%d, but got %dx%d", n, conv.inputSize.X*conv.inputSize.Z, conv.inputSize.Y, rows, cols)
+		}
+	}
+	channels := conv.inChannels
+	filters := len(conv.Kernels)
+	kernelR, kernelC := conv.Kernels[0].Dims()
+	partialR, partialC := kernelR/channels, kernelC
+	kernelLen := partialR * partialC
+	// Kernels as columns: every column holds flattened parts of kernel for each channel
+	kernels := mat.NewDense(channels*kernelLen, filters, nil)
+	for f := range conv.Kernels {
+		for c := 0; c < channels; c++ {
+			partialKernel := Flatten(ExtractChannel(conv.Kernels[f], kernelR, kernelC, channels, c)).RawMatrix().Data
+			for i, v := range partialKernel {
+				kernels.Set(c*kernelLen+i, f, v)
+			}
+		}
+	}
+	outRows, outCols := 0, 0
+	positions := 0
+	var patches *mat.Dense
+	for n, input := range inputs {
+		padded := conv.pad(input)
+		paddedR, paddedC := padded.Dims()
+		if n == 0 {
+			outRows = (paddedR/channels-partialR)/conv.Stride + 1
+			outCols = (paddedC-partialC)/conv.Stride + 1
+			positions = outRows * outCols
+			patches = mat.NewDense(len(inputs)*positions, channels*kernelLen, nil)
+		}
+		for c := 0; c < channels; c++ {
+			partialMatrix := ExtractChannel(padded, paddedR, paddedC, channels, c)
+			cols := Im2Col(partialMatrix, partialR, partialC, conv.Stride)
+			colsR, _ := cols.Dims()
+			if colsR != positions {
+				return nil, errors.Wrapf(ErrDimensionsAreNotEqual, "Can't call predictBatch() on convolutional layer for input #%d", n)
+			}
+			patches.Slice(n*positions, (n+1)*positions, c*kernelLen, (c+1)*kernelLen).(*mat.Dense).Copy(cols)
+		}
+	}
+	features := &mat.Dense{}
+	features.Mul(patches, kernels)
+	outputs := make([]*mat.Dense, len(inputs))
+	for n := range inputs {
+		raw := make([]float64, filters*positions)
+		for f := 0; f < filters; f++ {
+			bias := 0.0
+			if conv.Biases != nil {
+				bias = conv.Biases.At(f, 0)
+			}
+			for p := 0; p < positions; p++ {
+				raw[f*positions+p] = features.At(n*positions+p, f) + bias
+			}
+		}
+		outputs[n] = mat.NewDense(filters*outRows, outCols, raw)
+	}
+	return outputs, nil
+}
+
+// trainableParameters Returns kernels (and biases) of convolutional layer
+func (conv *ConvLayer) trainableParameters() []*mat.Dense {
+	if conv.Biases != nil {
+		return append(append([]*mat.Dense{}, conv.Kernels...), conv.Biases)
+	}
+	return append([]*mat.Dense{}, conv.Kernels...)
+}
+
+// optimizerStates Returns optimizer's states for kernels (and biases) of convolutional layer
+func (conv *ConvLayer) optimizerStates() []*OptimizerState {
+	if conv.Biases != nil {
+		return append(append([]*OptimizerState{}, conv.KernelsState...), conv.BiasesState)
+	}
+	return append([]*OptimizerState{}, conv.KernelsState...)
+}
@@ -1,9 +1,13 @@
 package cnns
 
 import (
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
 )
 
 func TestConvSize(t *testing.T) {
@@ -20,3 +24,278 @@ func TestConvSize(t *testing.T) {
 		t.Errorf("Z dimension should be of value %d, but got %d", correct.Z, outSize.Z)
 	}
 }
+
+func TestConvPaddingSize(t *testing.T) {
+	same := NewConvLayer(&tensor.TDsize{X: 9, Y: 8, Z: 1}, 1, 3, 2, WithPadding("same"))
+	if same.GetOutputSize().X != 9 || same.GetOutputSize().Y != 8 {
+		t.Errorf("Output size for 'same' padding should be 9x8, but got %dx%d", same.GetOutputSize().X, same.GetOutputSize().Y)
+	}
+	explicit := NewConvLayer(&tensor.TDsize{X: 9, Y: 8, Z: 1}, 2, 3, 2, WithPaddingSize(2))
+	if explicit.GetOutputSize().X != 6 || explicit.GetOutputSize().Y != 5 {
+		t.Errorf("Output size for padding 2 and stride 2 should be 6x5, but got %dx%d", explicit.GetOutputSize().X, explicit.GetOutputSize().Y)
+	}
+	// Invalid padding is reported by forward and backward passes
+	for _, conv := range []Layer{
+		NewConvLayer(&tensor.TDsize{X: 8, Y: 8, Z: 1}, 1, 2, 1, WithPadding("same")),
+		NewConvLayer(&tensor.TDsize{X: 8, Y: 8, Z: 1}, 1, 3, 1, WithPadding("full")),
+	} {
+		err := conv.FeedForward(mat.NewDense(8, 8, nil))
+		if errors.Cause(err) != ErrInvalidLayerConfiguration {
+			t.Errorf("FeedForward() should cause ErrInvalidLayerConfiguration, but got %v", err)
+		}
+		err = conv.CalculateGradients(mat.NewDense(8, 8, nil))
+		if errors.Cause(err) != ErrInvalidLayerConfiguration {
+			t.Errorf("CalculateGradients() should cause ErrInvalidLayerConfiguration, but got %v", err)
+		}
+	}
+}
+
+func TestReflectPadding(t *testing.T) {
+	matrix := mat.NewDense(3, 3, []float64{
+		1, 2, 3,
+		4, 5, 6,
+		7, 8, 9,
+	})
+	correct := mat.NewDense(5, 5, []float64{
+		5, 4, 5, 6, 5,
+		2, 1, 2, 3, 2,
+		5, 4, 5, 6, 5,
+		8, 7, 8, 9, 8,
+		5, 4, 5, 6, 5,
+	})
+	padded := ReflectPadding(matrix, 1)
+	if !mat.Equal(padded, correct) {
+		t.Errorf("Reflect padding should be %v, but got %v", correct.RawMatrix().Data, padded.RawMatrix().Data)
+	}
+}
+
+func TestConvPaddingGradients(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	input := mat.NewDense(5, 4, nil)
+	for i := range input.RawMatrix().Data {
+		input.RawMatrix().Data[i] = rnd.Float64() - 0.5
+	}
+	for _, mode := range []string{"zero", "edge", "reflect"} {
+		conv := NewConvLayer(&tensor.TDsize{X: 5, Y: 4, Z: 1}, 1, 3, 1, WithPadding("same"), WithPaddingMode(mode))
+		// Loss is Σ(w * O), so ΔE/ΔO = w
+		outputWeights := mat.NewDense(5, 4, nil)
+		for i := range outputWeights.RawMatrix().Data {
+			outputWeights.RawMatrix().Data[i] = rnd.Float64() - 0.5
+		}
+		loss := func() float64 {
+			err := conv.FeedForward(input)
+			if err != nil {
+				t.Error(err)
+			}
+			product := &mat.Dense{}
+			product.MulElem(conv.GetActivatedOutput(), outputWeights)
+			return mat.Sum(product)
+		}
+		loss()
+		err := conv.CalculateGradients(outputWeights)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		gradients := conv.GetGradients()
+		rows, cols := gradients.Dims()
+		if rows != 5 || cols != 4 {
+			t.Errorf("Gradients for '%s' padding should be 5x4, but got %dx%d", mode, rows, cols)
+			continue
+		}
+		// Numerical gradients
+		eps := 1e-6
+		for i := range input.RawMatrix().Data {
+			initial := input.RawMatrix().Data[i]
+			input.RawMatrix().Data[i] = initial + eps
+			plus := loss()
+			input.RawMatrix().Data[i] = initial - eps
+			minus := loss()
+			input.RawMatrix().Data[i] = initial
+			numerical := (plus - minus) / (2 * eps)
+			if math.Abs(numerical-gradients.RawMatrix().Data[i]) > 1e-6 {
+				t.Errorf("Gradient for '%s' padding in position %d should be %f, but got %f", mode, i, numerical, gradients.RawMatrix().Data[i])
+			}
+		}
+		kernel := conv.(*ConvLayer).Kernels[0]
+		kernelGradients := conv.(*ConvLayer).KernelsGradients[0]
+		for i := range kernel.RawMatrix().Data {
+			initial := kernel.RawMatrix().Data[i]
+			kernel.RawMatrix().Data[i] = initial + eps
+			plus := loss()
+			kernel.RawMatrix().Data[i] = initial - eps
+			minus := loss()
+			kernel.RawMatrix().Data[i] = initial
+			numerical := (plus - minus) / (2 * eps)
+			if math.Abs(numerical-kernelGradients.RawMatrix().Data[i]) > 1e-6 {
+				t.Errorf("Kernel gradient for '%s' padding in position %d should be %f, but got %f", mode, i, numerical, kernelGradients.RawMatrix().Data[i])
+			}
+		}
+	}
+}
+
+func TestConvStrideGradients(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	// 2 channels of 7x6 stacked vertically
+	input := mat.NewDense(14, 6, nil)
+	for i := range input.RawMatrix().Data {
+		input.RawMatrix().Data[i] = rnd.Float64() - 0.5
+	}
+	for _, padding := range []int{0, 1} {
+		conv := NewConvLayer(&tensor.TDsize{X: 7, Y: 6, Z: 2}, 2, 3, 2, WithPaddingSize(padding), WithPaddingMode("edge"), WithRand(rnd))
+		outSize := conv.GetOutputSize()
+		// Loss is Σ(w * O), so ΔE/ΔO = w
+		outputWeights := mat.NewDense(outSize.X*outSize.Z, outSize.Y, nil)
+		for i := range outputWeights.RawMatrix().Data {
+			outputWeights.RawMatrix().Data[i] = rnd.Float64() - 0.5
+		}
+		loss := func() float64 {
+			err := conv.FeedForward(input)
+			if err != nil {
+				t.Error(err)
+			}
+			product := &mat.Dense{}
+			product.MulElem(conv.GetActivatedOutput(), outputWeights)
+			return mat.Sum(product)
+		}
+		loss()
+		err := conv.CalculateGradients(outputWeights)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		gradients := conv.GetGradients()
+		rows, cols := gradients.Dims()
+		if rows != 14 || cols != 6 {
+			t.Errorf("Gradients for padding %d should be 14x6, but got %dx%d", padding, rows, cols)
+			continue
+		}
+		eps := 1e-6
+		for i := range input.RawMatrix().Data {
+			initial := input.RawMatrix().Data[i]
+			input.RawMatrix().Data[i] = initial + eps
+			plus := loss()
+			input.RawMatrix().Data[i] = initial - eps
+			minus := loss()
+			input.RawMatrix().Data[i] = initial
+			numerical := (plus - minus) / (2 * eps)
+			if math.Abs(numerical-gradients.RawMatrix().Data[i]) > 1e-6 {
+				t.Errorf("Gradient for padding %d and stride 2 in position %d should be %f, but got %f", padding, i, numerical, gradients.RawMatrix().Data[i])
+			}
+		}
+		for f, kernel := range conv.(*ConvLayer).Kernels {
+			kernelGradients := conv.(*ConvLayer).KernelsGradients[f]
+			for i := range kernel.RawMatrix().Data {
+				initial := kernel.RawMatrix().Data[i]
+				kernel.RawMatrix().Data[i] = initial + eps
+				plus := loss()
+				kernel.RawMatrix().Data[i] = initial - eps
+				minus := loss()
+				kernel.RawMatrix().Data[i] = initial
+				numerical := (plus - minus) / (2 * eps)
+				if math.Abs(numerical-kernelGradients.RawMatrix().Data[i]) > 1e-6 {
+					t.Errorf("Gradient of kernel #%d for padding %d and stride 2 in position %d should be %f, but got %f", f, padding, i, numerical, kernelGradients.RawMatrix().Data[i])
+				}
+			}
+		}
+	}
+}
+
+func TestConvMultiChannelGradients(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	// 3 channels of 5x4 stacked vertically
+	input := mat.NewDense(15, 4, nil)
+	for i := range input.RawMatrix().Data {
+		input.RawMatrix().Data[i] = rnd.Float64() - 0.5
+	}
+	conv := NewConvLayer(&tensor.TDsize{X: 5, Y: 4, Z: 3}, 1, 3, 2, WithBias(), WithRand(rnd))
+	for f, kernel := range conv.(*ConvLayer).Kernels {
+		rows, cols := kernel.Dims()
+		if rows != 9 || cols != 3 {
+			t.Errorf("Kernel #%d should be 9x3 (channels stacked vertically), but got %dx%d", f, rows, cols)
+			return
+		}
+	}
+	// Loss is Σ(w * O), so ΔE/ΔO = w
+	outputWeights := mat.NewDense(6, 2, nil)
+	for i := range outputWeights.RawMatrix().Data {
+		outputWeights.RawMatrix().Data[i] = rnd.Float64() - 0.5
+	}
+	loss := func() float64 {
+		err := conv.FeedForward(input)
+		if err != nil {
+			t.Error(err)
+		}
+		product := &mat.Dense{}
+		product.MulElem(conv.GetActivatedOutput(), outputWeights)
+		return mat.Sum(product)
+	}
+	// Output of every feature is sum of convolutions of channels
+	loss()
+	for f, kernel := range conv.(*ConvLayer).Kernels {
+		expected := mat.NewDense(3, 2, nil)
+		for c := 0; c < 3; c++ {
+			partial, err := Convolve2D(ExtractChannel(input, 15, 4, 3, c), ExtractChannel(kernel, 9, 3, 3, c), 1, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			expected.Add(expected, partial)
+		}
+		actual := ExtractChannel(conv.GetActivatedOutput(), 6, 2, 2, f)
+		if !mat.EqualApprox(expected, actual, 1e-12) {
+			t.Errorf("Feature #%d should be\n%v\nbut got\n%v", f, mat.Formatted(expected), mat.Formatted(actual))
+		}
+	}
+	err := conv.CalculateGradients(outputWeights)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	gradients := conv.GetGradients()
+	eps := 1e-6
+	for i := range input.RawMatrix().Data {
+		initial := input.RawMatrix().Data[i]
+		input.RawMatrix().Data[i] = initial + eps
+		plus := loss()
+		input.RawMatrix().Data[i] = initial - eps
+		minus := loss()
+		input.RawMatrix().Data[i] = initial
+		numerical := (plus - minus) / (2 * eps)
+		if math.Abs(numerical-gradients.RawMatrix().Data[i]) > 1e-6 {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, numerical, gradients.RawMatrix().Data[i])
+		}
+	}
+	for f, kernel := range conv.(*ConvLayer).Kernels {
+		kernelGradients := conv.(*ConvLayer).KernelsGradients[f]
+		for i := range kernel.RawMatrix().Data {
+			initial := kernel.RawMatrix().Data[i]
+			kernel.RawMatrix().Data[i] = initial + eps
+			plus := loss()
+			kernel.RawMatrix().Data[i] = initial - eps
+			minus := loss()
+			kernel.RawMatrix().Data[i] = initial
+			numerical := (plus - minus) / (2 * eps)
+			if math.Abs(numerical-kernelGradients.RawMatrix().Data[i]) > 1e-6 {
+				t.Errorf("Gradient of kernel #%d in position %d should be %f, but got %f", f, i, numerical, kernelGradients.RawMatrix().Data[i])
+			}
+		}
+	}
+}
+
+func TestConvReflectPaddingFallback(t *testing.T) {
+	// Reflect padding can't be applied to input with single row
+	conv := NewConvLayer(&tensor.TDsize{X: 1, Y: 3, Z: 1}, 1, 1, 1, WithPaddingSize(1), WithPaddingMode("reflect"))
+	if conv.(*ConvLayer).PaddingMode != paddingEDGE {
+		t.Errorf("Padding mode should fall back to 'edge', but got '%s'", conv.(*ConvLayer).PaddingMode)
+	}
+	err := conv.FeedForward(mat.NewDense(1, 3, []float64{1, 2, 3}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = conv.CalculateGradients(mat.NewDense(3, 5, nil))
+	if err != nil {
+		t.Error(err)
+	}
+}
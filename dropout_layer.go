@@ -0,0 +1,194 @@
+package cnns
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// DropoutLayer Dropout layer (inverted dropout)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+	Mask - Scaled mask of kept units: 1/(1-Rate) for kept unit and 0 for dropped one
+	Rate - Probability of dropping unit, in range [0; 1)
+
+	In training mode units are dropped with probability Rate and kept units are scaled by 1/(1-Rate),
+	so in inference mode layer just passes data through
+*/
+type DropoutLayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+	Mask       *mat.Dense
+	Rate       float64
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	rand      *rand.Rand
+	trainMode bool
+}
+
+// NewDropoutLayer - Constructor for new dropout layer. You need to specify input size and dropout rate
+/*
+	inSize - input layer's size
+	rate - probability of dropping unit, in range [0; 1)
+	options - optional parameters (see WithRand())
+*/
+func NewDropoutLayer(inSize *tensor.TDsize, rate float64, options ...LayerOption) Layer {
+	opts := newLayerOptions(options...)
+	if rate < 0 || rate >= 1 {
+		fmt.Printf("Warning: dropout rate should be in range [0; 1), but got %f. Using 0.5\n", rate)
+		rate = 0.5
+	}
+	newLayer := &DropoutLayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Mask:       mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Rate:       rate,
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		rand:       opts.rand,
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for dropout layer (make it carefully)
+func (dropout *DropoutLayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for dropout layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for dropout layer
+func (dropout *DropoutLayer) GetInputSize() *tensor.TDsize {
+	return dropout.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of dropout layer
+func (dropout *DropoutLayer) GetOutputSize() *tensor.TDsize {
+	return dropout.OutputSize
+}
+
+// GetActivatedOutput Returns dropout layer's output
+func (dropout *DropoutLayer) GetActivatedOutput() *mat.Dense {
+	return dropout.Ok
+}
+
+// GetWeights Returns dropout layer's weights
+func (dropout *DropoutLayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for dropout layer")
+	return nil
+}
+
+// GetGradients Returns dropout layer's gradients
+func (dropout *DropoutLayer) GetGradients() *mat.Dense {
+	return dropout.LocalDelta
+}
+
+// FeedForward - Feed data to dropout layer
+func (dropout *DropoutLayer) FeedForward(t *mat.Dense) error {
+	if t.RawMatrix().Rows*t.RawMatrix().Cols != dropout.inputSize.Total() {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call FeedForward() on dropout layer")
+	}
+	dropout.Oj = t
+	dropout.doActivation()
+	return nil
+}
+
+// doActivation Dropout layer's output activation
+func (dropout *DropoutLayer) doActivation() {
+	rawOj := dropout.Oj.RawMatrix().Data
+	rawOk := dropout.Ok.RawMatrix().Data
+	if !dropout.trainMode {
+		copy(rawOk, rawOj)
+		return
+	}
+	rawMask := dropout.Mask.RawMatrix().Data
+	scale := 1.0 / (1.0 - dropout.Rate)
+	for j := range rawOj {
+		if randFloat64(dropout.rand) < dropout.Rate {
+			rawMask[j] = 0
+		} else {
+			rawMask[j] = scale
+		}
+		rawOk[j] = rawOj[j] * rawMask[j]
+	}
+}
+
+// CalculateGradients Evaluate dropout layer's gradients
+func (dropout *DropoutLayer) CalculateGradients(errorsDense *mat.Dense) error {
+	rawDelta := dropout.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	if !dropout.trainMode {
+		copy(rawDelta, rawErrors)
+		return nil
+	}
+	// Gradients flow through kept units only
+	rawMask := dropout.Mask.RawMatrix().Data
+	for i := range rawDelta {
+		rawDelta[i] = rawErrors[i] * rawMask[i]
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that dropout layer does NOT updating weights
+func (dropout *DropoutLayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for dropout layer
+}
+
+// PrintOutput Pretty print dropout layer's output
+func (dropout *DropoutLayer) PrintOutput() {
+	fmt.Println("Printing dropout Layer output...")
+	rows, _ := dropout.Ok.Dims()
+	for r := 0; r < rows; r++ {
+		fmt.Printf("\t%v\n", dropout.Ok.RawRowView(r))
+	}
+}
+
+// PrintWeights Just to point, that dropout layer has not weights
+func (dropout *DropoutLayer) PrintWeights() {
+	fmt.Println("There are no weights for dropout layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (dropout *DropoutLayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for dropout layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (dropout *DropoutLayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for dropout layer")
+}
+
+// GetStride Returns stride of layer
+func (dropout *DropoutLayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "dropout" as layer's type
+func (dropout *DropoutLayer) GetType() string {
+	return "dropout"
+}
+
+// setRand See randomizedLayer
+func (dropout *DropoutLayer) setRand(r *rand.Rand) {
+	dropout.rand = r
+}
+
+// SetTrainMode Switch dropout layer to training (true) or inference (false) mode
+func (dropout *DropoutLayer) SetTrainMode(mode bool) {
+	dropout.trainMode = mode
+}
+
+// replicate Returns new dropout layer with the same configuration (see TrainParallel())
+func (dropout *DropoutLayer) replicate() Layer {
+	return NewDropoutLayer(dropout.inputSize, dropout.Rate)
+}
@@ -0,0 +1,83 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestDropoutLayer(t *testing.T) {
+	inSize := &tensor.TDsize{X: 4, Y: 5, Z: 1}
+	input := mat.NewDense(4, 5, nil)
+	for i := range input.RawMatrix().Data {
+		input.RawMatrix().Data[i] = float64(i + 1)
+	}
+	errorsDense := mat.NewDense(4, 5, nil)
+	for i := range errorsDense.RawMatrix().Data {
+		errorsDense.RawMatrix().Data[i] = 1.0
+	}
+
+	dropout := NewDropoutLayer(inSize, 0.5, WithRand(rand.New(rand.NewSource(42))))
+
+	// Inference mode: data should be passed through
+	err := dropout.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(dropout.GetActivatedOutput(), input) {
+		t.Errorf("Dropout layer should not change data in inference mode")
+	}
+
+	// Training mode: units are dropped or scaled by 1/(1-rate)
+	dropout.(*DropoutLayer).SetTrainMode(true)
+	err = dropout.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = dropout.CalculateGradients(errorsDense)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dropped := 0
+	rawOutput := dropout.GetActivatedOutput().RawMatrix().Data
+	rawGradients := dropout.GetGradients().RawMatrix().Data
+	for i, v := range input.RawMatrix().Data {
+		switch rawOutput[i] {
+		case 0:
+			dropped++
+			if rawGradients[i] != 0 {
+				t.Errorf("Gradient of dropped unit %d should be 0, but got %f", i, rawGradients[i])
+			}
+			break
+		default:
+			if math.Abs(rawOutput[i]-2*v) > 1e-12 {
+				t.Errorf("Kept unit %d should be %f, but got %f", i, 2*v, rawOutput[i])
+			}
+			if math.Abs(rawGradients[i]-2) > 1e-12 {
+				t.Errorf("Gradient of kept unit %d should be %f, but got %f", i, 2.0, rawGradients[i])
+			}
+			break
+		}
+	}
+	if dropped == 0 || dropped == len(rawOutput) {
+		t.Errorf("Dropout layer with rate 0.5 should drop some units, but dropped %d of %d", dropped, len(rawOutput))
+	}
+
+	// Same seed should give the same mask
+	another := NewDropoutLayer(inSize, 0.5, WithRand(rand.New(rand.NewSource(42))))
+	another.(*DropoutLayer).SetTrainMode(true)
+	err = another.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(another.GetActivatedOutput(), dropout.GetActivatedOutput()) {
+		t.Errorf("Dropout layers with the same seed should produce the same output")
+	}
+}
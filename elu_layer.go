@@ -0,0 +1,161 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+// ELULayer Exponential Linear Unit layer (activation: x for x >= 0 and α*(exp(x)-1) for x < 0)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+	Alpha - α, saturation value for negative input
+*/
+type ELULayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+	Alpha      float64
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	trainMode bool
+}
+
+// NewELULayer - Constructor for new ELU layer. You need to specify input size and α
+/*
+	inSize - input layer's size
+	alpha - saturation value for negative input (e.g. 1.0)
+*/
+func NewELULayer(inSize *tensor.TDsize, alpha float64) Layer {
+	newLayer := &ELULayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Alpha:      alpha,
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for ELU layer (make it carefully)
+func (elu *ELULayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for ELU layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for ELU layer
+func (elu *ELULayer) GetInputSize() *tensor.TDsize {
+	return elu.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of ELU layer
+func (elu *ELULayer) GetOutputSize() *tensor.TDsize {
+	return elu.OutputSize
+}
+
+// GetActivatedOutput Returns ELU layer's output
+func (elu *ELULayer) GetActivatedOutput() *mat.Dense {
+	return elu.Ok
+}
+
+// GetWeights Returns ELU layer's weights
+func (elu *ELULayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for ELU layer")
+	return nil
+}
+
+// GetGradients Returns ELU layer's gradients
+func (elu *ELULayer) GetGradients() *mat.Dense {
+	return elu.LocalDelta
+}
+
+// FeedForward - Feed data to ELU layer
+func (elu *ELULayer) FeedForward(t *mat.Dense) error {
+	elu.Oj = t
+	elu.doActivation()
+	return nil
+}
+
+// doActivation ELU layer's output activation
+func (elu *ELULayer) doActivation() {
+	rawOj := elu.Oj.RawMatrix().Data
+	rawOk := elu.Ok.RawMatrix().Data
+	for j := range rawOj {
+		if rawOj[j] < 0 {
+			rawOk[j] = elu.Alpha * (math.Exp(rawOj[j]) - 1)
+		} else {
+			rawOk[j] = rawOj[j]
+		}
+	}
+}
+
+// CalculateGradients Evaluate ELU layer's gradients
+func (elu *ELULayer) CalculateGradients(errorsDense *mat.Dense) error {
+	raw := elu.Oj.RawMatrix().Data
+	rawOk := elu.Ok.RawMatrix().Data
+	rawDelta := elu.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	for i := range raw {
+		if raw[i] < 0 {
+			// Derivative is α*exp(x) = O + α
+			rawDelta[i] = rawErrors[i] * (rawOk[i] + elu.Alpha)
+		} else {
+			rawDelta[i] = rawErrors[i]
+		}
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that ELU layer does NOT updating weights
+func (elu *ELULayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for ELU layer
+}
+
+// PrintOutput Pretty print ELU layer's output
+func (elu *ELULayer) PrintOutput() {
+	fmt.Println("Printing ELU Layer output...")
+}
+
+// PrintWeights Just to point, that ELU layer has not weights
+func (elu *ELULayer) PrintWeights() {
+	fmt.Println("There are no weights for ELU layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (elu *ELULayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for ELU layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (elu *ELULayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for ELU layer")
+}
+
+// GetStride Returns stride of layer
+func (elu *ELULayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "elu" as layer's type
+func (elu *ELULayer) GetType() string {
+	return "elu"
+}
+
+// SetTrainMode Switch ELU layer to training (true) or inference (false) mode
+func (elu *ELULayer) SetTrainMode(mode bool) {
+	elu.trainMode = mode
+}
+
+// replicate Returns new ELU layer with the same configuration (see TrainParallel())
+func (elu *ELULayer) replicate() Layer {
+	return NewELULayer(elu.inputSize, elu.Alpha)
+}
@@ -7,4 +7,14 @@ var (
 	ErrDimensionsAreNotEqual = fmt.Errorf("Dimensions are not equal")
 	// ErrNoLayers When array of layers has size 0
 	ErrNoLayers = fmt.Errorf("No layers in network")
+	// ErrInvalidLayerConfiguration When layer's parameters do not fit its input size
+	ErrInvalidLayerConfiguration = fmt.Errorf("Invalid layer configuration")
+	// ErrBinaryFormat When data is not a valid binary model (see ExportBinary())
+	ErrBinaryFormat = fmt.Errorf("Invalid binary model format")
+	// ErrBinaryChecksum When checksum of section of binary model does not match its data
+	ErrBinaryChecksum = fmt.Errorf("Checksum mismatch in binary model")
+	// ErrNoBatchStatistics When layer which depends on whole mini-batch is used in training mode before statistics of mini-batch are evaluated (see PrepareBatchStatistics())
+	ErrNoBatchStatistics = fmt.Errorf("Statistics of mini-batch have not been evaluated")
+	// ErrStopTraining Callback should return it (possibly wrapped) to stop training gracefully (Fit() returns no error then)
+	ErrStopTraining = fmt.Errorf("Training has been stopped by callback")
 )
@@ -22,13 +22,13 @@ func main() {
 func CheckXOR() {
 	rand.Seed(time.Now().UnixNano())
 	// fully-connected layer with 3 output neurons
-	fullyconnected1 := cnns.NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 2)
+	fullyconnected1 := cnns.NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 2, cnns.WithBias())
 	// There is 2 lines of reduntan code below, but it shows how to set definied activation function
 	fullyconnected1.SetActivationFunc(cnns.ActivationTanh)
 	fullyconnected1.SetActivationDerivativeFunc(cnns.ActivationTanhDerivative)
 
 	// fully-connected layer with 1 output neurons
-	fullyconnected2 := cnns.NewFullyConnectedLayer(fullyconnected1.GetOutputSize(), 1)
+	fullyconnected2 := cnns.NewFullyConnectedLayer(fullyconnected1.GetOutputSize(), 1, cnns.WithBias())
 	// There is 2 lines of reduntan code below, but it shows how to set definied activation function
 	fullyconnected2.SetActivationFunc(cnns.ActivationTanh)
 	fullyconnected2.SetActivationDerivativeFunc(cnns.ActivationTanhDerivative)
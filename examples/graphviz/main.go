@@ -26,4 +26,23 @@ func main() {
 		return
 	}
 	fmt.Println(graphvizText)
+
+	// Convolutional network can be drawn in block mode only
+	cnn, err := cnns.NewSequential(&tensor.TDsize{X: 28, Y: 28, Z: 1}).
+		Conv(3, 8, 1).
+		ReLU().
+		MaxPool(2, 2).
+		Dense(10).
+		Softmax().
+		Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	graphvizText, err = cnn.GetGraphvizText(cnns.WithGraphvizBlocks(), cnns.WithGraphvizWeights())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(graphvizText)
 }
@@ -3,14 +3,103 @@ package cnns
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
 )
 
 // ExportToFile Save network structure and its weights to JSON file
+/*
+	fname - filename
+	saveWeights - save weights too (otherwise only structure of network is saved)
+
+	Existing file is replaced only if network has been exported successfully (see writeFileAtomic())
+*/
 func (wh *WholeNet) ExportToFile(fname string, saveWeights bool) error {
-	save := NetJSON{
+	err := writeFileAtomic(fname, func(w io.Writer) error {
+		_, err := wh.export(w, saveWeights)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Can't write data to file '%s'", fname))
+	}
+	return nil
+}
+
+// writeFileAtomic Write data to temporary file in the same directory and rename it to fname, so fname is left untouched if writing fails
+/*
+	fname - filename
+	write - function which writes data
+*/
+func writeFileAtomic(fname string, write func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	err = write(file)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, fname)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// Export Write network structure (and its weights if needed) as JSON to writer (e.g. HTTP response, gzip.Writer, bytes.Buffer)
+/*
+	w - destination
+	saveWeights - save weights too (otherwise only structure of network is saved)
+*/
+func (wh *WholeNet) Export(w io.Writer, saveWeights bool) error {
+	_, err := wh.export(w, saveWeights)
+	return err
+}
+
+// WriteTo Write network structure and its weights as JSON to writer. It implements io.WriterTo
+/*
+	w - destination
+
+	Returns number of written bytes
+*/
+func (wh *WholeNet) WriteTo(w io.Writer) (int64, error) {
+	return wh.export(w, true)
+}
+
+// export Write JSON representation of network to writer. Returns number of written bytes
+func (wh *WholeNet) export(w io.Writer, saveWeights bool) (int64, error) {
+	save, err := wh.toJSON(saveWeights)
+	if err != nil {
+		return 0, err
+	}
+
+	saveJSON, err := json.Marshal(save)
+	if err != nil {
+		return 0, errors.Wrap(err, "Can't marshal network to JSON")
+	}
+
+	n, err := w.Write(saveJSON)
+	if err != nil {
+		return int64(n), errors.Wrap(err, "Can't write network")
+	}
+	return int64(n), nil
+}
+
+// toJSON Prepare JSON representation of network structure (and its weights if needed)
+func (wh *WholeNet) toJSON(saveWeights bool) (*NetJSON, error) {
+	save := &NetJSON{
 		Network:    &NetworkJSON{},
 		Parameters: &LearningParams{},
 	}
@@ -18,21 +107,25 @@ func (wh *WholeNet) ExportToFile(fname string, saveWeights bool) error {
 		switch wh.Layers[i].GetType() {
 		case "conv":
 			layer := wh.Layers[i].(*ConvLayer)
-			kernels := wh.Layers[i].GetWeights()
+			kernels := layer.Kernels
 			newLayer := &NetLayerJSON{
 				LayerType: "conv",
 				InputSize: wh.Layers[i].GetInputSize(),
 				Parameters: &LayerParamsJSON{
-					Stride:     wh.Layers[i].GetStride(),
-					KernelSize: layer.KernelSize,
+					Stride:       wh.Layers[i].GetStride(),
+					KernelSize:   layer.KernelSize,
+					Padding:      layer.Padding,
+					PaddingMode:  layer.PaddingMode.String(),
+					KernelLayout: kernelLayoutStackedChannels,
 				},
 				Weights: make([]*NestedData, len(kernels)),
 			}
 			if saveWeights {
 				for k := range kernels {
-					newLayer.Weights[k] = &NestedData{Data: kernels[k].RawMatrix().Data}
+					newLayer.Weights[k] = exportTensor(kernels[k])
 				}
 			}
+			newLayer.Biases = exportBiases(layer.Biases, saveWeights)
 			save.Network.Layers = append(save.Network.Layers, newLayer)
 			break
 		case "relu":
@@ -42,6 +135,85 @@ func (wh *WholeNet) ExportToFile(fname string, saveWeights bool) error {
 			}
 			save.Network.Layers = append(save.Network.Layers, newLayer)
 			break
+		case "leaky_relu":
+			layer := wh.Layers[i].(*LeakyReLULayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "leaky_relu",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Parameters: &LayerParamsJSON{
+					Alpha: layer.Alpha,
+				},
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "prelu":
+			layer := wh.Layers[i].(*PReLULayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "prelu",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Weights:   make([]*NestedData, 1),
+			}
+			if saveWeights {
+				newLayer.Weights[0] = exportTensor(layer.Slopes)
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "elu":
+			layer := wh.Layers[i].(*ELULayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "elu",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Parameters: &LayerParamsJSON{
+					Alpha: layer.Alpha,
+				},
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "selu", "gelu":
+			newLayer := &NetLayerJSON{
+				LayerType: wh.Layers[i].GetType(),
+				InputSize: wh.Layers[i].GetInputSize(),
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "softmax":
+			newLayer := &NetLayerJSON{
+				LayerType: "softmax",
+				InputSize: wh.Layers[i].GetInputSize(),
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "dropout":
+			layer := wh.Layers[i].(*DropoutLayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "dropout",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Parameters: &LayerParamsJSON{
+					DropoutRate: layer.Rate,
+				},
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
+		case "batchnorm":
+			layer := wh.Layers[i].(*BatchNormLayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "batchnorm",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Parameters: &LayerParamsJSON{
+					NormType: layer.NormType.String(),
+					Momentum: layer.Momentum,
+					Epsilon:  layer.Epsilon,
+				},
+				Weights: make([]*NestedData, 4),
+			}
+			if saveWeights {
+				// γ, β, running mean and running variance
+				for w, weights := range layer.GetWeights() {
+					newLayer.Weights[w] = exportTensor(weights)
+				}
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
 		case "pool":
 			layer := wh.Layers[i].(*PoolingLayer)
 			newLayer := &NetLayerJSON{
@@ -56,39 +228,73 @@ func (wh *WholeNet) ExportToFile(fname string, saveWeights bool) error {
 			}
 			save.Network.Layers = append(save.Network.Layers, newLayer)
 			break
+		case "global_pool":
+			layer := wh.Layers[i].(*GlobalPoolingLayer)
+			newLayer := &NetLayerJSON{
+				LayerType: "global_pool",
+				InputSize: wh.Layers[i].GetInputSize(),
+				Parameters: &LayerParamsJSON{
+					PoolingType: layer.PoolingType.String(),
+				},
+			}
+			save.Network.Layers = append(save.Network.Layers, newLayer)
+			break
 		case "fc":
+			layer := wh.Layers[i].(*FullyConnectedLayer)
+			activation := layer.GetActivationName()
+			if activation == "" {
+				// Layer is saved without activation function, so it gets default one (tanh) on import (the same way as files of older versions)
+				fmt.Printf("Warning: activation function of layer #%d is not registered (see RegisterActivation()). It will be restored as 'tanh'\n", i)
+			}
 			newLayer := &NetLayerJSON{
 				LayerType:  "fc",
 				InputSize:  wh.Layers[i].GetInputSize(),
 				OutputSize: wh.Layers[i].GetOutputSize(),
 				Weights:    make([]*NestedData, 1),
+				Activation: activation,
 			}
 			if saveWeights {
-				weights := wh.Layers[i].GetWeights()
-				if len(weights) != 1 {
-					return fmt.Errorf("Fully connected layer can have only 1 array for weights")
-				}
-				newLayer.Weights[0] = &NestedData{Data: weights[0].RawMatrix().Data}
+				newLayer.Weights[0] = exportTensor(layer.Weights)
 			}
+			newLayer.Biases = exportBiases(layer.Biases, saveWeights)
 			save.Network.Layers = append(save.Network.Layers, newLayer)
 			break
 		default:
-			return fmt.Errorf("Unrecognized layer type: %v", wh.Layers[i].GetType())
+			return nil, fmt.Errorf("Unrecognized layer type: %v", wh.Layers[i].GetType())
 		}
 	}
 
 	save.Parameters.LearningRate = wh.LP.LearningRate
 	save.Parameters.Momentum = wh.LP.Momentum
+	save.Parameters.L2Decay = wh.LP.L2Decay
+	save.Parameters.L1Decay = wh.LP.L1Decay
+	save.Parameters.DecayBiases = wh.LP.DecayBiases
+	save.Parameters.BatchSize = wh.LP.BatchSize
+	save.Parameters.Optimizer = wh.LP.getOptimizer()
+	save.Loss = lossToJSON(wh.getLoss())
 
-	saveJSON, err := json.Marshal(save)
-	if err != nil {
-		return errors.Wrap(err, "Can't marshal network to JSON")
-	}
+	return save, nil
+}
 
-	err = ioutil.WriteFile(fname, saveJSON, 0644)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Can't write data to file '%s'", fname))
+// exportBiases Prepare JSON representation of biases
+/*
+	Returns nil if layer has no biases. Returns empty data if biases should not be saved (so importer knows that layer uses biases)
+*/
+func exportBiases(biases *mat.Dense, saveWeights bool) *NestedData {
+	if biases == nil {
+		return nil
+	}
+	if !saveWeights {
+		return &NestedData{}
 	}
+	return exportTensor(biases)
+}
 
-	return err
+// exportTensor Prepare JSON representation of matrix (its shape and values in row-major order)
+func exportTensor(m *mat.Dense) *NestedData {
+	rows, cols := m.Dims()
+	return &NestedData{
+		Shape: []int{rows, cols},
+		Data:  m.RawMatrix().Data,
+	}
 }
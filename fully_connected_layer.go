@@ -2,7 +2,6 @@ package cnns
 
 import (
 	"fmt"
-	"math/rand"
 
 	"github.com/LdDl/cnns/tensor"
 	"github.com/pkg/errors"
@@ -17,13 +16,23 @@ import (
 	LocalDelta - δ{k}, delta for current layer for k-th neuron
 	NextDeltaWeightSum - SUM(δ{k}*w{j,k}), summation component for evaluating δ{j} for previous layer for j-th neuron
 	Weights - w{j,k}, weight from j-th node of previous layer to k-th node of current layer
+	WeightsState - optimizer's state for weights
+	WeightsGradients - ΔE/Δw{j,k}, gradients accumulated over mini-batch (they are applied in UpdateWeights())
+	Biases - b{k}, bias for k-th node of current layer (nil if layer has no biases)
+	BiasesState - optimizer's state for biases
+	BiasesGradients - ΔE/Δb{k}, gradients accumulated over mini-batch
+	PreviousWeightsState - Deprecated: use WeightsState.Velocity (it is the same matrix)
 */
 type FullyConnectedLayer struct {
 	Oj                   *mat.Dense
 	Ok                   *mat.Dense
 	NextDeltaWeightSum   *mat.Dense
 	Weights              *mat.Dense
-	PreviousWeightsState *mat.Dense
+	WeightsState         *OptimizerState
+	WeightsGradients     *mat.Dense
+	Biases               *mat.Dense
+	BiasesState          *OptimizerState
+	BiasesGradients      *mat.Dense
 	LocalDelta           *mat.Dense
 	SumInput             *mat.Dense
 	ActivationFunc       func(v float64) float64
@@ -31,11 +40,21 @@ type FullyConnectedLayer struct {
 	OutputSize           *tensor.TDsize
 	inputSize            *tensor.TDsize
 
-	trainMode bool
+	// Deprecated: use WeightsState.Velocity
+	PreviousWeightsState *mat.Dense
+
+	accumulatedSamples int
+	trainMode          bool
 }
 
 // NewFullyConnectedLayer Constructor for fully-connected layer. You need to specify input size and output size
-func NewFullyConnectedLayer(inSize *tensor.TDsize, outSize int) Layer {
+/*
+	inSize - size of input
+	outSize - number of neurons
+	options - optional parameters (e.g. WithBias(), WithInitializer(), WithRand())
+*/
+func NewFullyConnectedLayer(inSize *tensor.TDsize, outSize int, options ...LayerOption) Layer {
+	opts := newLayerOptions(options...)
 	newLayer := &FullyConnectedLayer{
 		inputSize:            inSize,
 		OutputSize:           &tensor.TDsize{X: outSize, Y: 1, Z: 1},
@@ -43,29 +62,52 @@ func NewFullyConnectedLayer(inSize *tensor.TDsize, outSize int) Layer {
 		Oj:                   mat.NewDense(outSize, 1, nil),
 		SumInput:             mat.NewDense(outSize, 1, nil),
 		Weights:              mat.NewDense(outSize, inSize.Total(), nil),
-		PreviousWeightsState: mat.NewDense(outSize, inSize.Total(), nil),
+		WeightsState:         NewOptimizerState(outSize, inSize.Total()),
+		WeightsGradients:     mat.NewDense(outSize, inSize.Total(), nil),
 		ActivationFunc:       ActivationTanh,           // Default Activation function is TanH
 		ActivationDerivative: ActivationTanhDerivative, // Default derivative of activation function is 1 - TanH(x)*TanH(x)
 		trainMode:            false,
 	}
-	newLayer.PreviousWeightsState.Zero()
-	for i := 0; i < outSize; i++ {
-		for h := 0; h < inSize.Total(); h++ {
-			newLayer.Weights.Set(i, h, rand.Float64()-0.5)
-		}
+	newLayer.syncDeprecatedStates()
+	opts.initializer.Init(newLayer.Weights, inSize.Total(), outSize, opts.rand)
+	if opts.useBias {
+		newLayer.enableBiases()
 	}
 	return newLayer
 }
 
+// enableBiases Initialize zero biases for fully-connected layer
+func (fc *FullyConnectedLayer) enableBiases() {
+	fc.Biases = mat.NewDense(fc.OutputSize.X, 1, nil)
+	fc.BiasesState = NewOptimizerState(fc.OutputSize.X, 1)
+	fc.BiasesGradients = mat.NewDense(fc.OutputSize.X, 1, nil)
+}
+
+// syncDeprecatedStates Points deprecated PreviousWeightsState to velocity of optimizer's state
+func (fc *FullyConnectedLayer) syncDeprecatedStates() {
+	fc.PreviousWeightsState = fc.WeightsState.Velocity
+}
+
 // SetCustomWeights Set user's weights for fully-connected layer (make it carefully)
+/*
+	weights - slice of length 1 (weights only) or 2 (weights and biases). Biases are enabled if they are provided
+*/
 func (fc *FullyConnectedLayer) SetCustomWeights(weights []*mat.Dense) {
-	if len(weights) != 1 {
-		fmt.Println("You can provide array of length 1 only (for fully-connected layer)")
+	if len(weights) != 1 && len(weights) != 2 {
+		fmt.Println("You can provide array of length 1 (weights) or 2 (weights and biases) only (for fully-connected layer)")
 		return
 	}
 	r, c := weights[0].Dims()
 	fc.Weights = mat.NewDense(r, c, nil)
 	fc.Weights.CloneFrom(weights[0])
+	fc.WeightsState = NewOptimizerState(r, c)
+	fc.syncDeprecatedStates()
+	fc.WeightsGradients = mat.NewDense(r, c, nil)
+	fc.accumulatedSamples = 0
+	if len(weights) == 2 {
+		fc.enableBiases()
+		fc.Biases.CloneFrom(weights[1])
+	}
 }
 
 // GetInputSize Returns dimensions of incoming data for fully-connected layer
@@ -83,8 +125,11 @@ func (fc *FullyConnectedLayer) GetActivatedOutput() *mat.Dense {
 	return fc.Ok // ACTIVATED values
 }
 
-// GetWeights Returns fully-connected layer's weights.
+// GetWeights Returns fully-connected layer's weights (and biases as second element if layer has them).
 func (fc *FullyConnectedLayer) GetWeights() []*mat.Dense {
+	if fc.Biases != nil {
+		return []*mat.Dense{fc.Weights, fc.Biases}
+	}
 	return []*mat.Dense{fc.Weights}
 }
 
@@ -120,6 +165,9 @@ func (fc *FullyConnectedLayer) doActivation() error {
 		return fmt.Errorf("Can't call doActivation() on FC layer")
 	}
 	fc.Ok.Mul(fc.Weights, fc.Oj)
+	if fc.Biases != nil {
+		fc.Ok.Add(fc.Ok, fc.Biases)
+	}
 	fc.SumInput.Copy(fc.Ok)
 	rawMatrix := fc.Ok.RawMatrix().Data
 	for i := range rawMatrix {
@@ -145,28 +193,36 @@ func (fc *FullyConnectedLayer) CalculateGradients(errorsDense *mat.Dense) error
 	fc.NextDeltaWeightSum = &mat.Dense{}
 	fc.NextDeltaWeightSum.Mul(fc.Weights.T(), fc.LocalDelta)
 
+	// Evaluate ΔΣ(k)/Δw{j}{k} and accumulate it (gradients are applied in UpdateWeights())
+	gradients := &mat.Dense{}
+	gradients.Mul(fc.LocalDelta, fc.Oj.T())
+	fc.WeightsGradients.Add(fc.WeightsGradients, gradients)
+	if fc.Biases != nil {
+		// ΔΣ(k)/Δb{k} = 1
+		fc.BiasesGradients.Add(fc.BiasesGradients, fc.LocalDelta)
+	}
+	fc.accumulatedSamples++
+
 	return nil
 }
 
-// UpdateWeights Update fully-connected layer's weights
+// UpdateWeights Update fully-connected layer's weights (gradients are averaged over accumulated samples)
 func (fc *FullyConnectedLayer) UpdateWeights(lp *LearningParams) {
-	// Evaluate ΔΣ(k)/Δw{j}{k}
-	Δw := &mat.Dense{}
-	Δw.Mul(fc.LocalDelta, fc.Oj.T())
-
-	Δw.Scale(-1.0*lp.LearningRate, Δw)
-
-	// Inertia (as separated Scale() call)
-	// @todo - this should be optional.
-	Δw.Scale(1.0-lp.Momentum, Δw)
-
-	fc.PreviousWeightsState.Scale(lp.Momentum, fc.PreviousWeightsState)
+	if fc.accumulatedSamples == 0 {
+		return
+	}
+	fc.WeightsGradients.Scale(1.0/float64(fc.accumulatedSamples), fc.WeightsGradients)
 
-	Δw.Add(Δw, fc.PreviousWeightsState)
-	fc.PreviousWeightsState.CloneFrom(Δw)
+	// Update weights: optimizer does w = w + Δw
+	lp.updateParameters(fc.Weights, fc.WeightsGradients, fc.WeightsState, false)
+	fc.WeightsGradients.Zero()
 
-	// Update weights: w = w + Δw
-	fc.Weights.Add(fc.Weights, Δw)
+	if fc.Biases != nil {
+		fc.BiasesGradients.Scale(1.0/float64(fc.accumulatedSamples), fc.BiasesGradients)
+		lp.updateParameters(fc.Biases, fc.BiasesGradients, fc.BiasesState, true)
+		fc.BiasesGradients.Zero()
+	}
+	fc.accumulatedSamples = 0
 }
 
 // PrintOutput Pretty prrint fully-connected layer's output
@@ -185,6 +241,10 @@ func (fc *FullyConnectedLayer) PrintWeights() {
 	for r := 0; r < rows; r++ {
 		fmt.Printf("\t%v\n", fc.Weights.RawRowView(r))
 	}
+	if fc.Biases != nil {
+		fmt.Println("Printing fully-connected Layer biases...")
+		fmt.Printf("\t%v\n", fc.Biases.RawMatrix().Data)
+	}
 }
 
 // SetActivationFunc Set activation function for fully-connected layer. You need to specify function: func(v float64) float64
@@ -197,6 +257,22 @@ func (fc *FullyConnectedLayer) SetActivationDerivativeFunc(f func(v float64) flo
 	fc.ActivationDerivative = f
 }
 
+// SetActivation Set registered activation function and its derivative for fully-connected layer by name (e.g. "tanh", "sigmoid", "relu")
+func (fc *FullyConnectedLayer) SetActivation(name string) error {
+	activation, err := GetActivation(name)
+	if err != nil {
+		return errors.Wrap(err, "Can't call SetActivation() on fully-connected layer")
+	}
+	fc.ActivationFunc = activation.Func
+	fc.ActivationDerivative = activation.Derivative
+	return nil
+}
+
+// GetActivationName Returns name of fully-connected layer's activation function (empty string if function is not registered, see RegisterActivation())
+func (fc *FullyConnectedLayer) GetActivationName() string {
+	return findActivationName(fc.ActivationFunc, fc.ActivationDerivative)
+}
+
 // GetStride Returns stride of fully-connected layer
 func (fc *FullyConnectedLayer) GetStride() int {
 	return 0
@@ -206,3 +282,92 @@ func (fc *FullyConnectedLayer) GetStride() int {
 func (fc *FullyConnectedLayer) GetType() string {
 	return "fc"
 }
+
+// SetTrainMode Switch fully-connected layer to training (true) or inference (false) mode
+func (fc *FullyConnectedLayer) SetTrainMode(mode bool) {
+	fc.trainMode = mode
+}
+
+// replicate Returns new fully-connected layer with the same configuration and own buffers (see Predict() and CalculateBatchGradients()). Weights are shared by shareParameters()
+func (fc *FullyConnectedLayer) replicate() Layer {
+	// Do not waste random numbers: weights are replaced by shareParameters() anyway
+	options := []LayerOption{WithInitializer(NewInitializerConstant(0))}
+	if fc.Biases != nil {
+		options = append(options, WithBias())
+	}
+	replica := NewFullyConnectedLayer(fc.inputSize, fc.OutputSize.X, options...).(*FullyConnectedLayer)
+	replica.ActivationFunc = fc.ActivationFunc
+	replica.ActivationDerivative = fc.ActivationDerivative
+	return replica
+}
+
+// mergeGradients Adds gradients accumulated by replica to layer's gradients and resets replica's ones
+func (fc *FullyConnectedLayer) mergeGradients(replica Layer) {
+	replicaFC := replica.(*FullyConnectedLayer)
+	fc.WeightsGradients.Add(fc.WeightsGradients, replicaFC.WeightsGradients)
+	replicaFC.WeightsGradients.Zero()
+	if fc.Biases != nil {
+		fc.BiasesGradients.Add(fc.BiasesGradients, replicaFC.BiasesGradients)
+		replicaFC.BiasesGradients.Zero()
+	}
+	fc.accumulatedSamples += replicaFC.accumulatedSamples
+	replicaFC.accumulatedSamples = 0
+}
+
+// shareParameters Makes replica use the same weights (and biases) and activation function as layer (see Predict() and CalculateBatchGradients())
+func (fc *FullyConnectedLayer) shareParameters(replica Layer) {
+	replicaFC := replica.(*FullyConnectedLayer)
+	replicaFC.Weights = fc.Weights
+	replicaFC.Biases = fc.Biases
+	replicaFC.ActivationFunc = fc.ActivationFunc
+	replicaFC.ActivationDerivative = fc.ActivationDerivative
+}
+
+// predictBatch Evaluates outputs for several inputs at once in inference mode: inputs are stacked as columns of single matrix,
+// so weights are applied by one matrix multiplication. Layer is not modified (see PredictBatch())
+func (fc *FullyConnectedLayer) predictBatch(inputs []*mat.Dense) ([]*mat.Dense, error) {
+	weightsR, weightsC := fc.Weights.Dims()
+	stacked := mat.NewDense(weightsC, len(inputs), nil)
+	for n, input := range inputs {
+		raw := input.RawMatrix()
+		if raw.Rows*raw.Cols != weightsC {
+			return nil, errors.Wrapf(ErrDimensionsAreNotEqual, "Can't call predictBatch() on fully-connected layer for input #%d", n)
+		}
+		for i := 0; i < raw.Rows; i++ {
+			for j := 0; j < raw.Cols; j++ {
+				stacked.Set(i*raw.Cols+j, n, raw.Data[i*raw.Stride+j])
+			}
+		}
+	}
+	sums := &mat.Dense{}
+	sums.Mul(fc.Weights, stacked)
+	outputs := make([]*mat.Dense, len(inputs))
+	for n := range inputs {
+		output := mat.NewDense(weightsR, 1, nil)
+		for k := 0; k < weightsR; k++ {
+			sum := sums.At(k, n)
+			if fc.Biases != nil {
+				sum += fc.Biases.At(k, 0)
+			}
+			output.Set(k, 0, fc.ActivationFunc(sum))
+		}
+		outputs[n] = output
+	}
+	return outputs, nil
+}
+
+// trainableParameters Returns weights (and biases) of fully-connected layer
+func (fc *FullyConnectedLayer) trainableParameters() []*mat.Dense {
+	if fc.Biases != nil {
+		return []*mat.Dense{fc.Weights, fc.Biases}
+	}
+	return []*mat.Dense{fc.Weights}
+}
+
+// optimizerStates Returns optimizer's states for weights (and biases) of fully-connected layer
+func (fc *FullyConnectedLayer) optimizerStates() []*OptimizerState {
+	if fc.Biases != nil {
+		return []*OptimizerState{fc.WeightsState, fc.BiasesState}
+	}
+	return []*OptimizerState{fc.WeightsState}
+}
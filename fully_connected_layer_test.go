@@ -1,9 +1,11 @@
 package cnns
 
 import (
+	"math"
 	"testing"
 
 	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
 )
 
 func TestFullyConectedSize(t *testing.T) {
@@ -20,3 +22,40 @@ func TestFullyConectedSize(t *testing.T) {
 		t.Errorf("Z dimension should be of value %d, but got %d", correct.Z, outSize.Z)
 	}
 }
+
+func TestFullyConnectedBias(t *testing.T) {
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 2, WithBias())
+	fc.SetActivationFunc(ActivationIdentity)
+	fc.SetActivationDerivativeFunc(ActivationIdentityDerivative)
+	fc.SetCustomWeights([]*mat.Dense{
+		mat.NewDense(2, 2, []float64{1, 2, 3, 4}),
+		mat.NewDense(2, 1, []float64{0.5, -0.5}),
+	})
+	err := fc.FeedForward(mat.NewDense(2, 1, []float64{1, 1}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{3.5, 6.5}
+	got := fc.GetActivatedOutput().RawMatrix().Data
+	for i := range correct {
+		if got[i] != correct[i] {
+			t.Errorf("Output in position %d should be %f, but got %f", i, correct[i], got[i])
+		}
+	}
+
+	// ΔE/Δb = δ{k}
+	err = fc.CalculateGradients(mat.NewDense(2, 1, []float64{1, -2}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fc.UpdateWeights(&LearningParams{LearningRate: 0.1, Momentum: 0})
+	correctBiases := []float64{0.4, -0.3}
+	gotBiases := fc.GetWeights()[1].RawMatrix().Data
+	for i := range correctBiases {
+		if math.Abs(gotBiases[i]-correctBiases[i]) > 1e-12 {
+			t.Errorf("Bias in position %d should be %f, but got %f", i, correctBiases[i], gotBiases[i])
+		}
+	}
+}
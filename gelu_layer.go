@@ -0,0 +1,150 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+// GELULayer Gaussian Error Linear Unit layer (activation: x*Φ(x), where Φ is cumulative distribution function of standard normal distribution)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+*/
+type GELULayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	trainMode bool
+}
+
+// NewGELULayer - Constructor for new GELU layer. You need to specify input size
+/*
+	inSize - input layer's size
+*/
+func NewGELULayer(inSize *tensor.TDsize) Layer {
+	newLayer := &GELULayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for GELU layer (make it carefully)
+func (gelu *GELULayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for GELU layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for GELU layer
+func (gelu *GELULayer) GetInputSize() *tensor.TDsize {
+	return gelu.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of GELU layer
+func (gelu *GELULayer) GetOutputSize() *tensor.TDsize {
+	return gelu.OutputSize
+}
+
+// GetActivatedOutput Returns GELU layer's output
+func (gelu *GELULayer) GetActivatedOutput() *mat.Dense {
+	return gelu.Ok
+}
+
+// GetWeights Returns GELU layer's weights
+func (gelu *GELULayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for GELU layer")
+	return nil
+}
+
+// GetGradients Returns GELU layer's gradients
+func (gelu *GELULayer) GetGradients() *mat.Dense {
+	return gelu.LocalDelta
+}
+
+// FeedForward - Feed data to GELU layer
+func (gelu *GELULayer) FeedForward(t *mat.Dense) error {
+	gelu.Oj = t
+	gelu.doActivation()
+	return nil
+}
+
+// doActivation GELU layer's output activation
+func (gelu *GELULayer) doActivation() {
+	rawOj := gelu.Oj.RawMatrix().Data
+	rawOk := gelu.Ok.RawMatrix().Data
+	for j := range rawOj {
+		rawOk[j] = rawOj[j] * 0.5 * (1 + math.Erf(rawOj[j]/math.Sqrt2))
+	}
+}
+
+// CalculateGradients Evaluate GELU layer's gradients
+func (gelu *GELULayer) CalculateGradients(errorsDense *mat.Dense) error {
+	raw := gelu.Oj.RawMatrix().Data
+	rawDelta := gelu.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	for i := range raw {
+		// Derivative is Φ(x) + x*φ(x)
+		cdf := 0.5 * (1 + math.Erf(raw[i]/math.Sqrt2))
+		pdf := math.Exp(-0.5*raw[i]*raw[i]) / math.Sqrt(2*math.Pi)
+		rawDelta[i] = rawErrors[i] * (cdf + raw[i]*pdf)
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that GELU layer does NOT updating weights
+func (gelu *GELULayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for GELU layer
+}
+
+// PrintOutput Pretty print GELU layer's output
+func (gelu *GELULayer) PrintOutput() {
+	fmt.Println("Printing GELU Layer output...")
+}
+
+// PrintWeights Just to point, that GELU layer has not weights
+func (gelu *GELULayer) PrintWeights() {
+	fmt.Println("There are no weights for GELU layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (gelu *GELULayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for GELU layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (gelu *GELULayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for GELU layer")
+}
+
+// GetStride Returns stride of layer
+func (gelu *GELULayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "gelu" as layer's type
+func (gelu *GELULayer) GetType() string {
+	return "gelu"
+}
+
+// SetTrainMode Switch GELU layer to training (true) or inference (false) mode
+func (gelu *GELULayer) SetTrainMode(mode bool) {
+	gelu.trainMode = mode
+}
+
+// replicate Returns new GELU layer with the same configuration (see TrainParallel())
+func (gelu *GELULayer) replicate() Layer {
+	return NewGELULayer(gelu.inputSize)
+}
@@ -0,0 +1,217 @@
+package cnns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// GlobalPoolingLayer Global pooling layer: every channel is collapsed to single value (1x1)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Gradients for previous layer
+	PoolingType - type of pooling (max/min/avg)
+	masksIndices - positions of max (or min) element for every channel
+*/
+type GlobalPoolingLayer struct {
+	Oj           *mat.Dense
+	Ok           *mat.Dense
+	LocalDelta   *mat.Dense
+	masksIndices [][2]int
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	PoolingType poolingType
+	trainMode   bool
+}
+
+// NewGlobalPoolingLayer Constructor for global pooling layer. You need to specify input size and type of pooling
+/*
+	inSize - input layer's size
+	poolingType - "max", "min" or "avg"
+*/
+func NewGlobalPoolingLayer(inSize *tensor.TDsize, poolingType string) Layer {
+	newLayer := &GlobalPoolingLayer{
+		inputSize:    inSize,
+		Oj:           mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:           mat.NewDense(inSize.Z, 1, nil),
+		LocalDelta:   mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		masksIndices: make([][2]int, inSize.Z),
+		OutputSize:   &tensor.TDsize{X: 1, Y: 1, Z: inSize.Z},
+		trainMode:    false,
+	}
+	switch strings.ToLower(poolingType) {
+	case "max":
+		newLayer.PoolingType = poolMAX
+		break
+	case "min":
+		newLayer.PoolingType = poolMIN
+		break
+	case "avg":
+		newLayer.PoolingType = poolAVG
+		break
+	default:
+		fmt.Printf("Warning: type '%s' for global pooling layer is not supported. Use 'max', 'min' or 'avg'\n", poolingType)
+		newLayer.PoolingType = poolMAX
+		break
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights (make it carefully) for global pooling layer
+func (pool *GlobalPoolingLayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for global pooling layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for global pooling layer
+func (pool *GlobalPoolingLayer) GetInputSize() *tensor.TDsize {
+	return pool.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of global pooling layer
+func (pool *GlobalPoolingLayer) GetOutputSize() *tensor.TDsize {
+	return pool.OutputSize
+}
+
+// GetActivatedOutput Returns global pooling layer's output
+func (pool *GlobalPoolingLayer) GetActivatedOutput() *mat.Dense {
+	return pool.Ok
+}
+
+// GetWeights Returns global pooling layer's weights
+func (pool *GlobalPoolingLayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for global pooling layer")
+	return nil
+}
+
+// GetGradients Returns global pooling layer's gradients
+func (pool *GlobalPoolingLayer) GetGradients() *mat.Dense {
+	return pool.LocalDelta
+}
+
+// FeedForward Feed data to global pooling layer
+func (pool *GlobalPoolingLayer) FeedForward(input *mat.Dense) error {
+	if input.RawMatrix().Rows*input.RawMatrix().Cols != pool.inputSize.Total() {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call FeedForward() on global pooling layer")
+	}
+	r, c := input.Dims()
+	if r != pool.inputSize.X*pool.inputSize.Z || c != pool.inputSize.Y {
+		reshaped, err := Reshape(input, pool.inputSize.X*pool.inputSize.Z, pool.inputSize.Y)
+		if err != nil {
+			return errors.Wrap(err, "Can't call FeedForward() on global pooling layer while reshaping input")
+		}
+		input = reshaped
+	}
+	pool.Oj = input
+	pool.doActivation()
+	return nil
+}
+
+// doActivation Global pooling layer's output activation
+func (pool *GlobalPoolingLayer) doActivation() {
+	channels := pool.inputSize.Z
+	rows, cols := pool.Oj.Dims()
+	for c := 0; c < channels; c++ {
+		channel := ExtractChannel(pool.Oj, rows, cols, channels, c)
+		switch pool.PoolingType {
+		case poolMAX:
+			i, j, k := maxPoolIdx(channel)
+			pool.masksIndices[c] = [2]int{i, j}
+			pool.Ok.Set(c, 0, k)
+			break
+		case poolMIN:
+			i, j, k := minPoolIdx(channel)
+			pool.masksIndices[c] = [2]int{i, j}
+			pool.Ok.Set(c, 0, k)
+			break
+		case poolAVG:
+			pool.Ok.Set(c, 0, avgPool(channel))
+			break
+		default:
+			panic("default behaviour for global pool_%TYPE% is not implemented")
+		}
+	}
+}
+
+// CalculateGradients Evaluate global pooling layer's gradients
+func (pool *GlobalPoolingLayer) CalculateGradients(errorsDense *mat.Dense) error {
+	channels := pool.inputSize.Z
+	rawErrors := errorsDense.RawMatrix().Data
+	if len(rawErrors) != channels {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call CalculateGradients() on global pooling layer")
+	}
+	pool.LocalDelta.Zero()
+	rows, cols := pool.LocalDelta.Dims()
+	for c := 0; c < channels; c++ {
+		partialDelta := ExtractChannel(pool.LocalDelta, rows, cols, channels, c)
+		switch pool.PoolingType {
+		case poolAVG:
+			// Gradient is distributed evenly over channel
+			share := rawErrors[c] / float64(pool.inputSize.X*pool.inputSize.Y)
+			for i := 0; i < pool.inputSize.X; i++ {
+				for j := 0; j < pool.inputSize.Y; j++ {
+					partialDelta.Set(i, j, share)
+				}
+			}
+			break
+		default:
+			// Gradient goes to max (or min) element of channel only
+			partialDelta.Set(pool.masksIndices[c][0], pool.masksIndices[c][1], rawErrors[c])
+			break
+		}
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that global pooling layer does NOT updating weights
+func (pool *GlobalPoolingLayer) UpdateWeights(lp *LearningParams) {
+	// "There are no weights to update for global pooling layer"
+}
+
+// PrintOutput Pretty print global pooling layer's output
+func (pool *GlobalPoolingLayer) PrintOutput() {
+	fmt.Println("Printing Global Pooling Layer output...")
+	fmt.Printf("\t%v\n", pool.Ok.RawMatrix().Data)
+}
+
+// PrintWeights Just to point, that global pooling layer has not gradients
+func (pool *GlobalPoolingLayer) PrintWeights() {
+	fmt.Println("There are no weights for global pooling layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (pool *GlobalPoolingLayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for global pooling layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (pool *GlobalPoolingLayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for global pooling layer")
+}
+
+// GetStride Returns stride of layer
+func (pool *GlobalPoolingLayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "global_pool" as layer's type
+func (pool *GlobalPoolingLayer) GetType() string {
+	return "global_pool"
+}
+
+// SetTrainMode Switch global pooling layer to training (true) or inference (false) mode
+func (pool *GlobalPoolingLayer) SetTrainMode(mode bool) {
+	pool.trainMode = mode
+}
+
+// replicate Returns new global pooling layer with the same configuration (see TrainParallel())
+func (pool *GlobalPoolingLayer) replicate() Layer {
+	return NewGlobalPoolingLayer(pool.inputSize, pool.PoolingType.String())
+}
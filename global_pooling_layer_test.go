@@ -0,0 +1,71 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGlobalPooling(t *testing.T) {
+	// Two channels 2x3 stacked vertically
+	input := mat.NewDense(4, 3, []float64{
+		1, 2, 3,
+		4, 5, 6,
+		-1, 7, 0,
+		2, 2, 2,
+	})
+	errorsDense := mat.NewDense(2, 1, []float64{6, 12})
+
+	avg := NewGlobalPoolingLayer(&tensor.TDsize{X: 2, Y: 3, Z: 2}, "avg")
+	if avg.GetOutputSize().X != 1 || avg.GetOutputSize().Y != 1 || avg.GetOutputSize().Z != 2 {
+		t.Errorf("Output size should be 1x1x2, but got %v", avg.GetOutputSize())
+	}
+	err := avg.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{3.5, 2}
+	for i, v := range avg.GetActivatedOutput().RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-12 {
+			t.Errorf("Average of channel %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+	err = avg.CalculateGradients(errorsDense)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correctGradients := []float64{1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2}
+	for i, v := range avg.GetGradients().RawMatrix().Data {
+		if math.Abs(v-correctGradients[i]) > 1e-12 {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, correctGradients[i], v)
+		}
+	}
+
+	max := NewGlobalPoolingLayer(&tensor.TDsize{X: 2, Y: 3, Z: 2}, "max")
+	err = max.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct = []float64{6, 7}
+	for i, v := range max.GetActivatedOutput().RawMatrix().Data {
+		if v != correct[i] {
+			t.Errorf("Maximum of channel %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+	err = max.CalculateGradients(errorsDense)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correctGradients = []float64{0, 0, 0, 0, 0, 6, 0, 12, 0, 0, 0, 0}
+	for i, v := range max.GetGradients().RawMatrix().Data {
+		if v != correctGradients[i] {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, correctGradients[i], v)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// GraphvizOption Optional parameter for GetGraphvizText()
+type GraphvizOption func(opts *graphvizOptions)
+
+// graphvizOptions Parameters of Graphviz rendering
+/*
+	blocks - draw every layer as single box instead of drawing every neuron
+	weights - annotate edges with weights magnitudes
+*/
+type graphvizOptions struct {
+	blocks  bool
+	weights bool
+}
+
+// newGraphvizOptions Returns default Graphviz options (neuron-level drawing without weights) with provided options applied
+func newGraphvizOptions(options ...GraphvizOption) *graphvizOptions {
+	opts := &graphvizOptions{
+		blocks:  false,
+		weights: false,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// WithGraphvizBlocks Draw every layer as labelled box (type, kernel size, stride, output size and etc.). Any layer type is supported in this mode
+func WithGraphvizBlocks() GraphvizOption {
+	return func(opts *graphvizOptions) {
+		opts.blocks = true
+	}
+}
+
+// WithGraphvizWeights Annotate edges with weights magnitudes.
+// In neuron-level drawing edges of fully-connected layers are labelled with weights (line width is proportional to |w|);
+// in block drawing edges are labelled with mean |w| of layer which edge leads to
+func WithGraphvizWeights() GraphvizOption {
+	return func(opts *graphvizOptions) {
+		opts.weights = true
+	}
+}
+
+// getGraphvizBlocksText Returns Graphviz text where every layer is single box
+func (wh *WholeNet) getGraphvizBlocksText(opts *graphvizOptions) (string, error) {
+	if len(wh.Layers) == 0 {
+		return "", ErrNoLayers
+	}
+	graph := "digraph G {rankdir = LR;node [shape=box, style=\"rounded,filled\", fillcolor=dodgerblue];"
+	inputSize := wh.Layers[0].GetInputSize()
+	graph += fmt.Sprintf("l_input [fillcolor=chartreuse, label=\"Input layer\\n%dx%dx%d\"];", inputSize.X, inputSize.Y, inputSize.Z)
+	for l := range wh.Layers {
+		color := "dodgerblue"
+		if l == len(wh.Layers)-1 {
+			color = "coral1"
+		}
+		size := wh.Layers[l].GetOutputSize()
+		label := fmt.Sprintf("layer %d: %s", l, wh.Layers[l].GetType())
+		if details := layerGraphvizDetails(wh.Layers[l]); details != "" {
+			label += "\\n" + details
+		}
+		label += fmt.Sprintf("\\n%dx%dx%d", size.X, size.Y, size.Z)
+		graph += fmt.Sprintf("l%d [fillcolor=%s, label=\"%s\"];", l, color, label)
+	}
+	for l := range wh.Layers {
+		from := "l_input"
+		if l > 0 {
+			from = fmt.Sprintf("l%d", l-1)
+		}
+		edge := fmt.Sprintf("%s -> l%d", from, l)
+		if opts.weights {
+			if magnitude, ok := layerWeightsMagnitude(wh.Layers[l]); ok {
+				edge += fmt.Sprintf(" [label=\"|w|=%.4f\"]", magnitude)
+			}
+		}
+		graph += edge + ";"
+	}
+	graph += "}"
+	return graph, nil
+}
+
+// layerGraphvizDetails Returns short description of layer's parameters for Graphviz label
+func layerGraphvizDetails(layer Layer) string {
+	switch l := layer.(type) {
+	case *ConvLayer:
+		details := fmt.Sprintf("kernel %[1]dx%[1]d, stride %[2]d, filters %[3]d", l.KernelSize, l.Stride, l.OutputSize.Z)
+		if l.Padding > 0 {
+			details += fmt.Sprintf(", padding %d (%s)", l.Padding, l.PaddingMode)
+		}
+		return details
+	case *PoolingLayer:
+		return fmt.Sprintf("%[1]s %[2]dx%[2]d, stride %[3]d", l.PoolingType, l.ExtendFilter, l.Stride)
+	case *GlobalPoolingLayer:
+		return l.PoolingType.String()
+	case *FullyConnectedLayer:
+		details := fmt.Sprintf("neurons %d", l.OutputSize.X)
+		if name := l.GetActivationName(); name != "" {
+			details += fmt.Sprintf(", %s", name)
+		}
+		return details
+	case *DropoutLayer:
+		return fmt.Sprintf("rate %g", l.Rate)
+	case *BatchNormLayer:
+		return l.NormType.String()
+	case *LeakyReLULayer:
+		return fmt.Sprintf("α %g", l.Alpha)
+	case *ELULayer:
+		return fmt.Sprintf("α %g", l.Alpha)
+	default:
+		return ""
+	}
+}
+
+// layerWeightsMagnitude Returns mean absolute value of layer's trainable parameters (false if layer has no parameters)
+func layerWeightsMagnitude(layer Layer) (float64, bool) {
+	weights := []*mat.Dense{}
+	switch l := layer.(type) {
+	case *ConvLayer:
+		weights = l.Kernels
+		break
+	case *FullyConnectedLayer:
+		weights = append(weights, l.Weights)
+		break
+	case *BatchNormLayer:
+		weights = append(weights, l.Gamma)
+		break
+	case *PReLULayer:
+		weights = append(weights, l.Slopes)
+		break
+	default:
+		return 0, false
+	}
+	sum, count := 0.0, 0
+	for _, w := range weights {
+		for _, v := range w.RawMatrix().Data {
+			sum += math.Abs(v)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// weightedGraphvizEdges Returns edges between every pair of neurons of fully-connected layer labelled with weights
+/*
+	fc - fully-connected layer
+	from - vertices of previous layer (inputs of fc)
+	to - vertices of fc
+*/
+func weightedGraphvizEdges(fc *FullyConnectedLayer, from, to []string) (string, error) {
+	rows, cols := fc.Weights.Dims()
+	if rows != len(to) || cols != len(from) {
+		return "", fmt.Errorf("Weights of fully-connected layer (%dx%d) do not match number of vertices (%d -> %d)", rows, cols, len(from), len(to))
+	}
+	maxAbs := mat.Max(fc.Weights)
+	if minAbs := -mat.Min(fc.Weights); minAbs > maxAbs {
+		maxAbs = minAbs
+	}
+	edges := []string{}
+	for k := range to {
+		for j := range from {
+			w := fc.Weights.At(k, j)
+			width := 1.0
+			if maxAbs > 0 {
+				width = 0.5 + 2.5*math.Abs(w)/maxAbs
+			}
+			edges = append(edges, fmt.Sprintf("%s -> %s [label=\"%.2f\", penwidth=%.2f]", from[j], to[k], w, width))
+		}
+	}
+	return strings.Join(edges, ";") + ";", nil
+}
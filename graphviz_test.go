@@ -0,0 +1,69 @@
+package cnns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGraphvizBlocks(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 10, Y: 10, Z: 1}).
+		Conv(3, 4, 1).
+		ReLU().
+		MaxPool(2, 2).
+		Dense(3).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = net.GetGraphvizText()
+	if err == nil {
+		t.Errorf("Neuron-level drawing should fail for convolutional layer")
+	}
+	graph, err := net.GetGraphvizText(WithGraphvizBlocks(), WithGraphvizWeights())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	parts := []string{
+		"l_input [fillcolor=chartreuse, label=\"Input layer\\n10x10x1\"]",
+		"layer 0: conv\\nkernel 3x3, stride 1, filters 4\\n8x8x4",
+		"layer 2: pool\\nmax 2x2, stride 2\\n4x4x4",
+		"layer 3: fc\\nneurons 3, tanh\\n3x1x1",
+		"l4 [fillcolor=coral1",
+		"l_input -> l0 [label=\"|w|=",
+		"l1 -> l2;",
+		"l3 -> l4;",
+	}
+	for _, part := range parts {
+		if !strings.Contains(graph, part) {
+			t.Errorf("Graphviz text should contain '%s', but got:\n%s", part, graph)
+		}
+	}
+}
+
+func TestGraphvizWeights(t *testing.T) {
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 2)
+	fc.SetCustomWeights([]*mat.Dense{mat.NewDense(2, 2, []float64{0.5, -1.0, 0.25, 0.0})})
+	net := WholeNet{Layers: []Layer{fc}}
+	graph, err := net.GetGraphvizText(WithGraphvizWeights())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	parts := []string{
+		"x0 -> O0 [label=\"0.50\", penwidth=1.75]",
+		"x1 -> O0 [label=\"-1.00\", penwidth=3.00]",
+		"x0 -> O1 [label=\"0.25\", penwidth=1.12]",
+		"x1 -> O1 [label=\"0.00\", penwidth=0.50]",
+	}
+	for _, part := range parts {
+		if !strings.Contains(graph, part) {
+			t.Errorf("Graphviz text should contain '%s', but got:\n%s", part, graph)
+		}
+	}
+}
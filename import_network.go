@@ -3,9 +3,12 @@ package cnns
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 
 	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -13,6 +16,7 @@ import (
 type NetJSON struct {
 	Network    *NetworkJSON    `json:"network"`
 	Parameters *LearningParams `json:"parameters"`
+	Loss       *LossJSON       `json:"loss,omitempty"`
 }
 
 // NetworkJSON JSON representation of networks' layers
@@ -26,6 +30,10 @@ type NetLayerJSON struct {
 	InputSize  *tensor.TDsize   `json:"input_size"`
 	Parameters *LayerParamsJSON `json:"parameters"`
 	Weights    []*NestedData    `json:"weights"`
+	// Biases are optional (files created before biases have been introduced do not have them)
+	Biases *NestedData `json:"biases,omitempty"`
+	// Activation is name of registered activation function (files without it have been created with tanh, which was the only option to restore)
+	Activation string `json:"activation,omitempty"`
 	// Actually "OutputSize" parameter is useful for fully-connected layer only
 	// There are automatic calculation of output size for other layers' types
 	OutputSize *tensor.TDsize `json:"output_size"`
@@ -33,15 +41,30 @@ type NetLayerJSON struct {
 
 // LayerParamsJSON JSON representation of layers attributes
 type LayerParamsJSON struct {
-	Stride          int    `json:"stride"`
-	KernelSize      int    `json:"kernel_size"`
-	PoolingType     string `json:"pooling_type"`
-	ZeroPaddingType string `json:"zero_padding_type"`
+	Stride          int     `json:"stride"`
+	KernelSize      int     `json:"kernel_size"`
+	PoolingType     string  `json:"pooling_type"`
+	ZeroPaddingType string  `json:"zero_padding_type"`
+	Padding         int     `json:"padding,omitempty"`
+	PaddingMode     string  `json:"padding_mode,omitempty"`
+	DropoutRate     float64 `json:"dropout_rate,omitempty"`
+	Alpha           float64 `json:"alpha,omitempty"`
+	NormType        string  `json:"norm_type,omitempty"`
+	Momentum        float64 `json:"momentum,omitempty"`
+	Epsilon         float64 `json:"epsilon,omitempty"`
+	// KernelLayout is layout of convolutional kernels. Files without it could have been created with multi-channel kernels stored as (kernel_size*kernel_size) x channels matrix,
+	// so such kernels are accepted only if their shapes are stored (single-channel kernels are the same in both layouts)
+	KernelLayout string `json:"kernel_layout,omitempty"`
 }
 
+// kernelLayoutStackedChannels Layout of convolutional kernel: channels of kernel are stacked vertically, so kernel is (kernel_size*channels) x kernel_size matrix
+const kernelLayoutStackedChannels = "stacked_channels"
+
 // NestedData JSON representation of stored data
 type NestedData struct {
-	Data []float64 `json:"data"`
+	// Shape is [rows, cols] of stored matrix (files created before shapes have been introduced do not have it)
+	Shape []int     `json:"shape,omitempty"`
+	Data  []float64 `json:"data"`
 }
 
 // ImportFromFile Load network to file
@@ -52,19 +75,65 @@ type NestedData struct {
 		false: weights from files for using network (or continue training))
 */
 func (wh *WholeNet) ImportFromFile(fname string, randomWeights bool) error {
-	var err error
-	fileBytes, err := ioutil.ReadFile(fname)
+	file, err := os.Open(fname)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+	_, err = wh.importFrom(file, randomWeights)
+	return err
+}
+
+// Import Load network from JSON provided by reader (e.g. embedded file, HTTP request body, gzip.Reader). Reader is read until EOF
+/*
+	r - source
+	randomWeights - see ImportFromFile()
+*/
+func (wh *WholeNet) Import(r io.Reader, randomWeights bool) error {
+	_, err := wh.importFrom(r, randomWeights)
+	return err
+}
+
+// ReadFrom Load network with its weights from JSON provided by reader. Reader is read until EOF. It implements io.ReaderFrom
+/*
+	r - source
+
+	Returns number of read bytes
+*/
+func (wh *WholeNet) ReadFrom(r io.Reader) (int64, error) {
+	return wh.importFrom(r, false)
+}
+
+// importFrom Load network from JSON provided by reader. Returns number of read bytes
+func (wh *WholeNet) importFrom(r io.Reader, randomWeights bool) (int64, error) {
+	dataBytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(dataBytes)), errors.Wrap(err, "Can't read network")
+	}
 	var data NetJSON
-	err = json.Unmarshal(fileBytes, &data)
+	err = json.Unmarshal(dataBytes, &data)
 	if err != nil {
-		return err
+		return int64(len(dataBytes)), errors.Wrap(err, "Can't unmarshal network")
+	}
+	return int64(len(dataBytes)), wh.fromJSON(&data, randomWeights)
+}
+
+// fromJSON Make network from its JSON representation. Existing layers of network are replaced
+/*
+	data - JSON representation of network
+	randomWeights - see ImportFromFile()
+*/
+func (wh *WholeNet) fromJSON(data *NetJSON, randomWeights bool) error {
+	var err error
+	if data.Network == nil {
+		return fmt.Errorf("There is no network description in JSON")
 	}
-	// @todo Need to handle case when wh.Layers is not empty slice
 	wh.Layers = []Layer{}
 	for i := range data.Network.Layers {
+		err = validateLayerJSON(i, data.Network.Layers[i])
+		if err != nil {
+			return err
+		}
 		switch data.Network.Layers[i].LayerType {
 		case "conv":
 			stride := data.Network.Layers[i].Parameters.Stride
@@ -73,12 +142,28 @@ func (wh *WholeNet) ImportFromFile(fname string, randomWeights bool) error {
 			x := data.Network.Layers[i].InputSize.X
 			y := data.Network.Layers[i].InputSize.Y
 			z := data.Network.Layers[i].InputSize.Z
-			conv := NewConvLayer(&tensor.TDsize{X: x, Y: y, Z: z}, stride, kernelSize, numOfFilters)
+			options := []LayerOption{}
+			if data.Network.Layers[i].Biases != nil {
+				options = append(options, WithBias())
+			}
+			// Files without padding have been created with "valid" convolution
+			if data.Network.Layers[i].Parameters.Padding > 0 {
+				options = append(options, WithPaddingSize(data.Network.Layers[i].Parameters.Padding))
+				options = append(options, WithPaddingMode(data.Network.Layers[i].Parameters.PaddingMode))
+			}
+			conv := NewConvLayer(&tensor.TDsize{X: x, Y: y, Z: z}, stride, kernelSize, numOfFilters, options...)
+			err = validateWeightsJSON(i, data.Network.Layers[i], conv, randomWeights)
+			if err != nil {
+				return err
+			}
 			if randomWeights == false {
 				weights := make([]*mat.Dense, numOfFilters)
 				for w := 0; w < numOfFilters; w++ {
 					weights[w] = mat.NewDense(kernelSize*z, kernelSize, data.Network.Layers[i].Weights[w].Data)
 				}
+				if data.Network.Layers[i].Biases != nil {
+					weights = append(weights, mat.NewDense(numOfFilters, 1, data.Network.Layers[i].Biases.Data))
+				}
 				conv.SetCustomWeights(weights)
 			}
 			wh.Layers = append(wh.Layers, conv)
@@ -90,6 +175,83 @@ func (wh *WholeNet) ImportFromFile(fname string, randomWeights bool) error {
 			relu := NewReLULayer(&tensor.TDsize{X: x, Y: y, Z: z})
 			wh.Layers = append(wh.Layers, relu)
 			break
+		case "leaky_relu":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			leaky := NewLeakyReLULayer(&tensor.TDsize{X: x, Y: y, Z: z}, data.Network.Layers[i].Parameters.Alpha)
+			wh.Layers = append(wh.Layers, leaky)
+			break
+		case "prelu":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			prelu := NewPReLULayer(&tensor.TDsize{X: x, Y: y, Z: z})
+			err = validateWeightsJSON(i, data.Network.Layers[i], prelu, randomWeights)
+			if err != nil {
+				return err
+			}
+			if randomWeights == false {
+				prelu.SetCustomWeights([]*mat.Dense{mat.NewDense(z, 1, data.Network.Layers[i].Weights[0].Data)})
+			}
+			wh.Layers = append(wh.Layers, prelu)
+			break
+		case "elu":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			elu := NewELULayer(&tensor.TDsize{X: x, Y: y, Z: z}, data.Network.Layers[i].Parameters.Alpha)
+			wh.Layers = append(wh.Layers, elu)
+			break
+		case "selu":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			selu := NewSELULayer(&tensor.TDsize{X: x, Y: y, Z: z})
+			wh.Layers = append(wh.Layers, selu)
+			break
+		case "gelu":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			gelu := NewGELULayer(&tensor.TDsize{X: x, Y: y, Z: z})
+			wh.Layers = append(wh.Layers, gelu)
+			break
+		case "softmax":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			softmax := NewSoftmaxLayer(&tensor.TDsize{X: x, Y: y, Z: z})
+			wh.Layers = append(wh.Layers, softmax)
+			break
+		case "dropout":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			dropout := NewDropoutLayer(&tensor.TDsize{X: x, Y: y, Z: z}, data.Network.Layers[i].Parameters.DropoutRate)
+			wh.Layers = append(wh.Layers, dropout)
+			break
+		case "batchnorm":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			batchnorm := NewBatchNormLayer(&tensor.TDsize{X: x, Y: y, Z: z}, data.Network.Layers[i].Parameters.NormType)
+			batchnorm.(*BatchNormLayer).Momentum = data.Network.Layers[i].Parameters.Momentum
+			batchnorm.(*BatchNormLayer).Epsilon = data.Network.Layers[i].Parameters.Epsilon
+			err = validateWeightsJSON(i, data.Network.Layers[i], batchnorm, randomWeights)
+			if err != nil {
+				return err
+			}
+			if randomWeights == false {
+				// γ, β, running mean and running variance
+				weights := make([]*mat.Dense, len(data.Network.Layers[i].Weights))
+				for w := range weights {
+					weights[w] = mat.NewDense(len(data.Network.Layers[i].Weights[w].Data), 1, data.Network.Layers[i].Weights[w].Data)
+				}
+				batchnorm.SetCustomWeights(weights)
+			}
+			wh.Layers = append(wh.Layers, batchnorm)
+			break
 		case "pool":
 			stride := data.Network.Layers[i].Parameters.Stride
 			kernelSize := data.Network.Layers[i].Parameters.KernelSize
@@ -99,15 +261,39 @@ func (wh *WholeNet) ImportFromFile(fname string, randomWeights bool) error {
 			pool := NewPoolingLayer(&tensor.TDsize{X: x, Y: y, Z: z}, stride, kernelSize, data.Network.Layers[i].Parameters.PoolingType, data.Network.Layers[i].Parameters.ZeroPaddingType)
 			wh.Layers = append(wh.Layers, pool)
 			break
+		case "global_pool":
+			x := data.Network.Layers[i].InputSize.X
+			y := data.Network.Layers[i].InputSize.Y
+			z := data.Network.Layers[i].InputSize.Z
+			globalPool := NewGlobalPoolingLayer(&tensor.TDsize{X: x, Y: y, Z: z}, data.Network.Layers[i].Parameters.PoolingType)
+			wh.Layers = append(wh.Layers, globalPool)
+			break
 		case "fc":
 			x := data.Network.Layers[i].InputSize.X
 			y := data.Network.Layers[i].InputSize.Y
 			z := data.Network.Layers[i].InputSize.Z
 			outSize := data.Network.Layers[i].OutputSize.X
-			fullyconnected := NewFullyConnectedLayer(&tensor.TDsize{X: x, Y: y, Z: z}, outSize)
+			options := []LayerOption{}
+			if data.Network.Layers[i].Biases != nil {
+				options = append(options, WithBias())
+			}
+			fullyconnected := NewFullyConnectedLayer(&tensor.TDsize{X: x, Y: y, Z: z}, outSize, options...)
+			if data.Network.Layers[i].Activation != "" {
+				err = fullyconnected.(*FullyConnectedLayer).SetActivation(data.Network.Layers[i].Activation)
+				if err != nil {
+					return err
+				}
+			}
+			err = validateWeightsJSON(i, data.Network.Layers[i], fullyconnected, randomWeights)
+			if err != nil {
+				return err
+			}
 			if randomWeights == false {
-				weights := mat.NewDense(outSize, x*y*z, data.Network.Layers[i].Weights[0].Data)
-				fullyconnected.SetCustomWeights([]*mat.Dense{weights})
+				weights := []*mat.Dense{mat.NewDense(outSize, x*y*z, data.Network.Layers[i].Weights[0].Data)}
+				if data.Network.Layers[i].Biases != nil {
+					weights = append(weights, mat.NewDense(outSize, 1, data.Network.Layers[i].Biases.Data))
+				}
+				fullyconnected.SetCustomWeights(weights)
 			}
 			wh.Layers = append(wh.Layers, fullyconnected)
 			break
@@ -117,8 +303,112 @@ func (wh *WholeNet) ImportFromFile(fname string, randomWeights bool) error {
 		}
 	}
 
+	if wh.LP == nil {
+		wh.LP = NewLearningParametersDefault()
+	}
+	if data.Parameters == nil {
+		data.Parameters = NewLearningParametersDefault()
+	}
 	wh.LP.LearningRate = data.Parameters.LearningRate
 	wh.LP.Momentum = data.Parameters.Momentum
+	wh.LP.L2Decay = data.Parameters.L2Decay
+	wh.LP.L1Decay = data.Parameters.L1Decay
+	wh.LP.DecayBiases = data.Parameters.DecayBiases
+	wh.LP.BatchSize = data.Parameters.BatchSize
+	wh.LP.Optimizer = data.Parameters.Optimizer
+
+	// Files without loss section have been created with MSE (which was the only option)
+	wh.Loss = NewLossMSE()
+	if data.Loss != nil {
+		wh.Loss, err = lossFromJSON(data.Loss)
+		if err != nil {
+			return err
+		}
+	}
 
 	return err
 }
+
+// validateLayerJSON Check that description of layer has all parameters needed to create layer
+func validateLayerJSON(index int, layer *NetLayerJSON) error {
+	if layer == nil {
+		return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d: there is no description", index)
+	}
+	if layer.InputSize == nil || layer.InputSize.X <= 0 || layer.InputSize.Y <= 0 || layer.InputSize.Z <= 0 {
+		return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): input size should be positive, but got %v", index, layer.LayerType, layer.InputSize)
+	}
+	switch layer.LayerType {
+	case "conv", "pool":
+		if layer.Parameters == nil {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): there are no parameters", index, layer.LayerType)
+		}
+		if layer.Parameters.KernelSize <= 0 || layer.Parameters.Stride <= 0 {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): kernel size and stride should be positive, but got %d and %d", index, layer.LayerType, layer.Parameters.KernelSize, layer.Parameters.Stride)
+		}
+		if layer.LayerType != "conv" {
+			break
+		}
+		if len(layer.Weights) == 0 {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): there are no kernels", index, layer.LayerType)
+		}
+		if layer.Parameters.KernelLayout != "" && layer.Parameters.KernelLayout != kernelLayoutStackedChannels {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): kernel layout '%s' is not supported. Use '%s'", index, layer.LayerType, layer.Parameters.KernelLayout, kernelLayoutStackedChannels)
+		}
+		break
+	case "leaky_relu", "elu", "dropout", "batchnorm", "global_pool":
+		if layer.Parameters == nil {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): there are no parameters", index, layer.LayerType)
+		}
+		break
+	case "fc":
+		if layer.OutputSize == nil || layer.OutputSize.X <= 0 {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): output size should be positive, but got %v", index, layer.LayerType, layer.OutputSize)
+		}
+		break
+	default:
+		break
+	}
+	return nil
+}
+
+// validateWeightsJSON Check that stored weights fit layer created from description: amount of tensors, their shapes and amount of values
+/*
+	index - index of layer in network
+	data - description of layer
+	layer - layer created from description (with weights of expected shapes)
+	randomWeights - only amount of tensors is checked if true (values are not used)
+*/
+func validateWeightsJSON(index int, data *NetLayerJSON, layer Layer, randomWeights bool) error {
+	paramsLayer, ok := layer.(parametersLayer)
+	if !ok {
+		return nil
+	}
+	expected := paramsLayer.trainableParameters()
+	tensors := layerTensors(data)
+	if len(tensors) != len(expected) {
+		return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): expected %d tensors of weights (including biases), but got %d", index, data.LayerType, len(expected), len(tensors))
+	}
+	if randomWeights {
+		return nil
+	}
+	if data.LayerType == "conv" && data.Parameters.KernelLayout == "" && data.InputSize.Z > 1 {
+		for k := range data.Weights {
+			if data.Weights[k] != nil && len(data.Weights[k].Shape) == 0 {
+				return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): kernel #%d of %d channels has neither layout nor shape, so it could be stored in (kernel_size*kernel_size) x channels layout which is not supported anymore", index, data.LayerType, k, data.InputSize.Z)
+			}
+		}
+	}
+	for t := range expected {
+		rows, cols := expected[t].Dims()
+		if tensors[t] == nil {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): tensor #%d has no data", index, data.LayerType, t)
+		}
+		if len(tensors[t].Shape) != 0 && (len(tensors[t].Shape) != 2 || tensors[t].Shape[0] != rows || tensors[t].Shape[1] != cols) {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): tensor #%d should have shape [%d %d], but got %v", index, data.LayerType, t, rows, cols, tensors[t].Shape)
+		}
+		if len(tensors[t].Data) != rows*cols {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s): tensor #%d should have %d values (%dx%d), but got %d", index, data.LayerType, t, rows*cols, rows, cols, len(tensors[t].Data))
+		}
+	}
+	return nil
+}
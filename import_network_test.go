@@ -0,0 +1,671 @@
+package cnns
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestExportImportBiases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	conv := NewConvLayer(&tensor.TDsize{X: 5, Y: 5, Z: 1}, 1, 3, 2, WithBias())
+	conv.(*ConvLayer).Biases.Set(1, 0, 0.25)
+	fc := NewFullyConnectedLayer(conv.GetOutputSize(), 2, WithBias())
+	fc.(*FullyConnectedLayer).Biases.Set(0, 0, -0.75)
+	net := WholeNet{
+		Layers: []Layer{conv, fc},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	importedConv := imported.Layers[0].(*ConvLayer)
+	if importedConv.Biases == nil || importedConv.Biases.At(1, 0) != 0.25 {
+		t.Errorf("Biases of convolutional layer have not been restored")
+	}
+	importedFC := imported.Layers[1].(*FullyConnectedLayer)
+	if importedFC.Biases == nil || importedFC.Biases.At(0, 0) != -0.75 {
+		t.Errorf("Biases of fully-connected layer have not been restored")
+	}
+}
+
+func TestImportWithoutBiases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	// Layout of files created before biases have been introduced
+	old := `{"network":{"layers":[{"layer_type":"fc","input_size":{"X":2,"Y":1,"Z":1},"parameters":null,"weights":[{"data":[0.1,0.2,0.3,0.4]}],"output_size":{"X":2,"Y":1,"Z":1}}]},"parameters":{"learning_rate":0.01,"momentum":0.6}}`
+	err = ioutil.WriteFile(fname, []byte(old), 0644)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if imported.Layers[0].(*FullyConnectedLayer).Biases != nil {
+		t.Errorf("Fully-connected layer should not have biases")
+	}
+	if len(imported.Layers[0].GetWeights()) != 1 {
+		t.Errorf("Fully-connected layer should have 1 array of weights, but got %d", len(imported.Layers[0].GetWeights()))
+	}
+}
+
+func TestExportImportDropout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 4, Y: 1, Z: 1}, 3)
+	dropout := NewDropoutLayer(fc.GetOutputSize(), 0.3)
+	net := WholeNet{
+		Layers: []Layer{fc, dropout},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	importedDropout, ok := imported.Layers[1].(*DropoutLayer)
+	if !ok {
+		t.Errorf("Second layer should be dropout layer, but got %s", imported.Layers[1].GetType())
+		return
+	}
+	if importedDropout.Rate != 0.3 {
+		t.Errorf("Dropout rate should be %f, but got %f", 0.3, importedDropout.Rate)
+	}
+}
+
+func TestExportImportBatchNorm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	bn := NewBatchNormLayer(&tensor.TDsize{X: 3, Y: 3, Z: 2}, "channel")
+	bn.(*BatchNormLayer).Momentum = 0.8
+	weights := bn.GetWeights()
+	for w := range weights {
+		weights[w].Set(1, 0, float64(w+2))
+	}
+	net := WholeNet{
+		Layers: []Layer{bn},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	importedBN, ok := imported.Layers[0].(*BatchNormLayer)
+	if !ok {
+		t.Errorf("Layer should be batch normalization layer, but got %s", imported.Layers[0].GetType())
+		return
+	}
+	if importedBN.NormType != batchNormCHANNEL || importedBN.Momentum != 0.8 || importedBN.Epsilon != 1e-5 {
+		t.Errorf("Parameters of batch normalization layer have not been restored")
+	}
+	for w, importedWeights := range importedBN.GetWeights() {
+		if !mat.Equal(importedWeights, weights[w]) {
+			t.Errorf("Array #%d of batch normalization layer should be %v, but got %v", w, weights[w].RawMatrix().Data, importedWeights.RawMatrix().Data)
+		}
+	}
+}
+
+func TestExportImportPadding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	conv := NewConvLayer(&tensor.TDsize{X: 6, Y: 6, Z: 1}, 1, 3, 2, WithPadding("same"), WithPaddingMode("reflect"))
+	net := WholeNet{
+		Layers: []Layer{conv},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	importedConv := imported.Layers[0].(*ConvLayer)
+	if importedConv.Padding != 1 || importedConv.PaddingMode != paddingREFLECT {
+		t.Errorf("Padding should be 1 (reflect), but got %d (%s)", importedConv.Padding, importedConv.PaddingMode)
+	}
+	if importedConv.GetOutputSize().X != 6 || importedConv.GetOutputSize().Y != 6 {
+		t.Errorf("Output size should be 6x6, but got %dx%d", importedConv.GetOutputSize().X, importedConv.GetOutputSize().Y)
+	}
+}
+
+func TestExportImportRectifiers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	inSize := &tensor.TDsize{X: 3, Y: 3, Z: 2}
+	prelu := NewPReLULayer(inSize)
+	prelu.SetCustomWeights([]*mat.Dense{mat.NewDense(2, 1, []float64{0.1, 0.3})})
+	net := WholeNet{
+		Layers: []Layer{
+			NewLeakyReLULayer(inSize, 0.02),
+			prelu,
+			NewELULayer(inSize, 0.5),
+			NewSELULayer(inSize),
+			NewGELULayer(inSize),
+		},
+		LP: NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := range net.Layers {
+		if imported.Layers[i].GetType() != net.Layers[i].GetType() {
+			t.Errorf("Layer #%d should be of type '%s', but got '%s'", i, net.Layers[i].GetType(), imported.Layers[i].GetType())
+		}
+	}
+	if imported.Layers[0].(*LeakyReLULayer).Alpha != 0.02 {
+		t.Errorf("Slope of leaky ReLU layer should be %f, but got %f", 0.02, imported.Layers[0].(*LeakyReLULayer).Alpha)
+	}
+	if !mat.Equal(imported.Layers[1].(*PReLULayer).Slopes, prelu.(*PReLULayer).Slopes) {
+		t.Errorf("Slopes of PReLU layer have not been restored")
+	}
+	if imported.Layers[2].(*ELULayer).Alpha != 0.5 {
+		t.Errorf("α of ELU layer should be %f, but got %f", 0.5, imported.Layers[2].(*ELULayer).Alpha)
+	}
+}
+
+func TestExportImportActivation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	fc1 := NewFullyConnectedLayer(&tensor.TDsize{X: 2, Y: 1, Z: 1}, 3)
+	fc1.SetActivationFunc(ActivationSygmoid)
+	fc1.SetActivationDerivativeFunc(ActivationSygmoidDerivative)
+	fc2 := NewFullyConnectedLayer(fc1.GetOutputSize(), 1)
+	err = fc2.(*FullyConnectedLayer).SetActivation("relu")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	net := WholeNet{
+		Layers: []Layer{fc1, fc2},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := WholeNet{LP: NewLearningParametersDefault()}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []string{"sigmoid", "relu"}
+	for i := range imported.Layers {
+		name := imported.Layers[i].(*FullyConnectedLayer).GetActivationName()
+		if name != correct[i] {
+			t.Errorf("Activation function of layer #%d should be '%s', but got '%s'", i, correct[i], name)
+		}
+	}
+
+	// Activation function which is not registered is saved as default one
+	fc2.SetActivationFunc(func(v float64) float64 { return v })
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = imported.ImportFromFile(fname, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if name := imported.Layers[1].(*FullyConnectedLayer).GetActivationName(); name != "tanh" {
+		t.Errorf("Not registered activation function should be restored as 'tanh', but got '%s'", name)
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	conv := NewConvLayer(&tensor.TDsize{X: 5, Y: 5, Z: 1}, 1, 3, 2, WithBias())
+	fc := NewFullyConnectedLayer(conv.GetOutputSize(), 2, WithBias())
+	fc.(*FullyConnectedLayer).ActivationFunc = ActivationTanh
+	fc.(*FullyConnectedLayer).ActivationDerivative = ActivationTanhDerivative
+	net := WholeNet{
+		Layers: []Layer{conv, fc},
+		LP:     NewLearningParametersDefault(),
+	}
+	input := mat.NewDense(5, 5, []float64{
+		0.1, 0.2, 0.3, 0.4, 0.5,
+		0.6, 0.7, 0.8, 0.9, 1.0,
+		-0.1, -0.2, -0.3, -0.4, -0.5,
+		0.5, 0.4, 0.3, 0.2, 0.1,
+		0.0, 0.1, 0.0, 0.1, 0.0,
+	})
+	expected, err := net.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := net.WriteTo(buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo() should report %d written bytes, but got %d", buf.Len(), n)
+	}
+	imported := WholeNet{}
+	n, err = imported.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("ReadFrom() should report %d read bytes, but got %d", buf.Len(), n)
+	}
+	output, err := imported.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(expected, output) {
+		t.Errorf("Output of network restored from buffer should be\n%v\nbut got\n%v", mat.Formatted(expected), mat.Formatted(output))
+	}
+
+	// Same network through gzip
+	compressed := &bytes.Buffer{}
+	zw := gzip.NewWriter(compressed)
+	err = net.Export(zw, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	zr, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	decompressed := WholeNet{}
+	err = decompressed.Import(zr, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	output, err = decompressed.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(expected, output) {
+		t.Errorf("Output of network restored from gzip stream should be\n%v\nbut got\n%v", mat.Formatted(expected), mat.Formatted(output))
+	}
+
+	// Malformed stream
+	err = (&WholeNet{}).Import(bytes.NewReader([]byte("{not json")), false)
+	if err == nil {
+		t.Errorf("Import() should fail on malformed JSON")
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	nets := map[string]*Sequential{
+		"multi-channel conv": NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 3}).
+			Conv(3, 4, 1, WithBias(), WithRand(r), WithPadding("same"), WithPaddingMode("reflect")).
+			BatchNorm("channel").
+			PReLU().
+			MaxPool(2, 2).
+			Conv(2, 2, 2, WithRand(r)).
+			Dropout(0.3).
+			Dense(3, WithBias(), WithRand(r)).
+			Softmax(),
+		"rectifiers": NewSequential(&tensor.TDsize{X: 6, Y: 6, Z: 2}).
+			Conv(3, 3, 1, WithRand(r)).
+			LeakyReLU(0.1).
+			ELU(0.7).
+			SELU().
+			GELU().
+			ReLU().
+			AvgPool(2, 2).
+			GlobalPool("max").
+			Dense(4, WithRand(r)).
+			Activation("sigmoid").
+			BatchNorm("feature").
+			Dense(2, WithBias(), WithRand(r)),
+	}
+	for name, seq := range nets {
+		net, err := seq.Build()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		size := net.Layers[0].GetInputSize()
+		input := mat.NewDense(size.X*size.Z, size.Y, nil)
+		for i := range input.RawMatrix().Data {
+			input.RawMatrix().Data[i] = r.NormFloat64()
+		}
+		expected, err := net.Predict(input)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		jsonBuf := &bytes.Buffer{}
+		err = net.Export(jsonBuf, true)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		binaryBuf := &bytes.Buffer{}
+		err = net.ExportBinary(binaryBuf, true)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		fromJSON := &WholeNet{}
+		err = fromJSON.Import(jsonBuf, false)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		fromBinary := &WholeNet{}
+		err = fromBinary.ImportBinary(binaryBuf, false)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		for format, imported := range map[string]*WholeNet{"JSON": fromJSON, "binary": fromBinary} {
+			if len(imported.Layers) != len(net.Layers) {
+				t.Errorf("%s (%s): number of layers should be %d, but got %d", name, format, len(net.Layers), len(imported.Layers))
+				continue
+			}
+			for l := range net.Layers {
+				if imported.Layers[l].GetType() != net.Layers[l].GetType() {
+					t.Errorf("%s (%s): type of layer #%d should be '%s', but got '%s'", name, format, l, net.Layers[l].GetType(), imported.Layers[l].GetType())
+				}
+				if *imported.Layers[l].GetOutputSize() != *net.Layers[l].GetOutputSize() {
+					t.Errorf("%s (%s): output size of layer #%d should be %v, but got %v", name, format, l, net.Layers[l].GetOutputSize(), imported.Layers[l].GetOutputSize())
+				}
+				params, ok := net.Layers[l].(parametersLayer)
+				if !ok {
+					continue
+				}
+				importedParams := imported.Layers[l].(parametersLayer).trainableParameters()
+				for p, expectedParams := range params.trainableParameters() {
+					if !mat.Equal(expectedParams, importedParams[p]) {
+						t.Errorf("%s (%s): tensor #%d of layer #%d has not been restored", name, format, p, l)
+					}
+				}
+			}
+			output, err := imported.Predict(input)
+			if err != nil {
+				t.Errorf("%s (%s): %v", name, format, err)
+				continue
+			}
+			if !mat.Equal(expected, output) {
+				t.Errorf("%s (%s): output should be\n%v\nbut got\n%v", name, format, mat.Formatted(expected), mat.Formatted(output))
+			}
+		}
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 5, Y: 5, Z: 2}).
+		Conv(3, 2, 1, WithBias()).
+		PReLU().
+		Dense(2).
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	save, err := net.toJSON(true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conv := save.Network.Layers[0]
+	if conv.Parameters.KernelLayout != kernelLayoutStackedChannels {
+		t.Errorf("Kernel layout should be '%s', but got '%s'", kernelLayoutStackedChannels, conv.Parameters.KernelLayout)
+	}
+	if len(conv.Weights[0].Shape) != 2 || conv.Weights[0].Shape[0] != 6 || conv.Weights[0].Shape[1] != 3 {
+		t.Errorf("Shape of kernel should be [6 3], but got %v", conv.Weights[0].Shape)
+	}
+
+	cases := map[string]func(data *NetJSON){
+		"kernel values": func(data *NetJSON) {
+			data.Network.Layers[0].Weights[1].Data = data.Network.Layers[0].Weights[1].Data[1:]
+		},
+		"kernel shape": func(data *NetJSON) {
+			data.Network.Layers[0].Weights[0].Shape = []int{9, 2}
+		},
+		"kernel layout": func(data *NetJSON) {
+			data.Network.Layers[0].Parameters.KernelLayout = "interleaved"
+		},
+		"biases": func(data *NetJSON) {
+			data.Network.Layers[0].Biases.Data = append(data.Network.Layers[0].Biases.Data, 1)
+		},
+		"prelu slopes": func(data *NetJSON) {
+			data.Network.Layers[1].Weights = nil
+		},
+		"fc weights": func(data *NetJSON) {
+			data.Network.Layers[2].Weights = append(data.Network.Layers[2].Weights, &NestedData{})
+		},
+		"fc output size": func(data *NetJSON) {
+			data.Network.Layers[2].OutputSize = nil
+		},
+		"input size": func(data *NetJSON) {
+			data.Network.Layers[1].InputSize = nil
+		},
+	}
+	for name, corrupt := range cases {
+		data, err := net.toJSON(true)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		corrupt(data)
+		err = (&WholeNet{}).fromJSON(data, false)
+		if errors.Cause(err) != ErrInvalidLayerConfiguration {
+			t.Errorf("Corrupted %s should cause invalid configuration error, but got: %v", name, err)
+		}
+	}
+
+	// Files created before kernel layout has been introduced: multi-channel kernels are accepted only with shapes
+	legacy, err := net.toJSON(true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	legacy.Network.Layers[0].Parameters.KernelLayout = ""
+	imported := WholeNet{}
+	err = imported.fromJSON(legacy, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(imported.Layers[0].(*ConvLayer).Kernels[1], net.Layers[0].(*ConvLayer).Kernels[1]) {
+		t.Errorf("Kernels from file without layout have not been restored")
+	}
+	for _, weights := range legacy.Network.Layers[0].Weights {
+		weights.Shape = nil
+	}
+	err = (&WholeNet{}).fromJSON(legacy, false)
+	if errors.Cause(err) != ErrInvalidLayerConfiguration {
+		t.Errorf("Multi-channel kernels without layout and shapes should cause invalid configuration error, but got: %v", err)
+	}
+
+	// Single-channel kernels are the same in every layout
+	single, err := NewSequential(&tensor.TDsize{X: 5, Y: 5, Z: 1}).Conv(3, 2, 1).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	legacy, err = single.toJSON(true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	legacy.Network.Layers[0].Parameters.KernelLayout = ""
+	for _, weights := range legacy.Network.Layers[0].Weights {
+		weights.Shape = nil
+	}
+	imported = WholeNet{}
+	err = imported.fromJSON(legacy, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(imported.Layers[0].(*ConvLayer).Kernels[1], single.Layers[0].(*ConvLayer).Kernels[1]) {
+		t.Errorf("Single-channel kernels from file without layout and shapes have not been restored")
+	}
+}
+
+// unknownLayer Layer which can't be exported
+type unknownLayer struct {
+	Layer
+}
+
+func (layer *unknownLayer) GetType() string {
+	return "unknown"
+}
+
+func TestExportToFileKeepsFileOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.json")
+
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1}, 2)
+	net := WholeNet{
+		Layers: []Layer{fc},
+		LP:     NewLearningParametersDefault(),
+	}
+	err = net.ExportToFile(fname, true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	saved, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	net.Layers = append(net.Layers, &unknownLayer{NewReLULayer(fc.GetOutputSize())})
+	err = net.ExportToFile(fname, true)
+	if err == nil {
+		t.Errorf("Export of unknown layer should cause error")
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(saved, data) {
+		t.Errorf("Failed export should keep existing file")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(files) != 1 {
+		t.Errorf("Failed export should not leave temporary files, but there are %d files", len(files))
+	}
+}
@@ -0,0 +1,305 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initializer Interface for weights initialization strategies
+type Initializer interface {
+	// Init Fill weights with initial values
+	/*
+		weights - parameters of layer
+		fanIn - number of inputs of single neuron (e.g. kernelSize*kernelSize*channels for convolutional layer)
+		fanOut - number of outputs of single input (e.g. kernelSize*kernelSize*filters for convolutional layer)
+		r - source of randomness. If it is nil then global source from math/rand is used
+	*/
+	Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand)
+
+	// GetType Returns type of initializer in string representation
+	GetType() string
+}
+
+// randFloat64 Returns pseudo-random number in [0.0,1.0) from provided source (or from global one)
+func randFloat64(r *rand.Rand) float64 {
+	if r != nil {
+		return r.Float64()
+	}
+	return rand.Float64()
+}
+
+// randNormFloat64 Returns normally distributed number (mean = 0, stddev = 1) from provided source (or from global one)
+func randNormFloat64(r *rand.Rand) float64 {
+	if r != nil {
+		return r.NormFloat64()
+	}
+	return rand.NormFloat64()
+}
+
+// fillUniform Fill weights with values uniformly distributed in [low; high)
+func fillUniform(weights *mat.Dense, low, high float64, r *rand.Rand) {
+	rows, cols := weights.Dims()
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			weights.Set(i, j, low+(high-low)*randFloat64(r))
+		}
+	}
+}
+
+// fillNormal Fill weights with normally distributed values
+func fillNormal(weights *mat.Dense, mean, stddev float64, r *rand.Rand) {
+	rows, cols := weights.Dims()
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			weights.Set(i, j, mean+stddev*randNormFloat64(r))
+		}
+	}
+}
+
+// InitializerUniform Values are uniformly distributed in [Low; High)
+type InitializerUniform struct {
+	Low  float64
+	High float64
+}
+
+// NewInitializerUniform Constructor for uniform initializer
+/*
+	low - lower bound (inclusive)
+	high - upper bound (exclusive)
+*/
+func NewInitializerUniform(low, high float64) Initializer {
+	return &InitializerUniform{Low: low, High: high}
+}
+
+// newInitializerDefault Returns default initializer: uniform in [-0.5; 0.5)
+func newInitializerDefault() Initializer {
+	return NewInitializerUniform(-0.5, 0.5)
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerUniform) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	fillUniform(weights, initializer.Low, initializer.High, r)
+}
+
+// GetType Returns "uniform" as initializer's type
+func (initializer *InitializerUniform) GetType() string {
+	return "uniform"
+}
+
+// InitializerNormal Values are normally distributed with mean Mean and standard deviation StdDev
+type InitializerNormal struct {
+	Mean   float64
+	StdDev float64
+}
+
+// NewInitializerNormal Constructor for normal initializer
+/*
+	mean - mean of distribution
+	stddev - standard deviation of distribution
+*/
+func NewInitializerNormal(mean, stddev float64) Initializer {
+	return &InitializerNormal{Mean: mean, StdDev: stddev}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerNormal) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	fillNormal(weights, initializer.Mean, initializer.StdDev, r)
+}
+
+// GetType Returns "normal" as initializer's type
+func (initializer *InitializerNormal) GetType() string {
+	return "normal"
+}
+
+// InitializerXavier Xavier (Glorot) initialization. See ref. http://proceedings.mlr.press/v9/glorot10a/glorot10a.pdf
+/*
+	Uniform: U(-sqrt(6/(fanIn+fanOut)); sqrt(6/(fanIn+fanOut)))
+	Normal: N(0, sqrt(2/(fanIn+fanOut)))
+*/
+type InitializerXavier struct {
+	Normal bool
+}
+
+// NewInitializerXavierUniform Constructor for Xavier (Glorot) initializer with uniform distribution
+func NewInitializerXavierUniform() Initializer {
+	return &InitializerXavier{Normal: false}
+}
+
+// NewInitializerXavierNormal Constructor for Xavier (Glorot) initializer with normal distribution
+func NewInitializerXavierNormal() Initializer {
+	return &InitializerXavier{Normal: true}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerXavier) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	if initializer.Normal {
+		fillNormal(weights, 0, math.Sqrt(2.0/float64(fanIn+fanOut)), r)
+		return
+	}
+	limit := math.Sqrt(6.0 / float64(fanIn+fanOut))
+	fillUniform(weights, -limit, limit, r)
+}
+
+// GetType Returns "xavier_uniform" or "xavier_normal" as initializer's type
+func (initializer *InitializerXavier) GetType() string {
+	if initializer.Normal {
+		return "xavier_normal"
+	}
+	return "xavier_uniform"
+}
+
+// InitializerHe He (Kaiming) initialization, suitable for ReLU-like activations. See ref. https://arxiv.org/abs/1502.01852
+/*
+	Uniform: U(-sqrt(6/fanIn); sqrt(6/fanIn))
+	Normal: N(0, sqrt(2/fanIn))
+*/
+type InitializerHe struct {
+	Normal bool
+}
+
+// NewInitializerHeUniform Constructor for He (Kaiming) initializer with uniform distribution
+func NewInitializerHeUniform() Initializer {
+	return &InitializerHe{Normal: false}
+}
+
+// NewInitializerHeNormal Constructor for He (Kaiming) initializer with normal distribution
+func NewInitializerHeNormal() Initializer {
+	return &InitializerHe{Normal: true}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerHe) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	if initializer.Normal {
+		fillNormal(weights, 0, math.Sqrt(2.0/float64(fanIn)), r)
+		return
+	}
+	limit := math.Sqrt(6.0 / float64(fanIn))
+	fillUniform(weights, -limit, limit, r)
+}
+
+// GetType Returns "he_uniform" or "he_normal" as initializer's type
+func (initializer *InitializerHe) GetType() string {
+	if initializer.Normal {
+		return "he_normal"
+	}
+	return "he_uniform"
+}
+
+// InitializerLeCun LeCun initialization, suitable for SELU activation
+/*
+	Uniform: U(-sqrt(3/fanIn); sqrt(3/fanIn))
+	Normal: N(0, sqrt(1/fanIn))
+*/
+type InitializerLeCun struct {
+	Normal bool
+}
+
+// NewInitializerLeCunUniform Constructor for LeCun initializer with uniform distribution
+func NewInitializerLeCunUniform() Initializer {
+	return &InitializerLeCun{Normal: false}
+}
+
+// NewInitializerLeCunNormal Constructor for LeCun initializer with normal distribution
+func NewInitializerLeCunNormal() Initializer {
+	return &InitializerLeCun{Normal: true}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerLeCun) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	if initializer.Normal {
+		fillNormal(weights, 0, math.Sqrt(1.0/float64(fanIn)), r)
+		return
+	}
+	limit := math.Sqrt(3.0 / float64(fanIn))
+	fillUniform(weights, -limit, limit, r)
+}
+
+// GetType Returns "lecun_uniform" or "lecun_normal" as initializer's type
+func (initializer *InitializerLeCun) GetType() string {
+	if initializer.Normal {
+		return "lecun_normal"
+	}
+	return "lecun_uniform"
+}
+
+// InitializerOrthogonal Orthogonal initialization: rows (or columns, whichever are fewer) of weights are orthonormal vectors multiplied by Gain. See ref. https://arxiv.org/abs/1312.6120
+type InitializerOrthogonal struct {
+	Gain float64
+}
+
+// NewInitializerOrthogonal Constructor for orthogonal initializer
+/*
+	gain - multiplier for orthonormal matrix (1.0 for linear and tanh activations, sqrt(2) for ReLU)
+*/
+func NewInitializerOrthogonal(gain float64) Initializer {
+	return &InitializerOrthogonal{Gain: gain}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerOrthogonal) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	rows, cols := weights.Dims()
+	transposed := rows < cols
+	if transposed {
+		rows, cols = cols, rows
+	}
+	// QR decomposition of random normal matrix gives orthonormal columns in Q
+	random := mat.NewDense(rows, cols, nil)
+	fillNormal(random, 0, 1, r)
+	qr := &mat.QR{}
+	qr.Factorize(random)
+	q := &mat.Dense{}
+	qr.QTo(q)
+	upper := &mat.Dense{}
+	qr.RTo(upper)
+	orthogonal := mat.NewDense(rows, cols, nil)
+	for j := 0; j < cols; j++ {
+		// Make decomposition unique (so distribution is uniform) by sign of R's diagonal
+		sign := 1.0
+		if upper.At(j, j) < 0 {
+			sign = -1.0
+		}
+		for i := 0; i < rows; i++ {
+			orthogonal.Set(i, j, initializer.Gain*sign*q.At(i, j))
+		}
+	}
+	if transposed {
+		weights.Copy(orthogonal.T())
+		return
+	}
+	weights.Copy(orthogonal)
+}
+
+// GetType Returns "orthogonal" as initializer's type
+func (initializer *InitializerOrthogonal) GetType() string {
+	return "orthogonal"
+}
+
+// InitializerConstant Every value is equal to Value
+type InitializerConstant struct {
+	Value float64
+}
+
+// NewInitializerConstant Constructor for constant initializer
+/*
+	value - value for every weight
+*/
+func NewInitializerConstant(value float64) Initializer {
+	return &InitializerConstant{Value: value}
+}
+
+// Init See Initializer.Init()
+func (initializer *InitializerConstant) Init(weights *mat.Dense, fanIn, fanOut int, r *rand.Rand) {
+	rows, cols := weights.Dims()
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			weights.Set(i, j, initializer.Value)
+		}
+	}
+}
+
+// GetType Returns "constant" as initializer's type
+func (initializer *InitializerConstant) GetType() string {
+	return "constant"
+}
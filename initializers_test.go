@@ -0,0 +1,99 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestInitializerDefault(t *testing.T) {
+	// Default initializer should keep previous behaviour: rand.Float64()-0.5
+	r := rand.New(rand.NewSource(7))
+	fc := NewFullyConnectedLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1}, 2, WithRand(rand.New(rand.NewSource(7))))
+	for i, v := range fc.GetWeights()[0].RawMatrix().Data {
+		correct := r.Float64() - 0.5
+		if v != correct {
+			t.Errorf("Weight in position %d should be %f, but got %f", i, correct, v)
+		}
+	}
+}
+
+func TestInitializers(t *testing.T) {
+	fanIn, fanOut := 200, 100
+	tests := []struct {
+		initializer Initializer
+		limit       float64
+		stddev      float64
+	}{
+		{NewInitializerUniform(-0.1, 0.3), 0.3, math.Sqrt(0.4 * 0.4 / 12)},
+		{NewInitializerNormal(0, 0.2), math.Inf(1), 0.2},
+		{NewInitializerXavierUniform(), math.Sqrt(6.0 / 300), math.Sqrt(2.0 / 300)},
+		{NewInitializerXavierNormal(), math.Inf(1), math.Sqrt(2.0 / 300)},
+		{NewInitializerHeUniform(), math.Sqrt(6.0 / 200), math.Sqrt(2.0 / 200)},
+		{NewInitializerHeNormal(), math.Inf(1), math.Sqrt(2.0 / 200)},
+		{NewInitializerLeCunUniform(), math.Sqrt(3.0 / 200), math.Sqrt(1.0 / 200)},
+		{NewInitializerLeCunNormal(), math.Inf(1), math.Sqrt(1.0 / 200)},
+	}
+	for _, test := range tests {
+		weights := mat.NewDense(fanOut, fanIn, nil)
+		test.initializer.Init(weights, fanIn, fanOut, rand.New(rand.NewSource(1)))
+		raw := weights.RawMatrix().Data
+		mean := 0.0
+		for _, v := range raw {
+			if math.Abs(v) > test.limit {
+				t.Errorf("Initializer '%s' produced %f which is out of bounds %f", test.initializer.GetType(), v, test.limit)
+				break
+			}
+			mean += v
+		}
+		mean /= float64(len(raw))
+		variance := 0.0
+		for _, v := range raw {
+			variance += (v - mean) * (v - mean)
+		}
+		stddev := math.Sqrt(variance / float64(len(raw)))
+		if math.Abs(stddev-test.stddev)/test.stddev > 0.05 {
+			t.Errorf("Standard deviation for initializer '%s' should be about %f, but got %f", test.initializer.GetType(), test.stddev, stddev)
+		}
+	}
+}
+
+func TestInitializerOrthogonal(t *testing.T) {
+	for _, dims := range [][2]int{{4, 6}, {6, 4}} {
+		weights := mat.NewDense(dims[0], dims[1], nil)
+		NewInitializerOrthogonal(2.0).Init(weights, dims[1], dims[0], rand.New(rand.NewSource(1)))
+		// Rows (or columns) are orthogonal vectors of length gain
+		product := &mat.Dense{}
+		if dims[0] < dims[1] {
+			product.Mul(weights, weights.T())
+		} else {
+			product.Mul(weights.T(), weights)
+		}
+		n, _ := product.Dims()
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				correct := 0.0
+				if i == j {
+					correct = 4.0
+				}
+				if math.Abs(product.At(i, j)-correct) > 1e-9 {
+					t.Errorf("Product of orthogonal %dx%d weights in position r = %d, c = %d should be %f, but got %f", dims[0], dims[1], i, j, correct, product.At(i, j))
+				}
+			}
+		}
+	}
+}
+
+func TestInitializerConstant(t *testing.T) {
+	conv := NewConvLayer(&tensor.TDsize{X: 5, Y: 5, Z: 1}, 1, 3, 2, WithInitializer(NewInitializerConstant(0.1)))
+	for _, kernel := range conv.GetWeights() {
+		for _, v := range kernel.RawMatrix().Data {
+			if v != 0.1 {
+				t.Errorf("Weight should be %f, but got %f", 0.1, v)
+			}
+		}
+	}
+}
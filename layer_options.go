@@ -0,0 +1,101 @@
+package cnns
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// LayerOption Optional parameter for layers' constructors. Layers ignore options which are not applicable to them
+type LayerOption func(opts *layerOptions)
+
+// layerOptions Set of optional parameters for layers' constructors
+type layerOptions struct {
+	useBias     bool
+	rand        *rand.Rand
+	initializer Initializer
+	padding     int
+	samePadding bool
+	// Value of WithPadding() which is not supported (empty if it is valid)
+	unknownPadding string
+	paddingMode    string
+}
+
+// newLayerOptions Prepare optional parameters for layer's constructor
+func newLayerOptions(options ...LayerOption) *layerOptions {
+	opts := &layerOptions{
+		useBias:     false,
+		rand:        nil,
+		initializer: newInitializerDefault(),
+		padding:     0,
+		samePadding: false,
+		paddingMode: "zero",
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// WithBias Enables trainable bias terms: per-output for fully-connected layer and per-filter for convolutional layer
+func WithBias() LayerOption {
+	return func(opts *layerOptions) {
+		opts.useBias = true
+	}
+}
+
+// WithRand Sets source of randomness for layer (e.g. for reproducible weights initialization or dropout masks). If it is not provided then global source from math/rand is used
+func WithRand(r *rand.Rand) LayerOption {
+	return func(opts *layerOptions) {
+		opts.rand = r
+	}
+}
+
+// WithInitializer Sets initialization strategy for weights of fully-connected and convolutional layers. Default is uniform distribution in [-0.5; 0.5)
+func WithInitializer(initializer Initializer) LayerOption {
+	return func(opts *layerOptions) {
+		opts.initializer = initializer
+	}
+}
+
+// WithPadding Sets padding for convolutional layer: "valid" (no padding, default) or "same"
+/*
+	Padding "same" adds (kernelSize - 1) / 2 rows and columns on each side of input, so output size is ceil(input / stride) (equal to input size for stride 1).
+	Padding is symmetric, so kernel size should be odd (Sequential.Conv() returns error for even kernel size, convolutional layer returns it from FeedForward()).
+	Other values are not supported and cause the same errors.
+	For stride > 1 it matches "same" padding of other frameworks when stride divides (input - 1), the same way Sequential.Conv() requires
+*/
+func WithPadding(padding string) LayerOption {
+	return func(opts *layerOptions) {
+		switch strings.ToLower(padding) {
+		case "same":
+			opts.samePadding = true
+			opts.unknownPadding = ""
+			break
+		case "valid":
+			opts.samePadding = false
+			opts.padding = 0
+			opts.unknownPadding = ""
+			break
+		default:
+			// Convolutional layer returns error for it (see NewConvLayer() and Sequential.Conv())
+			opts.unknownPadding = padding
+			break
+		}
+	}
+}
+
+// WithPaddingSize Sets explicit number of rows and columns added on each side of input for convolutional layer
+func WithPaddingSize(num int) LayerOption {
+	return func(opts *layerOptions) {
+		opts.samePadding = false
+		opts.padding = num
+		opts.unknownPadding = ""
+	}
+}
+
+// WithPaddingMode Sets how padded values are filled for convolutional layer: "zero" (default), "edge" or "reflect"
+func WithPaddingMode(mode string) LayerOption {
+	return func(opts *layerOptions) {
+		opts.paddingMode = mode
+	}
+}
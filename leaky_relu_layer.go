@@ -0,0 +1,158 @@
+package cnns
+
+import (
+	"fmt"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+// LeakyReLULayer Leaky Rectified Linear Unit layer (activation: x for x >= 0 and α*x for x < 0)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+	Alpha - α, slope for negative input
+*/
+type LeakyReLULayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+	Alpha      float64
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	trainMode bool
+}
+
+// NewLeakyReLULayer - Constructor for new leaky ReLU layer. You need to specify input size and slope for negative input
+/*
+	inSize - input layer's size
+	alpha - slope for negative input (e.g. 0.01)
+*/
+func NewLeakyReLULayer(inSize *tensor.TDsize, alpha float64) Layer {
+	newLayer := &LeakyReLULayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Alpha:      alpha,
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for leaky ReLU layer (make it carefully)
+func (leaky *LeakyReLULayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for leaky ReLU layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for leaky ReLU layer
+func (leaky *LeakyReLULayer) GetInputSize() *tensor.TDsize {
+	return leaky.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of leaky ReLU layer
+func (leaky *LeakyReLULayer) GetOutputSize() *tensor.TDsize {
+	return leaky.OutputSize
+}
+
+// GetActivatedOutput Returns leaky ReLU layer's output
+func (leaky *LeakyReLULayer) GetActivatedOutput() *mat.Dense {
+	return leaky.Ok
+}
+
+// GetWeights Returns leaky ReLU layer's weights
+func (leaky *LeakyReLULayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for leaky ReLU layer")
+	return nil
+}
+
+// GetGradients Returns leaky ReLU layer's gradients
+func (leaky *LeakyReLULayer) GetGradients() *mat.Dense {
+	return leaky.LocalDelta
+}
+
+// FeedForward - Feed data to leaky ReLU layer
+func (leaky *LeakyReLULayer) FeedForward(t *mat.Dense) error {
+	leaky.Oj = t
+	leaky.doActivation()
+	return nil
+}
+
+// doActivation leaky ReLU layer's output activation
+func (leaky *LeakyReLULayer) doActivation() {
+	rawOj := leaky.Oj.RawMatrix().Data
+	rawOk := leaky.Ok.RawMatrix().Data
+	for j := range rawOj {
+		if rawOj[j] < 0 {
+			rawOk[j] = leaky.Alpha * rawOj[j]
+		} else {
+			rawOk[j] = rawOj[j]
+		}
+	}
+}
+
+// CalculateGradients Evaluate leaky ReLU layer's gradients
+func (leaky *LeakyReLULayer) CalculateGradients(errorsDense *mat.Dense) error {
+	raw := leaky.Oj.RawMatrix().Data
+	rawDelta := leaky.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	for i := range raw {
+		if raw[i] < 0 {
+			rawDelta[i] = leaky.Alpha * rawErrors[i]
+		} else {
+			rawDelta[i] = rawErrors[i]
+		}
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that leaky ReLU layer does NOT updating weights
+func (leaky *LeakyReLULayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for leaky ReLU layer
+}
+
+// PrintOutput Pretty print leaky ReLU layer's output
+func (leaky *LeakyReLULayer) PrintOutput() {
+	fmt.Println("Printing leaky ReLU Layer output...")
+}
+
+// PrintWeights Just to point, that leaky ReLU layer has not weights
+func (leaky *LeakyReLULayer) PrintWeights() {
+	fmt.Println("There are no weights for leaky ReLU layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (leaky *LeakyReLULayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for leaky ReLU layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (leaky *LeakyReLULayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for leaky ReLU layer")
+}
+
+// GetStride Returns stride of layer
+func (leaky *LeakyReLULayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "leaky_relu" as layer's type
+func (leaky *LeakyReLULayer) GetType() string {
+	return "leaky_relu"
+}
+
+// SetTrainMode Switch leaky ReLU layer to training (true) or inference (false) mode
+func (leaky *LeakyReLULayer) SetTrainMode(mode bool) {
+	leaky.trainMode = mode
+}
+
+// replicate Returns new leaky ReLU layer with the same configuration (see TrainParallel())
+func (leaky *LeakyReLULayer) replicate() Layer {
+	return NewLeakyReLULayer(leaky.inputSize, leaky.Alpha)
+}
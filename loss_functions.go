@@ -0,0 +1,296 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// lossEpsilon Clipping value for logarithms in cross-entropy losses (avoid log(0))
+	lossEpsilon = 1e-12
+	// defaultHuberDelta Default threshold for Huber loss
+	defaultHuberDelta = 1.0
+)
+
+// Loss Interface for loss functions (cost functions) of neural net
+/*
+	Tk - T{k}, desired target
+	Ok - O{k}, activated output of last layer
+*/
+type Loss interface {
+	// Value Returns value of loss function E{k} for single sample
+	Value(Tk, Ok *mat.Dense) float64
+
+	// Gradient Returns derivative of loss function with respect to net's output: ΔE{k}/ΔO{k}
+	Gradient(Tk, Ok *mat.Dense) *mat.Dense
+
+	// GetType Returns type of loss function in string representation
+	GetType() string
+}
+
+// LossMSE Mean squared error
+/*
+	E{k} = Σ(T{k} - O{k}) ^ 2
+	ΔE{k}/ΔO{k} = (O{k} - T{k})
+
+	Reported value is the same sum of squares as it has always been, while gradient follows (1/2)-scaled convention
+	(derivative of (1/2) * Σ(T{k} - O{k}) ^ 2), so learning rates tuned for previous versions stay valid.
+*/
+type LossMSE struct{}
+
+// NewLossMSE Constructor for mean squared error loss. This is default loss for neural net.
+func NewLossMSE() Loss {
+	return &LossMSE{}
+}
+
+// Value See ref. Loss.Value()
+func (loss *LossMSE) Value(Tk, Ok *mat.Dense) float64 {
+	diff := &mat.Dense{}
+	diff.Sub(Tk, Ok)
+	diff.MulElem(diff, diff)
+	return mat.Sum(diff)
+}
+
+// Gradient See ref. Loss.Gradient()
+func (loss *LossMSE) Gradient(Tk, Ok *mat.Dense) *mat.Dense {
+	grad := &mat.Dense{}
+	grad.Sub(Ok, Tk)
+	return grad
+}
+
+// GetType Returns "mse" as loss type
+func (loss *LossMSE) GetType() string {
+	return "mse"
+}
+
+// LossMAE Mean absolute error
+/*
+	E{k} = Σ|T{k} - O{k}|
+	ΔE{k}/ΔO{k} = sign(O{k} - T{k})
+*/
+type LossMAE struct{}
+
+// NewLossMAE Constructor for mean absolute error loss
+func NewLossMAE() Loss {
+	return &LossMAE{}
+}
+
+// Value See ref. Loss.Value()
+func (loss *LossMAE) Value(Tk, Ok *mat.Dense) float64 {
+	diff := &mat.Dense{}
+	diff.Sub(Tk, Ok)
+	sum := 0.0
+	for _, v := range diff.RawMatrix().Data {
+		sum += math.Abs(v)
+	}
+	return sum
+}
+
+// Gradient See ref. Loss.Gradient()
+func (loss *LossMAE) Gradient(Tk, Ok *mat.Dense) *mat.Dense {
+	grad := &mat.Dense{}
+	grad.Sub(Ok, Tk)
+	raw := grad.RawMatrix().Data
+	for i := range raw {
+		switch {
+		case raw[i] > 0:
+			raw[i] = 1
+		case raw[i] < 0:
+			raw[i] = -1
+		default:
+			raw[i] = 0
+		}
+	}
+	return grad
+}
+
+// GetType Returns "mae" as loss type
+func (loss *LossMAE) GetType() string {
+	return "mae"
+}
+
+// LossHuber Huber loss (quadratic for small errors and linear for large ones)
+/*
+	d = O{k} - T{k}
+	E{k} = Σ (1/2) * d^2, if |d| <= δ
+	E{k} = Σ δ * (|d| - δ/2), if |d| > δ
+	ΔE{k}/ΔO{k} = d clipped to [-δ; δ]
+*/
+type LossHuber struct {
+	Delta float64
+}
+
+// NewLossHuber Constructor for Huber loss. You need to specify threshold δ
+func NewLossHuber(delta float64) Loss {
+	if delta <= 0 {
+		fmt.Printf("Warning: δ for Huber loss can not be less or equal zero. Setting default value which is %v\n", defaultHuberDelta)
+		delta = defaultHuberDelta
+	}
+	return &LossHuber{
+		Delta: delta,
+	}
+}
+
+// Value See ref. Loss.Value()
+func (loss *LossHuber) Value(Tk, Ok *mat.Dense) float64 {
+	diff := &mat.Dense{}
+	diff.Sub(Ok, Tk)
+	sum := 0.0
+	for _, v := range diff.RawMatrix().Data {
+		abs := math.Abs(v)
+		if abs <= loss.Delta {
+			sum += 0.5 * v * v
+		} else {
+			sum += loss.Delta * (abs - 0.5*loss.Delta)
+		}
+	}
+	return sum
+}
+
+// Gradient See ref. Loss.Gradient()
+func (loss *LossHuber) Gradient(Tk, Ok *mat.Dense) *mat.Dense {
+	grad := &mat.Dense{}
+	grad.Sub(Ok, Tk)
+	raw := grad.RawMatrix().Data
+	for i := range raw {
+		raw[i] = math.Max(-loss.Delta, math.Min(loss.Delta, raw[i]))
+	}
+	return grad
+}
+
+// GetType Returns "huber" as loss type
+func (loss *LossHuber) GetType() string {
+	return "huber"
+}
+
+// LossBinaryCrossEntropy Binary cross-entropy (outputs are expected to be in range (0; 1), e.g. after sigmoid)
+/*
+	E{k} = -Σ(T{k} * ln(O{k}) + (1 - T{k}) * ln(1 - O{k}))
+	ΔE{k}/ΔO{k} = (O{k} - T{k}) / (O{k} * (1 - O{k}))
+*/
+type LossBinaryCrossEntropy struct{}
+
+// NewLossBinaryCrossEntropy Constructor for binary cross-entropy loss
+func NewLossBinaryCrossEntropy() Loss {
+	return &LossBinaryCrossEntropy{}
+}
+
+// Value See ref. Loss.Value()
+func (loss *LossBinaryCrossEntropy) Value(Tk, Ok *mat.Dense) float64 {
+	rawT := Tk.RawMatrix().Data
+	rawO := Ok.RawMatrix().Data
+	sum := 0.0
+	for i := range rawO {
+		o := clipProbability(rawO[i])
+		sum -= rawT[i]*math.Log(o) + (1-rawT[i])*math.Log(1-o)
+	}
+	return sum
+}
+
+// Gradient See ref. Loss.Gradient()
+func (loss *LossBinaryCrossEntropy) Gradient(Tk, Ok *mat.Dense) *mat.Dense {
+	r, c := Ok.Dims()
+	grad := mat.NewDense(r, c, nil)
+	rawT := Tk.RawMatrix().Data
+	rawO := Ok.RawMatrix().Data
+	rawGrad := grad.RawMatrix().Data
+	for i := range rawO {
+		o := clipProbability(rawO[i])
+		rawGrad[i] = (o - rawT[i]) / (o * (1 - o))
+	}
+	return grad
+}
+
+// GetType Returns "binary_cross_entropy" as loss type
+func (loss *LossBinaryCrossEntropy) GetType() string {
+	return "binary_cross_entropy"
+}
+
+// LossCategoricalCrossEntropy Categorical cross-entropy (outputs are expected to be probabilities distribution, e.g. after softmax)
+/*
+	E{k} = -Σ(T{k} * ln(O{k}))
+	ΔE{k}/ΔO{k} = -T{k} / O{k}
+*/
+type LossCategoricalCrossEntropy struct{}
+
+// NewLossCategoricalCrossEntropy Constructor for categorical cross-entropy loss
+func NewLossCategoricalCrossEntropy() Loss {
+	return &LossCategoricalCrossEntropy{}
+}
+
+// Value See ref. Loss.Value()
+func (loss *LossCategoricalCrossEntropy) Value(Tk, Ok *mat.Dense) float64 {
+	rawT := Tk.RawMatrix().Data
+	rawO := Ok.RawMatrix().Data
+	sum := 0.0
+	for i := range rawO {
+		sum -= rawT[i] * math.Log(clipProbability(rawO[i]))
+	}
+	return sum
+}
+
+// Gradient See ref. Loss.Gradient()
+func (loss *LossCategoricalCrossEntropy) Gradient(Tk, Ok *mat.Dense) *mat.Dense {
+	r, c := Ok.Dims()
+	grad := mat.NewDense(r, c, nil)
+	rawT := Tk.RawMatrix().Data
+	rawO := Ok.RawMatrix().Data
+	rawGrad := grad.RawMatrix().Data
+	for i := range rawO {
+		rawGrad[i] = -rawT[i] / clipProbability(rawO[i])
+	}
+	return grad
+}
+
+// GetType Returns "categorical_cross_entropy" as loss type
+func (loss *LossCategoricalCrossEntropy) GetType() string {
+	return "categorical_cross_entropy"
+}
+
+// isCategoricalCrossEntropy Checks if loss function is categorical cross-entropy
+func isCategoricalCrossEntropy(loss Loss) bool {
+	_, ok := loss.(*LossCategoricalCrossEntropy)
+	return ok
+}
+
+// clipProbability Clip value to range [ε; 1-ε]
+func clipProbability(v float64) float64 {
+	return math.Max(lossEpsilon, math.Min(1-lossEpsilon, v))
+}
+
+// LossJSON JSON representation of loss function
+type LossJSON struct {
+	LossType string  `json:"loss_type"`
+	Delta    float64 `json:"delta,omitempty"`
+}
+
+// lossToJSON Prepare JSON representation of loss function
+func lossToJSON(loss Loss) *LossJSON {
+	ans := &LossJSON{
+		LossType: loss.GetType(),
+	}
+	if huber, ok := loss.(*LossHuber); ok {
+		ans.Delta = huber.Delta
+	}
+	return ans
+}
+
+// lossFromJSON Create loss function from its JSON representation
+func lossFromJSON(data *LossJSON) (Loss, error) {
+	switch data.LossType {
+	case "mse":
+		return NewLossMSE(), nil
+	case "mae":
+		return NewLossMAE(), nil
+	case "huber":
+		return NewLossHuber(data.Delta), nil
+	case "binary_cross_entropy":
+		return NewLossBinaryCrossEntropy(), nil
+	case "categorical_cross_entropy":
+		return NewLossCategoricalCrossEntropy(), nil
+	default:
+		return nil, fmt.Errorf("Unrecognized loss type: %s", data.LossType)
+	}
+}
@@ -0,0 +1,77 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+var (
+	lossTestTarget = mat.NewDense(3, 1, []float64{0, 1, 0})
+	lossTestOutput = mat.NewDense(3, 1, []float64{0.2, 0.5, 0.3})
+)
+
+func TestLossValues(t *testing.T) {
+	cases := []struct {
+		loss    Loss
+		correct float64
+	}{
+		{NewLossMSE(), 0.04 + 0.25 + 0.09},
+		{NewLossMAE(), 0.2 + 0.5 + 0.3},
+		{NewLossHuber(0.25), 0.5*0.04 + 0.25*(0.5-0.125) + 0.25*(0.3-0.125)},
+		{NewLossBinaryCrossEntropy(), -(math.Log(0.8) + math.Log(0.5) + math.Log(0.7))},
+		{NewLossCategoricalCrossEntropy(), -math.Log(0.5)},
+	}
+	for _, c := range cases {
+		got := c.loss.Value(lossTestTarget, lossTestOutput)
+		if math.Abs(got-c.correct) > 1e-12 {
+			t.Errorf("Loss '%s' should be %f, but got %f", c.loss.GetType(), c.correct, got)
+		}
+	}
+}
+
+// TestLossGradients Compare analytical gradients with numerical ones
+func TestLossGradients(t *testing.T) {
+	cases := []struct {
+		loss Loss
+		// scale Ratio between derivative of value and gradient (MSE gradient is taken from (1/2)-scaled value)
+		scale float64
+	}{
+		{NewLossMSE(), 2},
+		{NewLossMAE(), 1},
+		{NewLossHuber(0.25), 1},
+		{NewLossBinaryCrossEntropy(), 1},
+		{NewLossCategoricalCrossEntropy(), 1},
+	}
+	h := 1e-6
+	for _, c := range cases {
+		loss := c.loss
+		grad := loss.Gradient(lossTestTarget, lossTestOutput)
+		for i := 0; i < 3; i++ {
+			plus := mat.DenseCopyOf(lossTestOutput)
+			plus.Set(i, 0, plus.At(i, 0)+h)
+			minus := mat.DenseCopyOf(lossTestOutput)
+			minus.Set(i, 0, minus.At(i, 0)-h)
+			numerical := (loss.Value(lossTestTarget, plus) - loss.Value(lossTestTarget, minus)) / (2 * h) / c.scale
+			if math.Abs(numerical-grad.At(i, 0)) > 1e-5 {
+				t.Errorf("Gradient of loss '%s' in position %d should be %f, but got %f", loss.GetType(), i, numerical, grad.At(i, 0))
+			}
+		}
+	}
+}
+
+func TestLossJSON(t *testing.T) {
+	huber := NewLossHuber(0.7)
+	restored, err := lossFromJSON(lossToJSON(huber))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if restored.GetType() != "huber" {
+		t.Errorf("Loss type should be 'huber', but got '%s'", restored.GetType())
+	}
+	if restored.(*LossHuber).Delta != 0.7 {
+		t.Errorf("δ should be %f, but got %f", 0.7, restored.(*LossHuber).Delta)
+	}
+}
@@ -2,16 +2,42 @@ package cnns
 
 import (
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/mat"
 )
 
 // WholeNet Neural net itself (slice of layers)
+/*
+	Layers - slice of layers
+	LP - learning parameters
+	Loss - loss function. If it is not set then MSE is used
+*/
 type WholeNet struct {
 	Layers []Layer
 	LP     *LearningParams
+	Loss   Loss
+
+	// Source of randomness (see SetSeed()). Global source from math/rand is used if it is nil
+	rand       *rand.Rand
+	randSource *countingSource
+
+	// Pool of replicas of layers for Predict() (it is created once, see getPredictorsPool())
+	predictors     *sync.Pool
+	predictorsOnce sync.Once
+	// Replicas of layers for worker goroutines of mini-batch training (one per worker, see CalculateBatchGradients())
+	trainer *batchTrainer
+}
+
+// getLoss Returns loss function of the net (MSE by default)
+func (wh *WholeNet) getLoss() Loss {
+	if wh.Loss == nil {
+		return NewLossMSE()
+	}
+	return wh.Loss
 }
 
 // FeedForward Forward pass through the net
@@ -27,8 +53,18 @@ func (wh *WholeNet) FeedForward(input *mat.Dense) error {
 	return nil
 }
 
-// Backpropagate Backward pass through the net (training)
+// Backpropagate Backward pass through the net (training). Gradients are evaluated and weights are updated immediately
 func (wh *WholeNet) Backpropagate(Tk *mat.Dense) error {
+	err := wh.CalculateGradients(Tk)
+	if err != nil {
+		return errors.Wrap(err, "Can't call Backpropagate() on neural net")
+	}
+	wh.UpdateWeights()
+	return nil
+}
+
+// CalculateGradients Backward pass through the net without updating weights. Gradients are accumulated in layers until UpdateWeights() is called (useful for mini-batch training)
+func (wh *WholeNet) CalculateGradients(Tk *mat.Dense) error {
 	Ok := wh.Layers[len(wh.Layers)-1].GetActivatedOutput()
 	/*
 		Chain rule for backpropagation is:
@@ -38,20 +74,26 @@ func (wh *WholeNet) Backpropagate(Tk *mat.Dense) error {
 	*/
 
 	/*
-		Error on last layer is defined as:
-			E{k} = (1/2) * (T{k} - O{k}) ^ 2, where
-				T{k} - desired target
-				O{k} = activate(Σw{j}{k}*o{j}) - activated output, where o{j} - is input
+		Error on last layer is defined by loss function E{k}(T{k}, O{k}), where
+			T{k} - desired target
+			O{k} = activate(Σw{j}{k}*o{j}) - activated output, where o{j} - is input
+		E.g. for MSE:
+			E{k} = (1/2) * (T{k} - O{k}) ^ 2
 		Derivative of E{k} with respect to O{k}:
 			ΔE{k} / Δo{k} = -(T{k} - O{k}) = (O{k} - T{k})
 	*/
 
-	// Evaluate ΔE{k}/ΔO{k}
-	Ediff := &mat.Dense{}
-	Ediff.Sub(Ok, Tk)
-
-	// Evaluate ΔE{k}/ΔO{k} * ΔO{k}/ΔΣ(k) * ΔΣ(k)/Δw{j}{k}
-	err := wh.Layers[len(wh.Layers)-1].CalculateGradients(Ediff)
+	lossFunc := wh.getLoss()
+	var err error
+	if softmax, ok := wh.Layers[len(wh.Layers)-1].(*SoftmaxLayer); ok && isCategoricalCrossEntropy(lossFunc) {
+		// Fast path: ΔE{k}/ΔO{k} * ΔO{k}/ΔΣ(k) is just (O{k} - T{k}) for softmax paired with categorical cross-entropy
+		err = softmax.calculateCrossEntropyGradients(Tk)
+	} else {
+		// Evaluate ΔE{k}/ΔO{k}
+		Ediff := lossFunc.Gradient(Tk, Ok)
+		// Evaluate ΔE{k}/ΔO{k} * ΔO{k}/ΔΣ(k) * ΔΣ(k)/Δw{j}{k}
+		err = wh.Layers[len(wh.Layers)-1].CalculateGradients(Ediff)
+	}
 	if err != nil {
 		return errors.Wrap(err, "Can't call CalculateGradients() on last layer of neural net")
 	}
@@ -65,13 +107,50 @@ func (wh *WholeNet) Backpropagate(Tk *mat.Dense) error {
 		}
 	}
 
-	// Update weights
+	return nil
+}
+
+// UpdateWeights Update weights of every layer using gradients accumulated since previous update
+func (wh *WholeNet) UpdateWeights() {
 	for i := range wh.Layers {
 		wh.Layers[i].UpdateWeights(wh.LP)
 	}
+}
+
+// PrepareBatchStatistics Evaluate statistics of mini-batch for layers which need them in training mode (e.g. batch normalization layer)
+/*
+	batch - input data of mini-batch
+
+	Should be called before FeedForward() in training mode for samples of mini-batch. CalculateBatchGradients() (and so Train() and Fit()) does it automatically.
+	Statistics are kept until UpdateWeights() is called. Running statistics of layers are updated also.
+	Random layers (e.g. dropout layer) draw values from their sources of randomness, so following FeedForward() gets other random values for the same sample
+*/
+func (wh *WholeNet) PrepareBatchStatistics(batch []*mat.Dense) error {
+	if len(wh.Layers) == 0 {
+		return ErrNoLayers
+	}
+	err := wh.newBatchPass([][]Layer{wh.Layers}, batch).prepareStatistics()
+	if err != nil {
+		return errors.Wrap(err, "Can't call PrepareBatchStatistics() on neural net")
+	}
 	return nil
 }
 
+// trainModeLayer Layer which could be switched between training and inference modes (e.g. dropout and batch normalization layers)
+type trainModeLayer interface {
+	// SetTrainMode Switch layer to training (true) or inference (false) mode
+	SetTrainMode(mode bool)
+}
+
+// SetTrainMode Switch every layer of the net to training (true) or inference (false) mode. Layers without SetTrainMode(mode bool) method are skipped
+func (wh *WholeNet) SetTrainMode(mode bool) {
+	for i := range wh.Layers {
+		if layer, ok := wh.Layers[i].(trainModeLayer); ok {
+			layer.SetTrainMode(mode)
+		}
+	}
+}
+
 // PrintOutput Print net's output (last layer output)
 func (wh *WholeNet) PrintOutput() {
 	wh.Layers[len(wh.Layers)-1].PrintOutput()
@@ -83,7 +162,17 @@ func (wh *WholeNet) GetOutput() *mat.Dense {
 }
 
 // GetGraphvizText Returns Graphviz text-based output
-func (wh *WholeNet) GetGraphvizText() (string, error) {
+/*
+	options - optional parameters:
+		WithGraphvizBlocks() - draw every layer as labelled box (required for convolutional and pooling layers, since neuron-level drawing supports only 1-D layers)
+		WithGraphvizWeights() - annotate edges with weights magnitudes
+*/
+func (wh *WholeNet) GetGraphvizText(options ...GraphvizOption) (string, error) {
+	opts := newGraphvizOptions(options...)
+	if opts.blocks {
+		return wh.getGraphvizBlocksText(opts)
+	}
+
 	graph := "digraph G {rankdir = LR;splines=false;edge[style=invis];ranksep= 1.4;"
 
 	if len(wh.Layers) == 0 {
@@ -109,6 +198,7 @@ func (wh *WholeNet) GetGraphvizText() (string, error) {
 	graph += inputLayerRankProperties
 
 	layersVertices := []string{}
+	layersVerticesNames := [][]string{inputVertices}
 
 	for l := range wh.Layers {
 		nodeProperties := ""
@@ -120,7 +210,7 @@ func (wh *WholeNet) GetGraphvizText() (string, error) {
 		size := wh.Layers[l].GetOutputSize()
 
 		switch wh.Layers[l].GetType() {
-		case "fc":
+		case "fc", "softmax", "dropout", "batchnorm", "relu", "leaky_relu", "prelu", "elu", "selu", "gelu":
 			switch l {
 			case len(wh.Layers) - 1:
 				nodeProperties = "node [shape=circle, color=coral1, style=filled, fillcolor=coral1]"
@@ -141,9 +231,12 @@ func (wh *WholeNet) GetGraphvizText() (string, error) {
 				layerType = "hidden"
 				break
 			}
+			if wh.Layers[l].GetType() != "fc" {
+				layerType = wh.Layers[l].GetType() + " " + layerType
+			}
 			break
 		default:
-			return "", fmt.Errorf("Layer of type '%s' is not supported for GraphViz currently", wh.Layers[l].GetType())
+			return "", fmt.Errorf("Layer of type '%s' is not supported for neuron-level GraphViz drawing currently (use WithGraphvizBlocks() option)", wh.Layers[l].GetType())
 		}
 
 		nodeProperties = fmt.Sprintf("{%s;%s;}", nodeProperties, strings.Join(verticesLabels, ";"))
@@ -153,6 +246,7 @@ func (wh *WholeNet) GetGraphvizText() (string, error) {
 
 		layerVertices := fmt.Sprintf("{%s}", strings.Join(vertices, ";"))
 		layersVertices = append(layersVertices, layerVertices)
+		layersVerticesNames = append(layersVerticesNames, vertices)
 
 		graph += nodeProperties
 		graph += rankProperties
@@ -162,10 +256,17 @@ func (wh *WholeNet) GetGraphvizText() (string, error) {
 
 	edgesStyle := "edge[style=solid, tailport=e, headport=w];"
 	graph += edgesStyle
-	inputEdges := fmt.Sprintf("%[1]s -> %[2]s;", inputLayerVertices, layersVertices[0])
-	graph += inputEdges
-	for l := 1; l < len(layersVertices); l++ {
-		edges := fmt.Sprintf("%[1]s -> %[2]s;", layersVertices[l-1], layersVertices[l])
+	layersVertices = append([]string{inputLayerVertices}, layersVertices...)
+	for l := range wh.Layers {
+		if fc, ok := wh.Layers[l].(*FullyConnectedLayer); ok && opts.weights {
+			edges, err := weightedGraphvizEdges(fc, layersVerticesNames[l], layersVerticesNames[l+1])
+			if err != nil {
+				return "", errors.Wrapf(err, "Can't draw weights of layer #%d", l)
+			}
+			graph += edges
+			continue
+		}
+		edges := fmt.Sprintf("%[1]s -> %[2]s;", layersVertices[l], layersVertices[l+1])
 		graph += edges
 	}
 
@@ -0,0 +1,139 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestMiniBatchGradients(t *testing.T) {
+	weights := mat.NewDense(2, 3, []float64{0.1, -0.2, 0.3, -0.4, 0.5, -0.6})
+	inputs := []*mat.Dense{
+		mat.NewDense(3, 1, []float64{1, 0, -1}),
+		mat.NewDense(3, 1, []float64{0.5, 0.5, 0.5}),
+	}
+	targets := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{1, 0}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+	}
+
+	// Evaluate gradients for each sample separately
+	single := NewFullyConnectedLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1}, 2)
+	single.SetCustomWeights([]*mat.Dense{weights})
+	singleNet := WholeNet{Layers: []Layer{single}, LP: NewLearningParametersDefault()}
+	sum := mat.NewDense(2, 3, nil)
+	for i := range inputs {
+		err := singleNet.FeedForward(inputs[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = singleNet.CalculateGradients(targets[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		sum.Add(sum, single.(*FullyConnectedLayer).WeightsGradients)
+		single.(*FullyConnectedLayer).WeightsGradients.Zero()
+	}
+
+	// Accumulate gradients over mini-batch and update weights once
+	batched := NewFullyConnectedLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1}, 2)
+	batched.SetCustomWeights([]*mat.Dense{weights})
+	lp := &LearningParams{LearningRate: 0.1, Momentum: 0.0, BatchSize: 2}
+	batchedNet := WholeNet{Layers: []Layer{batched}, LP: lp}
+	for i := range inputs {
+		err := batchedNet.FeedForward(inputs[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = batchedNet.CalculateGradients(targets[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	batchedNet.UpdateWeights()
+
+	// w = w - η * (g1 + g2) / 2
+	correct := mat.NewDense(2, 3, nil)
+	correct.Scale(-0.1/2.0, sum)
+	correct.Add(correct, weights)
+	got := batched.GetWeights()[0]
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(correct.At(i, j)-got.At(i, j)) > 1e-12 {
+				t.Errorf("Weight in position r = %d, c = %d should be %f, but got %f", i, j, correct.At(i, j), got.At(i, j))
+			}
+		}
+	}
+}
+
+func TestSeedReproducibility(t *testing.T) {
+	inputs := make([]*mat.Dense, 10)
+	targets := make([]*mat.Dense, 10)
+	for i := range inputs {
+		inputs[i] = mat.NewDense(4, 1, []float64{float64(i), float64(i % 3), float64(i % 2), 1})
+		targets[i] = mat.NewDense(2, 1, []float64{float64(i % 2), float64(1 - i%2)})
+	}
+	initialFirst := inputs[0]
+
+	train := func() []*mat.Dense {
+		r := rand.New(rand.NewSource(42))
+		fc1 := NewFullyConnectedLayer(&tensor.TDsize{X: 4, Y: 1, Z: 1}, 5, WithRand(r), WithInitializer(NewInitializerXavierNormal()))
+		dropout := NewDropoutLayer(fc1.GetOutputSize(), 0.3)
+		fc2 := NewFullyConnectedLayer(dropout.GetOutputSize(), 2, WithRand(r))
+		lp := NewLearningParametersDefault()
+		lp.SetBatchSize(3)
+		net := WholeNet{Layers: []Layer{fc1, dropout, fc2}, LP: lp}
+		net.SetSeed(42)
+		_, _, err := net.Train(inputs, targets, nil, nil, 5)
+		if err != nil {
+			t.Error(err)
+		}
+		return []*mat.Dense{fc1.GetWeights()[0], fc2.GetWeights()[0]}
+	}
+	first := train()
+	second := train()
+	for i := range first {
+		if !mat.Equal(first[i], second[i]) {
+			t.Errorf("Weights of layer #%d should be identical for the same seed", i)
+		}
+	}
+	if inputs[0] != initialFirst {
+		t.Errorf("Train() should not shuffle provided slices")
+	}
+}
+
+// userLayer Layer of user's package which implements Layer interface only
+type userLayer struct {
+	Layer
+}
+
+func TestTrainWithUserLayer(t *testing.T) {
+	inSize := &tensor.TDsize{X: 3, Y: 1, Z: 1}
+	fc := NewFullyConnectedLayer(inSize, 2, WithRand(rand.New(rand.NewSource(1))))
+	net := &WholeNet{Layers: []Layer{userLayer{NewReLULayer(inSize)}, fc}, LP: NewLearningParametersDefault()}
+	inputs := []*mat.Dense{
+		mat.NewDense(3, 1, []float64{1, 0, -1}),
+		mat.NewDense(3, 1, []float64{0.5, -0.5, 0.5}),
+	}
+	targets := []*mat.Dense{
+		mat.NewDense(2, 1, []float64{1, 0}),
+		mat.NewDense(2, 1, []float64{0, 1}),
+	}
+	before := mat.DenseCopyOf(fc.GetWeights()[0])
+	// Training switches modes of layers which support it only
+	_, err := net.Fit(inputs, targets, &TrainOptions{Epochs: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if mat.Equal(before, fc.GetWeights()[0]) {
+		t.Errorf("Weights should be updated")
+	}
+}
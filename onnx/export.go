@@ -0,0 +1,510 @@
+// Package onnx Export of networks built with cnns to ONNX format (https://onnx.ai), so they can be run by other runtimes
+package onnx
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/LdDl/cnns"
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// OpsetVersion Version of ONNX operators' set used by exported models
+	OpsetVersion = 13
+	// irVersion Version of ONNX IR which corresponds to OpsetVersion
+	irVersion = 7
+)
+
+// Names of graph's input and output
+const (
+	InputName  = "input"
+	OutputName = "output"
+)
+
+// ExportToFile Save network to ONNX file
+/*
+	net - network (its layers should be supported, see Export())
+	fname - filename
+*/
+func ExportToFile(net *cnns.WholeNet, fname string) error {
+	err := writeFileAtomic(fname, func(w io.Writer) error {
+		return Export(net, w)
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Can't write data to file '%s'", fname))
+	}
+	return nil
+}
+
+// writeFileAtomic Write data to temporary file in the same directory and rename it to fname, so fname is left untouched if writing fails
+/*
+	fname - filename
+	write - function which writes data
+*/
+func writeFileAtomic(fname string, write func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	err = write(file)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, fname)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// Export Write network in ONNX format (opset 13, float32 tensors) to writer
+/*
+	net - network
+	w - destination
+
+	Data of cnns is stored as (Z*X) x Y matrix with channels stacked vertically, so it is the same as NCHW tensor [N, Z, X, Y] in row-major order.
+	Input of exported graph is [N, Z, X, Y] tensor (or [N, X] if input is vector, i.e. Y = Z = 1) where N is batch size. Output is shaped the same way.
+
+	Layers are mapped to ONNX operators in inference mode:
+		conv - Conv (edge and reflect padding are done by Pad)
+		pool - MaxPool/AveragePool (min pooling is done by Neg+MaxPool+Neg, "same" zero padding is done by Pad)
+		global_pool - GlobalMaxPool/GlobalAveragePool
+		fc - Gemm followed by activation function (tanh, sigmoid, arctan, softplus, gaussian, relu or identity)
+		relu, leaky_relu, prelu, elu, selu - Relu, LeakyRelu, PRelu, Elu, Selu
+		gelu - x*0.5*(1+Erf(x/√2))
+		batchnorm - BatchNormalization ("channel" type) or Mul+Add ("feature" type)
+		softmax - Softmax over all values of sample
+		dropout - nothing (it is identity in inference mode)
+*/
+func Export(net *cnns.WholeNet, w io.Writer) error {
+	model, err := buildModel(net)
+	if err != nil {
+		return err
+	}
+	e := &encoder{}
+	model.marshal(e)
+	_, err = w.Write(e.buf)
+	if err != nil {
+		return errors.Wrap(err, "Can't write ONNX model")
+	}
+	return nil
+}
+
+// graphBuilder Accumulates nodes and initializers of graph while layers are converted
+/*
+	current - name of tensor produced by last node
+	shape - shape of current tensor without batch dimension
+*/
+type graphBuilder struct {
+	nodes        []*nodeProto
+	initializers []*tensorProto
+	current      string
+	shape        []int64
+	counter      int
+	prefix       string
+}
+
+// buildModel Convert network to ONNX model
+func buildModel(net *cnns.WholeNet) (*modelProto, error) {
+	if len(net.Layers) == 0 {
+		return nil, cnns.ErrNoLayers
+	}
+	g := &graphBuilder{
+		current: InputName,
+		shape:   tensorShape(net.Layers[0].GetInputSize()),
+	}
+	input := valueInfo(InputName, g.shape)
+	for l, layer := range net.Layers {
+		g.prefix = fmt.Sprintf("layer%d_%s", l, layer.GetType())
+		g.counter = 0
+		err := g.addLayer(layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't export layer #%d (%s) to ONNX", l, layer.GetType())
+		}
+	}
+	// Output is presented the same way as input: as vector or as NCHW tensor
+	outShape := tensorShape(net.Layers[len(net.Layers)-1].GetOutputSize())
+	if !equalShapes(g.shape, outShape) {
+		g.reshape(outShape)
+	}
+	if g.current == InputName {
+		g.addNode("Identity", []string{g.current})
+	}
+	g.nodes[len(g.nodes)-1].output[0] = OutputName
+
+	return &modelProto{
+		irVersion:    irVersion,
+		opsetImport:  []*operatorSetIDProto{{version: OpsetVersion}},
+		producerName: "cnns",
+		graph: &graphProto{
+			node:        g.nodes,
+			name:        "cnns",
+			initializer: g.initializers,
+			input:       []*valueInfoProto{input},
+			output:      []*valueInfoProto{valueInfo(OutputName, outShape)},
+		},
+	}, nil
+}
+
+// tensorShape Returns shape of tensor without batch dimension: [X] for vectors (Y = Z = 1) and [Z, X, Y] otherwise
+func tensorShape(size *tensor.TDsize) []int64 {
+	if size.Y == 1 && size.Z == 1 {
+		return []int64{int64(size.X)}
+	}
+	return []int64{int64(size.Z), int64(size.X), int64(size.Y)}
+}
+
+// valueInfo Returns description of float tensor with symbolic batch dimension
+func valueInfo(name string, shape []int64) *valueInfoProto {
+	return &valueInfoProto{
+		name:      name,
+		dims:      append([]int64{0}, shape...),
+		dimParams: []string{"N"},
+	}
+}
+
+func equalShapes(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// name Returns unique name for tensor or node of current layer
+func (g *graphBuilder) name(suffix string) string {
+	g.counter++
+	return fmt.Sprintf("%s_%s_%d", g.prefix, suffix, g.counter)
+}
+
+// addNode Add operator consuming provided inputs. Output of operator becomes current tensor (shape should be updated by caller if it changes)
+func (g *graphBuilder) addNode(opType string, inputs []string, attributes ...*attributeProto) {
+	output := g.name(opType)
+	g.nodes = append(g.nodes, &nodeProto{
+		input:     inputs,
+		output:    []string{output},
+		name:      output,
+		opType:    opType,
+		attribute: attributes,
+	})
+	g.current = output
+}
+
+// addFloat Add float initializer and return its name
+func (g *graphBuilder) addFloat(suffix string, dims []int64, values []float64) string {
+	name := g.name(suffix)
+	g.initializers = append(g.initializers, floatTensor(name, dims, values))
+	return name
+}
+
+// addInt64 Add int64 initializer and return its name
+func (g *graphBuilder) addInt64(suffix string, values []int64) string {
+	name := g.name(suffix)
+	g.initializers = append(g.initializers, int64Tensor(name, []int64{int64(len(values))}, values))
+	return name
+}
+
+// reshape Reshape current tensor (batch dimension is kept)
+func (g *graphBuilder) reshape(shape []int64) {
+	// Zero in target shape means "copy dimension from input", so batch dimension is kept
+	target := g.addInt64("shape", append([]int64{0}, shape...))
+	g.addNode("Reshape", []string{g.current, target})
+	g.shape = shape
+}
+
+// ensureNCHW Reshape current tensor to [N, Z, X, Y] if needed
+func (g *graphBuilder) ensureNCHW(size *tensor.TDsize) {
+	shape := []int64{int64(size.Z), int64(size.X), int64(size.Y)}
+	if !equalShapes(g.shape, shape) {
+		g.reshape(shape)
+	}
+}
+
+// flatten Reshape current tensor to [N, values] if needed
+func (g *graphBuilder) flatten() {
+	if len(g.shape) == 1 {
+		return
+	}
+	g.addNode("Flatten", []string{g.current}, intAttribute("axis", 1))
+	total := int64(1)
+	for _, d := range g.shape {
+		total *= d
+	}
+	g.shape = []int64{total}
+}
+
+// pad Add Pad operator for spatial dimensions of NCHW tensor
+func (g *graphBuilder) pad(num int, mode string) {
+	p := int64(num)
+	pads := g.addInt64("pads", []int64{0, 0, p, p, 0, 0, p, p})
+	g.addNode("Pad", []string{g.current, pads}, stringAttribute("mode", mode))
+	g.shape = []int64{g.shape[0], g.shape[1] + 2*p, g.shape[2] + 2*p}
+}
+
+// addLayer Convert single layer
+func (g *graphBuilder) addLayer(layer cnns.Layer) error {
+	switch l := layer.(type) {
+	case *cnns.ConvLayer:
+		return g.addConv(l)
+	case *cnns.PoolingLayer:
+		return g.addPooling(l)
+	case *cnns.GlobalPoolingLayer:
+		return g.addGlobalPooling(l)
+	case *cnns.FullyConnectedLayer:
+		return g.addFullyConnected(l)
+	case *cnns.BatchNormLayer:
+		return g.addBatchNorm(l)
+	case *cnns.PReLULayer:
+		return g.addPReLU(l)
+	case *cnns.ReLULayer:
+		g.addNode("Relu", []string{g.current})
+		break
+	case *cnns.LeakyReLULayer:
+		g.addNode("LeakyRelu", []string{g.current}, floatAttribute("alpha", l.Alpha))
+		break
+	case *cnns.ELULayer:
+		g.addNode("Elu", []string{g.current}, floatAttribute("alpha", l.Alpha))
+		break
+	case *cnns.SELULayer:
+		// Default α and γ of ONNX are the same as constants of SELU layer
+		g.addNode("Selu", []string{g.current})
+		break
+	case *cnns.GELULayer:
+		x := g.current
+		g.addNode("Div", []string{x, g.addFloat("sqrt2", nil, []float64{math.Sqrt2})})
+		g.addNode("Erf", []string{g.current})
+		g.addNode("Add", []string{g.current, g.addFloat("one", nil, []float64{1})})
+		g.addNode("Mul", []string{x, g.current})
+		g.addNode("Mul", []string{g.current, g.addFloat("half", nil, []float64{0.5})})
+		break
+	case *cnns.SoftmaxLayer:
+		// Softmax is evaluated over all values of sample
+		g.flatten()
+		g.addNode("Softmax", []string{g.current}, intAttribute("axis", 1))
+		break
+	case *cnns.DropoutLayer:
+		// Dropout does nothing in inference mode
+		break
+	default:
+		return fmt.Errorf("Layer of type '%s' is not supported", layer.GetType())
+	}
+	return nil
+}
+
+// addConv Convert convolutional layer to Conv
+func (g *graphBuilder) addConv(conv *cnns.ConvLayer) error {
+	inSize := conv.GetInputSize()
+	outSize := conv.GetOutputSize()
+	g.ensureNCHW(inSize)
+	attributes := []*attributeProto{
+		intsAttribute("kernel_shape", int64(conv.KernelSize), int64(conv.KernelSize)),
+		intsAttribute("strides", int64(conv.Stride), int64(conv.Stride)),
+	}
+	if conv.Padding > 0 {
+		switch conv.PaddingMode.String() {
+		case "zero":
+			p := int64(conv.Padding)
+			attributes = append(attributes, intsAttribute("pads", p, p, p, p))
+			break
+		case "edge", "reflect":
+			g.pad(conv.Padding, conv.PaddingMode.String())
+			break
+		default:
+			return fmt.Errorf("Padding mode '%s' is not supported", conv.PaddingMode.String())
+		}
+	}
+	// Every kernel is (KernelSize*Z) x KernelSize matrix with channels stacked vertically, so in row-major order it is [Z, KernelSize, KernelSize] tensor
+	kernelLen := conv.KernelSize * conv.KernelSize * inSize.Z
+	weights := make([]float64, 0, len(conv.Kernels)*kernelLen)
+	for f := range conv.Kernels {
+		raw := mat.DenseCopyOf(conv.Kernels[f]).RawMatrix().Data
+		if len(raw) != kernelLen {
+			return errors.Wrapf(cnns.ErrDimensionsAreNotEqual, "Kernel #%d has %d values, but %d are expected", f, len(raw), kernelLen)
+		}
+		weights = append(weights, raw...)
+	}
+	inputs := []string{
+		g.current,
+		g.addFloat("W", []int64{int64(len(conv.Kernels)), int64(inSize.Z), int64(conv.KernelSize), int64(conv.KernelSize)}, weights),
+	}
+	if conv.Biases != nil {
+		inputs = append(inputs, g.addFloat("B", []int64{int64(len(conv.Kernels))}, mat.DenseCopyOf(conv.Biases).RawMatrix().Data))
+	}
+	g.addNode("Conv", inputs, attributes...)
+	g.shape = []int64{int64(outSize.Z), int64(outSize.X), int64(outSize.Y)}
+	return nil
+}
+
+// addPooling Convert pooling layer to MaxPool/AveragePool
+func (g *graphBuilder) addPooling(pool *cnns.PoolingLayer) error {
+	outSize := pool.GetOutputSize()
+	g.ensureNCHW(pool.GetInputSize())
+	if pool.ZeroPadding.String() == "same" {
+		// Padded values take part in pooling (e.g. zeros could be maximum values), so padding is explicit
+		g.pad(1, "constant")
+	}
+	attributes := []*attributeProto{
+		intsAttribute("kernel_shape", int64(pool.ExtendFilter), int64(pool.ExtendFilter)),
+		intsAttribute("strides", int64(pool.Stride), int64(pool.Stride)),
+	}
+	switch pool.PoolingType.String() {
+	case "max":
+		g.addNode("MaxPool", []string{g.current}, attributes...)
+		break
+	case "min":
+		// min(x) = -max(-x)
+		g.addNode("Neg", []string{g.current})
+		g.addNode("MaxPool", []string{g.current}, attributes...)
+		g.addNode("Neg", []string{g.current})
+		break
+	case "avg":
+		g.addNode("AveragePool", []string{g.current}, attributes...)
+		break
+	default:
+		return fmt.Errorf("Pooling type '%s' is not supported", pool.PoolingType.String())
+	}
+	g.shape = []int64{int64(outSize.Z), int64(outSize.X), int64(outSize.Y)}
+	return nil
+}
+
+// addGlobalPooling Convert global pooling layer to GlobalMaxPool/GlobalAveragePool
+func (g *graphBuilder) addGlobalPooling(pool *cnns.GlobalPoolingLayer) error {
+	g.ensureNCHW(pool.GetInputSize())
+	switch pool.PoolingType.String() {
+	case "max":
+		g.addNode("GlobalMaxPool", []string{g.current})
+		break
+	case "min":
+		g.addNode("Neg", []string{g.current})
+		g.addNode("GlobalMaxPool", []string{g.current})
+		g.addNode("Neg", []string{g.current})
+		break
+	case "avg":
+		g.addNode("GlobalAveragePool", []string{g.current})
+		break
+	default:
+		return fmt.Errorf("Pooling type '%s' is not supported", pool.PoolingType.String())
+	}
+	g.shape = []int64{g.shape[0], 1, 1}
+	return nil
+}
+
+// addFullyConnected Convert fully-connected layer to Gemm and its activation function
+func (g *graphBuilder) addFullyConnected(fc *cnns.FullyConnectedLayer) error {
+	activation := fc.GetActivationName()
+	if activation == "" {
+		return fmt.Errorf("Activation function is not registered (see RegisterActivation())")
+	}
+	g.flatten()
+	rows, cols := fc.Weights.Dims()
+	if int64(cols) != g.shape[0] {
+		return errors.Wrapf(cnns.ErrDimensionsAreNotEqual, "Weights have %d columns, but input has %d values", cols, g.shape[0])
+	}
+	// Gemm evaluates A*B' + C, where A is [N, in] input and B is [out, in] weights
+	inputs := []string{
+		g.current,
+		g.addFloat("W", []int64{int64(rows), int64(cols)}, mat.DenseCopyOf(fc.Weights).RawMatrix().Data),
+	}
+	if fc.Biases != nil {
+		inputs = append(inputs, g.addFloat("B", []int64{int64(rows)}, mat.DenseCopyOf(fc.Biases).RawMatrix().Data))
+	}
+	g.addNode("Gemm", inputs, intAttribute("transB", 1))
+	g.shape = []int64{int64(rows)}
+
+	switch activation {
+	case "identity":
+		break
+	case "tanh":
+		g.addNode("Tanh", []string{g.current})
+		break
+	case "sigmoid":
+		g.addNode("Sigmoid", []string{g.current})
+		break
+	case "arctan":
+		g.addNode("Atan", []string{g.current})
+		break
+	case "softplus":
+		g.addNode("Softplus", []string{g.current})
+		break
+	case "relu":
+		g.addNode("Relu", []string{g.current})
+		break
+	case "gaussian":
+		// exp(-x²)
+		x := g.current
+		g.addNode("Mul", []string{x, x})
+		g.addNode("Neg", []string{g.current})
+		g.addNode("Exp", []string{g.current})
+		break
+	default:
+		return fmt.Errorf("Activation function '%s' is not supported", activation)
+	}
+	return nil
+}
+
+// addBatchNorm Convert batch normalization layer (inference mode: running statistics are used)
+func (g *graphBuilder) addBatchNorm(bn *cnns.BatchNormLayer) error {
+	switch bn.NormType.String() {
+	case "channel":
+		g.ensureNCHW(bn.GetInputSize())
+		g.addNode("BatchNormalization", []string{
+			g.current,
+			g.addFloat("scale", []int64{g.shape[0]}, mat.DenseCopyOf(bn.Gamma).RawMatrix().Data),
+			g.addFloat("B", []int64{g.shape[0]}, mat.DenseCopyOf(bn.Beta).RawMatrix().Data),
+			g.addFloat("mean", []int64{g.shape[0]}, mat.DenseCopyOf(bn.RunningMean).RawMatrix().Data),
+			g.addFloat("var", []int64{g.shape[0]}, mat.DenseCopyOf(bn.RunningVariance).RawMatrix().Data),
+		}, floatAttribute("epsilon", bn.Epsilon))
+		break
+	case "feature":
+		// Every value has own statistics: y = γ*(x-μ)/√(σ²+ε) + β = a*x + b, where a = γ/√(σ²+ε) and b = β - a*μ
+		gamma := bn.Gamma.RawMatrix().Data
+		beta := bn.Beta.RawMatrix().Data
+		mean := bn.RunningMean.RawMatrix().Data
+		variance := bn.RunningVariance.RawMatrix().Data
+		a := make([]float64, len(gamma))
+		b := make([]float64, len(gamma))
+		for i := range gamma {
+			a[i] = gamma[i] / math.Sqrt(variance[i]+bn.Epsilon)
+			b[i] = beta[i] - a[i]*mean[i]
+		}
+		dims := append([]int64{1}, g.shape...)
+		g.addNode("Mul", []string{g.current, g.addFloat("a", dims, a)})
+		g.addNode("Add", []string{g.current, g.addFloat("b", dims, b)})
+		break
+	default:
+		return fmt.Errorf("Normalization type '%s' is not supported", bn.NormType.String())
+	}
+	return nil
+}
+
+// addPReLU Convert PReLU layer (slope for every channel)
+func (g *graphBuilder) addPReLU(prelu *cnns.PReLULayer) error {
+	slopes := mat.DenseCopyOf(prelu.Slopes).RawMatrix().Data
+	inSize := prelu.GetInputSize()
+	if inSize.Z == 1 {
+		g.addNode("PRelu", []string{g.current, g.addFloat("slope", []int64{1}, slopes)})
+		return nil
+	}
+	g.ensureNCHW(inSize)
+	// Slopes are broadcasted over spatial dimensions
+	g.addNode("PRelu", []string{g.current, g.addFloat("slope", []int64{int64(inSize.Z), 1, 1}, slopes)})
+	return nil
+}
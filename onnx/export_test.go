@@ -0,0 +1,1025 @@
+package onnx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/LdDl/cnns"
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+var (
+	registerCubeOnce sync.Once
+	registerCubeErr  error
+)
+
+// registerCube Register user's activation function for tests (registry is global, so it is done once for repeated runs, e.g. go test -count=2)
+func registerCube() error {
+	registerCubeOnce.Do(func() {
+		registerCubeErr = cnns.RegisterActivation("onnx_test_cube", func(v float64) float64 { return v * v * v }, func(v float64) float64 { return 3 * v * v })
+	})
+	return registerCubeErr
+}
+
+func TestExport(t *testing.T) {
+	err := registerCube()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	r := rand.New(rand.NewSource(21))
+	nets := map[string]*cnns.Sequential{
+		"cnn": cnns.NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 3}).
+			Conv(3, 4, 1, cnns.WithBias(), cnns.WithRand(r), cnns.WithPadding("same"), cnns.WithPaddingMode("reflect")).
+			BatchNorm("channel").
+			PReLU().
+			MaxPool(2, 2).
+			Conv(3, 2, 1, cnns.WithRand(r), cnns.WithPaddingSize(1), cnns.WithPaddingMode("edge")).
+			Pool(3, 2, "min", "same").
+			GELU().
+			Dense(5, cnns.WithBias(), cnns.WithRand(r)).
+			Activation("tanh").
+			BatchNorm("feature").
+			ELU(0.8).
+			Dropout(0.4).
+			Dense(3, cnns.WithRand(r)).
+			Softmax(),
+		"rectifiers": cnns.NewSequential(&tensor.TDsize{X: 7, Y: 7, Z: 2}).
+			Conv(2, 3, 1, cnns.WithBias(), cnns.WithRand(r), cnns.WithPaddingSize(1)).
+			LeakyReLU(0.2).
+			SELU().
+			AvgPool(2, 2).
+			ReLU().
+			Pool(2, 1, "max", "valid").
+			GlobalPool("avg").
+			PReLU().
+			Dense(4, cnns.WithBias(), cnns.WithRand(r)).
+			Activation("sigmoid").
+			Dense(4, cnns.WithRand(r)).
+			Activation("arctan").
+			Dense(3, cnns.WithRand(r)).
+			Activation("softplus"),
+		"mlp": cnns.NewSequential(&tensor.TDsize{X: 5, Y: 1, Z: 1}).
+			Dense(4, cnns.WithBias(), cnns.WithRand(r)).
+			Activation("gaussian").
+			BatchNorm("channel").
+			Dense(4, cnns.WithRand(r)).
+			Activation("relu").
+			PReLU().
+			Dense(2, cnns.WithRand(r)).
+			Activation("identity"),
+		"features": cnns.NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 2}).
+			GlobalPool("min").
+			Softmax(),
+	}
+	for name, seq := range nets {
+		net, err := seq.Build()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		// Non-trivial statistics and slopes
+		for _, layer := range net.Layers {
+			switch l := layer.(type) {
+			case *cnns.BatchNormLayer:
+				for i := range l.RunningMean.RawMatrix().Data {
+					l.RunningMean.RawMatrix().Data[i] = r.NormFloat64() * 0.1
+					l.RunningVariance.RawMatrix().Data[i] = 0.5 + r.Float64()
+					l.Gamma.RawMatrix().Data[i] = 0.5 + r.Float64()
+					l.Beta.RawMatrix().Data[i] = r.NormFloat64() * 0.1
+				}
+				break
+			case *cnns.PReLULayer:
+				for i := range l.Slopes.RawMatrix().Data {
+					l.Slopes.RawMatrix().Data[i] = r.Float64() * 0.5
+				}
+				break
+			}
+		}
+		buf := &bytes.Buffer{}
+		err = Export(net, buf)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		model, err := decodeModel(buf.Bytes())
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if model.irVersion != irVersion || model.opset != OpsetVersion {
+			t.Errorf("%s: IR version and opset should be %d and %d, but got %d and %d", name, irVersion, OpsetVersion, model.irVersion, model.opset)
+		}
+
+		inSize := net.Layers[0].GetInputSize()
+		outSize := net.Layers[len(net.Layers)-1].GetOutputSize()
+		// Batch of two samples
+		inputs := make([]*mat.Dense, 2)
+		batch := &testTensor{dims: append([]int{len(inputs)}, model.inputDims[1:]...)}
+		expected := []float64{}
+		for i := range inputs {
+			inputs[i] = mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil)
+			for j := range inputs[i].RawMatrix().Data {
+				inputs[i].RawMatrix().Data[j] = r.NormFloat64()
+			}
+			// Data of cnns is NCHW tensor in row-major order already
+			batch.data = append(batch.data, float64ToFloat32(inputs[i].RawMatrix().Data)...)
+			output, err := net.Predict(inputs[i])
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			expected = append(expected, output.RawMatrix().Data...)
+		}
+		output, err := model.run(batch)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		outDims := append([]int{len(inputs)}, model.outputDims[1:]...)
+		if fmt.Sprint(output.dims) != fmt.Sprint(outDims) || output.size() != len(inputs)*outSize.Total() {
+			t.Errorf("%s: output shape should be %v (%d values per sample), but got %v", name, outDims, outSize.Total(), output.dims)
+			continue
+		}
+		for i := range expected {
+			if math.Abs(expected[i]-output.data[i]) > 1e-4*math.Max(1, math.Abs(expected[i])) {
+				t.Errorf("%s: output #%d should be %v, but got %v", name, i, expected[i], output.data[i])
+			}
+		}
+	}
+
+	custom, err := cnns.NewSequential(&tensor.TDsize{X: 3, Y: 1, Z: 1}).
+		Dense(2).
+		Activation("onnx_test_cube").
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = Export(custom, &bytes.Buffer{})
+	if err == nil {
+		t.Errorf("Export of user's activation function should fail")
+	}
+}
+
+func TestExportAttributes(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	net, err := cnns.NewSequential(&tensor.TDsize{X: 11, Y: 11, Z: 1}).
+		Conv(3, 4, 2, cnns.WithRand(r), cnns.WithPaddingSize(1)).
+		Conv(3, 2, 1, cnns.WithRand(r), cnns.WithPaddingSize(1), cnns.WithPaddingMode("reflect")).
+		MaxPool(2, 2).
+		LeakyReLU(0.2).
+		Dense(3, cnns.WithRand(r)).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	err = Export(net, buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	model, err := decodeModel(buf.Bytes())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Values are taken from ONNX specification (https://github.com/onnx/onnx/blob/main/docs/Operators.md and onnx.proto):
+	// AttributeType FLOAT = 1, INT = 2, STRING = 3, INTS = 7; TensorProto.DataType FLOAT = 1, INT64 = 7
+	// Pads of Pad operator are [x1_begin, x2_begin, ..., x1_end, x2_end, ...] for every axis of NCHW tensor
+	type expectedAttribute struct {
+		typ  int64
+		f    float64
+		i    int64
+		s    string
+		ints []int64
+	}
+	expected := []struct {
+		opType     string
+		attributes map[string]expectedAttribute
+		// Values of int64 initializers (e.g. pads of Pad operator) in order of inputs, nil for inputs which are not checked
+		initializers [][]int64
+		// Dims of float initializers in order of inputs, nil for inputs which are not checked
+		weights [][]int
+	}{
+		{"Conv", map[string]expectedAttribute{
+			"kernel_shape": {typ: 7, ints: []int64{3, 3}},
+			"strides":      {typ: 7, ints: []int64{2, 2}},
+			"pads":         {typ: 7, ints: []int64{1, 1, 1, 1}},
+		}, nil, [][]int{nil, {4, 1, 3, 3}}},
+		{"Pad", map[string]expectedAttribute{
+			"mode": {typ: 3, s: "reflect"},
+		}, [][]int64{nil, {0, 0, 1, 1, 0, 0, 1, 1}}, nil},
+		{"Conv", map[string]expectedAttribute{
+			"kernel_shape": {typ: 7, ints: []int64{3, 3}},
+			"strides":      {typ: 7, ints: []int64{1, 1}},
+		}, nil, [][]int{nil, {2, 4, 3, 3}}},
+		{"MaxPool", map[string]expectedAttribute{
+			"kernel_shape": {typ: 7, ints: []int64{2, 2}},
+			"strides":      {typ: 7, ints: []int64{2, 2}},
+		}, nil, nil},
+		{"LeakyRelu", map[string]expectedAttribute{
+			"alpha": {typ: 1, f: 0.2},
+		}, nil, nil},
+		{"Flatten", map[string]expectedAttribute{
+			"axis": {typ: 2, i: 1},
+		}, nil, nil},
+		{"Gemm", map[string]expectedAttribute{}, nil, [][]int{nil, {3, 18}}},
+	}
+	if len(model.nodes) < len(expected) {
+		t.Errorf("Graph should have at least %d nodes, but got %d", len(expected), len(model.nodes))
+		return
+	}
+	for n, e := range expected {
+		node := model.nodes[n]
+		if node.opType != e.opType {
+			t.Errorf("Node #%d should be %s, but got %s", n, e.opType, node.opType)
+			continue
+		}
+		for name, attr := range e.attributes {
+			got, ok := node.attributes[name]
+			if !ok {
+				t.Errorf("Node #%d (%s) should have attribute '%s'", n, node.opType, name)
+				continue
+			}
+			if got.typ != attr.typ || got.i != attr.i || got.s != attr.s || math.Abs(got.f-attr.f) > 1e-6 || fmt.Sprint(got.ints) != fmt.Sprint(attr.ints) {
+				t.Errorf("Attribute '%s' of node #%d (%s) should be %+v, but got %+v", name, n, node.opType, attr, *got)
+			}
+		}
+		if node.opType == "Conv" && e.attributes["pads"].ints == nil {
+			if _, ok := node.attributes["pads"]; ok {
+				t.Errorf("Node #%d (Conv) should not have pads, since input is padded by Pad", n)
+			}
+		}
+		for i, values := range e.initializers {
+			if values == nil {
+				continue
+			}
+			tt, ok := model.tensors[node.inputs[i]]
+			if !ok || tt.dataType != 7 {
+				t.Errorf("Input #%d of node #%d (%s) should be int64 initializer", i, n, node.opType)
+				continue
+			}
+			got := make([]int64, len(tt.data))
+			for j := range tt.data {
+				got[j] = int64(tt.data[j])
+			}
+			if fmt.Sprint(got) != fmt.Sprint(values) {
+				t.Errorf("Input #%d of node #%d (%s) should be %v, but got %v", i, n, node.opType, values, got)
+			}
+		}
+		for i, dims := range e.weights {
+			if dims == nil {
+				continue
+			}
+			tt, ok := model.tensors[node.inputs[i]]
+			if !ok || tt.dataType != 1 {
+				t.Errorf("Input #%d of node #%d (%s) should be float initializer", i, n, node.opType)
+				continue
+			}
+			if fmt.Sprint(tt.dims) != fmt.Sprint(dims) {
+				t.Errorf("Input #%d of node #%d (%s) should have dims %v, but got %v", i, n, node.opType, dims, tt.dims)
+			}
+		}
+	}
+	last := model.nodes[len(model.nodes)-1]
+	if last.opType != "Softmax" || last.attributes["axis"] == nil || last.attributes["axis"].typ != 2 || last.attributes["axis"].i != 1 {
+		t.Errorf("Last node should be Softmax with axis 1")
+	}
+	if fmt.Sprint(model.inputDims[1:]) != "[1 11 11]" || fmt.Sprint(model.outputDims[1:]) != "[3]" {
+		t.Errorf("Input and output should be [N 1 11 11] and [N 3], but got %v and %v", model.inputDims, model.outputDims)
+	}
+}
+
+func TestExportToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnns_onnx")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "net.onnx")
+	net, err := cnns.NewSequential(&tensor.TDsize{X: 4, Y: 1, Z: 1}).Dense(2, cnns.WithRand(rand.New(rand.NewSource(1)))).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = ExportToFile(net, fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	saved, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Failed export should keep previous file
+	err = ExportToFile(&cnns.WholeNet{}, fname)
+	if errors.Cause(err) != cnns.ErrNoLayers {
+		t.Errorf("Export of net without layers should cause ErrNoLayers, but got %v", err)
+	}
+	kept, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(saved, kept) {
+		t.Errorf("File should be left untouched if export fails")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(files) != 1 {
+		t.Errorf("Temporary files should be removed, but directory has %d files", len(files))
+	}
+}
+
+func float64ToFloat32(values []float64) []float64 {
+	ans := make([]float64, len(values))
+	for i := range values {
+		ans[i] = float64(float32(values[i]))
+	}
+	return ans
+}
+
+/*
+	Minimal protobuf decoder and reference evaluator for exported ONNX models (for testing purposes only)
+*/
+
+type protoField struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+func parseMessage(b []byte) ([]protoField, error) {
+	fields := []protoField{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("bad key")
+		}
+		b = b[n:]
+		field := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case wireVarint:
+			field.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("bad varint")
+			}
+			b = b[n:]
+			break
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, fmt.Errorf("bad fixed32")
+			}
+			field.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+			break
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, fmt.Errorf("bad length")
+			}
+			field.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+			break
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", field.wire)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func parsePackedInt64(b []byte) []int64 {
+	ans := []int64{}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		ans = append(ans, int64(v))
+		b = b[n:]
+	}
+	return ans
+}
+
+type testTensor struct {
+	dataType int64
+	dims     []int
+	data     []float64
+}
+
+func (tt *testTensor) size() int {
+	ans := 1
+	for _, d := range tt.dims {
+		ans *= d
+	}
+	return ans
+}
+
+type testAttribute struct {
+	typ  int64
+	f    float64
+	i    int64
+	s    string
+	ints []int64
+}
+
+type testNode struct {
+	opType     string
+	inputs     []string
+	outputs    []string
+	attributes map[string]*testAttribute
+}
+
+type testModel struct {
+	irVersion  int64
+	opset      int64
+	nodes      []*testNode
+	tensors    map[string]*testTensor
+	inputName  string
+	inputDims  []int
+	outputName string
+	outputDims []int
+}
+
+func decodeModel(b []byte) (*testModel, error) {
+	model := &testModel{tensors: map[string]*testTensor{}}
+	fields, err := parseMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			model.irVersion = int64(f.varint)
+			break
+		case 7:
+			err = model.decodeGraph(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			break
+		case 8:
+			opset, err := parseMessage(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range opset {
+				if o.num == 2 {
+					model.opset = int64(o.varint)
+				}
+			}
+			break
+		}
+	}
+	return model, nil
+}
+
+func (model *testModel) decodeGraph(b []byte) error {
+	fields, err := parseMessage(b)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			node, err := decodeNode(f.bytes)
+			if err != nil {
+				return err
+			}
+			model.nodes = append(model.nodes, node)
+			break
+		case 5:
+			name, tt, err := decodeTensor(f.bytes)
+			if err != nil {
+				return err
+			}
+			model.tensors[name] = tt
+			break
+		case 11, 12:
+			name, dims, err := decodeValueInfo(f.bytes)
+			if err != nil {
+				return err
+			}
+			if f.num == 11 {
+				model.inputName, model.inputDims = name, dims
+			} else {
+				model.outputName, model.outputDims = name, dims
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func decodeNode(b []byte) (*testNode, error) {
+	node := &testNode{attributes: map[string]*testAttribute{}}
+	fields, err := parseMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			node.inputs = append(node.inputs, string(f.bytes))
+			break
+		case 2:
+			node.outputs = append(node.outputs, string(f.bytes))
+			break
+		case 4:
+			node.opType = string(f.bytes)
+			break
+		case 5:
+			attrFields, err := parseMessage(f.bytes)
+			if err != nil {
+				return nil, err
+			}
+			name := ""
+			attr := &testAttribute{}
+			for _, a := range attrFields {
+				switch a.num {
+				case 1:
+					name = string(a.bytes)
+					break
+				case 2:
+					attr.f = float64(math.Float32frombits(uint32(a.varint)))
+					break
+				case 3:
+					attr.i = int64(a.varint)
+					break
+				case 4:
+					attr.s = string(a.bytes)
+					break
+				case 8:
+					attr.ints = append(attr.ints, parsePackedInt64(a.bytes)...)
+					break
+				case 20:
+					attr.typ = int64(a.varint)
+					break
+				}
+			}
+			node.attributes[name] = attr
+			break
+		}
+	}
+	return node, nil
+}
+
+func decodeTensor(b []byte) (string, *testTensor, error) {
+	fields, err := parseMessage(b)
+	if err != nil {
+		return "", nil, err
+	}
+	name := ""
+	tt := &testTensor{dims: []int{}}
+	dataType := int64(0)
+	var raw []byte
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			for _, d := range parsePackedInt64(f.bytes) {
+				tt.dims = append(tt.dims, int(d))
+			}
+			break
+		case 2:
+			dataType = int64(f.varint)
+			break
+		case 8:
+			name = string(f.bytes)
+			break
+		case 9:
+			raw = f.bytes
+			break
+		}
+	}
+	switch dataType {
+	case tensorFloat:
+		for i := 0; i+4 <= len(raw); i += 4 {
+			tt.data = append(tt.data, float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i:]))))
+		}
+		break
+	case tensorInt64:
+		for i := 0; i+8 <= len(raw); i += 8 {
+			tt.data = append(tt.data, float64(int64(binary.LittleEndian.Uint64(raw[i:]))))
+		}
+		break
+	default:
+		return "", nil, fmt.Errorf("unexpected data type %d", dataType)
+	}
+	tt.dataType = dataType
+	if len(tt.data) != tt.size() {
+		return "", nil, fmt.Errorf("tensor '%s' has %d values, but its shape is %v", name, len(tt.data), tt.dims)
+	}
+	return name, tt, nil
+}
+
+func decodeValueInfo(b []byte) (string, []int, error) {
+	fields, err := parseMessage(b)
+	if err != nil {
+		return "", nil, err
+	}
+	name := ""
+	dims := []int{}
+	for _, f := range fields {
+		if f.num == 1 {
+			name = string(f.bytes)
+			continue
+		}
+		// TypeProto -> TypeProto.Tensor -> TensorShapeProto -> Dimension
+		typeFields, err := parseMessage(f.bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		tensorFields, err := parseMessage(typeFields[0].bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, tf := range tensorFields {
+			if tf.num != 2 {
+				continue
+			}
+			shapeFields, err := parseMessage(tf.bytes)
+			if err != nil {
+				return "", nil, err
+			}
+			for _, sf := range shapeFields {
+				dimFields, err := parseMessage(sf.bytes)
+				if err != nil {
+					return "", nil, err
+				}
+				if dimFields[0].num == 1 {
+					dims = append(dims, int(dimFields[0].varint))
+				} else {
+					// Symbolic dimension
+					dims = append(dims, -1)
+				}
+			}
+		}
+	}
+	return name, dims, nil
+}
+
+func (model *testModel) run(input *testTensor) (*testTensor, error) {
+	values := map[string]*testTensor{model.inputName: input}
+	for name, tt := range model.tensors {
+		values[name] = tt
+	}
+	for _, node := range model.nodes {
+		inputs := make([]*testTensor, len(node.inputs))
+		for i, name := range node.inputs {
+			if name == "" {
+				continue
+			}
+			tt, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("node %s: unknown input '%s'", node.opType, name)
+			}
+			inputs[i] = tt
+		}
+		output, err := evalNode(node, inputs)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", node.opType, err)
+		}
+		values[node.outputs[0]] = output
+	}
+	output, ok := values[model.outputName]
+	if !ok {
+		return nil, fmt.Errorf("there is no output '%s'", model.outputName)
+	}
+	return output, nil
+}
+
+func unary(x *testTensor, f func(v float64) float64) *testTensor {
+	ans := &testTensor{dims: x.dims, data: make([]float64, len(x.data))}
+	for i, v := range x.data {
+		ans.data[i] = f(v)
+	}
+	return ans
+}
+
+// broadcast Evaluate binary operator with numpy-style broadcasting
+func broadcast(a, b *testTensor, f func(x, y float64) float64) (*testTensor, error) {
+	rank := len(a.dims)
+	if len(b.dims) > rank {
+		rank = len(b.dims)
+	}
+	align := func(dims []int) []int {
+		ans := make([]int, rank)
+		for i := range ans {
+			ans[i] = 1
+		}
+		copy(ans[rank-len(dims):], dims)
+		return ans
+	}
+	aDims, bDims := align(a.dims), align(b.dims)
+	outDims := make([]int, rank)
+	for i := range outDims {
+		switch {
+		case aDims[i] == bDims[i] || bDims[i] == 1:
+			outDims[i] = aDims[i]
+		case aDims[i] == 1:
+			outDims[i] = bDims[i]
+		default:
+			return nil, fmt.Errorf("can't broadcast %v and %v", a.dims, b.dims)
+		}
+	}
+	ans := &testTensor{dims: outDims}
+	ans.data = make([]float64, ans.size())
+	index := make([]int, rank)
+	for i := range ans.data {
+		rest := i
+		for d := rank - 1; d >= 0; d-- {
+			index[d] = rest % outDims[d]
+			rest /= outDims[d]
+		}
+		ai, bi := 0, 0
+		for d := 0; d < rank; d++ {
+			ai = ai*aDims[d] + index[d]%aDims[d]
+			bi = bi*bDims[d] + index[d]%bDims[d]
+		}
+		ans.data[i] = f(a.data[ai], b.data[bi])
+	}
+	return ans, nil
+}
+
+func evalNode(node *testNode, inputs []*testTensor) (*testTensor, error) {
+	x := inputs[0]
+	attr := func(name string) *testAttribute {
+		if a, ok := node.attributes[name]; ok {
+			return a
+		}
+		return &testAttribute{}
+	}
+	switch node.opType {
+	case "Identity":
+		return x, nil
+	case "Reshape":
+		dims := make([]int, len(inputs[1].data))
+		for i, d := range inputs[1].data {
+			dims[i] = int(d)
+			if d == 0 {
+				dims[i] = x.dims[i]
+			}
+		}
+		ans := &testTensor{dims: dims, data: x.data}
+		if ans.size() != x.size() {
+			return nil, fmt.Errorf("can't reshape %v to %v", x.dims, dims)
+		}
+		return ans, nil
+	case "Flatten":
+		return &testTensor{dims: []int{x.dims[0], x.size() / x.dims[0]}, data: x.data}, nil
+	case "Relu":
+		return unary(x, func(v float64) float64 { return math.Max(v, 0) }), nil
+	case "LeakyRelu":
+		alpha := attr("alpha").f
+		return unary(x, func(v float64) float64 {
+			if v < 0 {
+				return alpha * v
+			}
+			return v
+		}), nil
+	case "Elu":
+		alpha := attr("alpha").f
+		return unary(x, func(v float64) float64 {
+			if v < 0 {
+				return alpha * (math.Exp(v) - 1)
+			}
+			return v
+		}), nil
+	case "Selu":
+		if _, ok := node.attributes["alpha"]; ok {
+			return nil, fmt.Errorf("default alpha is expected")
+		}
+		return unary(x, func(v float64) float64 {
+			if v < 0 {
+				return 1.05070102214813232421875 * 1.67326319217681884765625 * (math.Exp(v) - 1)
+			}
+			return 1.05070102214813232421875 * v
+		}), nil
+	case "Sigmoid":
+		return unary(x, func(v float64) float64 { return 1 / (1 + math.Exp(-v)) }), nil
+	case "Tanh":
+		return unary(x, math.Tanh), nil
+	case "Atan":
+		return unary(x, math.Atan), nil
+	case "Softplus":
+		return unary(x, func(v float64) float64 { return math.Log(1 + math.Exp(v)) }), nil
+	case "Exp":
+		return unary(x, math.Exp), nil
+	case "Erf":
+		return unary(x, math.Erf), nil
+	case "Neg":
+		return unary(x, func(v float64) float64 { return -v }), nil
+	case "Add":
+		return broadcast(x, inputs[1], func(a, b float64) float64 { return a + b })
+	case "Mul":
+		return broadcast(x, inputs[1], func(a, b float64) float64 { return a * b })
+	case "Div":
+		return broadcast(x, inputs[1], func(a, b float64) float64 { return a / b })
+	case "PRelu":
+		return broadcast(x, inputs[1], func(a, slope float64) float64 {
+			if a < 0 {
+				return slope * a
+			}
+			return a
+		})
+	case "Softmax":
+		if len(x.dims) != 2 || attr("axis").i != 1 {
+			return nil, fmt.Errorf("softmax over axis 1 of 2-D tensor is expected")
+		}
+		ans := &testTensor{dims: x.dims, data: make([]float64, len(x.data))}
+		for n := 0; n < x.dims[0]; n++ {
+			row := x.data[n*x.dims[1] : (n+1)*x.dims[1]]
+			max := math.Inf(-1)
+			for _, v := range row {
+				max = math.Max(max, v)
+			}
+			sum := 0.0
+			for i, v := range row {
+				ans.data[n*x.dims[1]+i] = math.Exp(v - max)
+				sum += ans.data[n*x.dims[1]+i]
+			}
+			for i := range row {
+				ans.data[n*x.dims[1]+i] /= sum
+			}
+		}
+		return ans, nil
+	case "Gemm":
+		w := inputs[1]
+		if attr("transB").i != 1 {
+			return nil, fmt.Errorf("transB is expected")
+		}
+		n, in, out := x.dims[0], x.dims[1], w.dims[0]
+		if w.dims[1] != in {
+			return nil, fmt.Errorf("can't multiply %v by %v'", x.dims, w.dims)
+		}
+		ans := &testTensor{dims: []int{n, out}, data: make([]float64, n*out)}
+		for s := 0; s < n; s++ {
+			for o := 0; o < out; o++ {
+				sum := 0.0
+				for i := 0; i < in; i++ {
+					sum += x.data[s*in+i] * w.data[o*in+i]
+				}
+				if len(inputs) > 2 {
+					sum += inputs[2].data[o]
+				}
+				ans.data[s*out+o] = sum
+			}
+		}
+		return ans, nil
+	case "BatchNormalization":
+		scale, bias, mean, variance := inputs[1], inputs[2], inputs[3], inputs[4]
+		eps := attr("epsilon").f
+		channels, spatial := x.dims[1], x.size()/(x.dims[0]*x.dims[1])
+		ans := &testTensor{dims: x.dims, data: make([]float64, len(x.data))}
+		for i, v := range x.data {
+			c := (i / spatial) % channels
+			ans.data[i] = scale.data[c]*(v-mean.data[c])/math.Sqrt(variance.data[c]+eps) + bias.data[c]
+		}
+		return ans, nil
+	case "Pad":
+		return evalPad(x, inputs[1], attr("mode").s)
+	case "Conv":
+		return evalConv(x, inputs[1], inputs[2:], attr("kernel_shape").ints, attr("strides").ints, attr("pads").ints)
+	case "MaxPool", "AveragePool":
+		if len(attr("pads").ints) != 0 {
+			return nil, fmt.Errorf("pooling without pads is expected")
+		}
+		return evalPool(x, attr("kernel_shape").ints, attr("strides").ints, node.opType == "MaxPool"), nil
+	case "GlobalMaxPool", "GlobalAveragePool":
+		return evalPool(x, []int64{int64(x.dims[2]), int64(x.dims[3])}, []int64{1, 1}, node.opType == "GlobalMaxPool"), nil
+	default:
+		return nil, fmt.Errorf("operator is not supported by test evaluator")
+	}
+}
+
+func evalPad(x, pads *testTensor, mode string) (*testTensor, error) {
+	if len(x.dims) != 4 || len(pads.data) != 8 {
+		return nil, fmt.Errorf("4-D padding is expected")
+	}
+	n, c, h, w := x.dims[0], x.dims[1], x.dims[2], x.dims[3]
+	top, left, bottom, right := int(pads.data[2]), int(pads.data[3]), int(pads.data[6]), int(pads.data[7])
+	oh, ow := h+top+bottom, w+left+right
+	source := func(i, size, before int) int {
+		k := i - before
+		if k >= 0 && k < size {
+			return k
+		}
+		switch mode {
+		case "edge":
+			if k < 0 {
+				return 0
+			}
+			return size - 1
+		case "reflect":
+			if k < 0 {
+				return -k
+			}
+			return 2*(size-1) - k
+		default:
+			return -1
+		}
+	}
+	ans := &testTensor{dims: []int{n, c, oh, ow}, data: make([]float64, n*c*oh*ow)}
+	for p := 0; p < n*c; p++ {
+		for i := 0; i < oh; i++ {
+			for j := 0; j < ow; j++ {
+				si, sj := source(i, h, top), source(j, w, left)
+				if si < 0 || sj < 0 {
+					continue
+				}
+				ans.data[(p*oh+i)*ow+j] = x.data[(p*h+si)*w+sj]
+			}
+		}
+	}
+	return ans, nil
+}
+
+func evalConv(x, weights *testTensor, bias []*testTensor, kernel, strides, pads []int64) (*testTensor, error) {
+	n, c, h, w := x.dims[0], x.dims[1], x.dims[2], x.dims[3]
+	m := weights.dims[0]
+	if weights.dims[1] != c {
+		return nil, fmt.Errorf("kernels have %d channels, but input has %d", weights.dims[1], c)
+	}
+	kh, kw := int(kernel[0]), int(kernel[1])
+	sh, sw := int(strides[0]), int(strides[1])
+	pt, pl, pb, pr := 0, 0, 0, 0
+	if len(pads) == 4 {
+		pt, pl, pb, pr = int(pads[0]), int(pads[1]), int(pads[2]), int(pads[3])
+	}
+	oh := (h+pt+pb-kh)/sh + 1
+	ow := (w+pl+pr-kw)/sw + 1
+	ans := &testTensor{dims: []int{n, m, oh, ow}, data: make([]float64, n*m*oh*ow)}
+	for s := 0; s < n; s++ {
+		for f := 0; f < m; f++ {
+			for i := 0; i < oh; i++ {
+				for j := 0; j < ow; j++ {
+					sum := 0.0
+					if len(bias) > 0 && bias[0] != nil {
+						sum = bias[0].data[f]
+					}
+					for ch := 0; ch < c; ch++ {
+						for a := 0; a < kh; a++ {
+							for b := 0; b < kw; b++ {
+								y, z := i*sh+a-pt, j*sw+b-pl
+								if y < 0 || y >= h || z < 0 || z >= w {
+									continue
+								}
+								sum += x.data[((s*c+ch)*h+y)*w+z] * weights.data[((f*c+ch)*kh+a)*kw+b]
+							}
+						}
+					}
+					ans.data[((s*m+f)*oh+i)*ow+j] = sum
+				}
+			}
+		}
+	}
+	return ans, nil
+}
+
+func evalPool(x *testTensor, kernel, strides []int64, max bool) *testTensor {
+	n, c, h, w := x.dims[0], x.dims[1], x.dims[2], x.dims[3]
+	kh, kw := int(kernel[0]), int(kernel[1])
+	sh, sw := int(strides[0]), int(strides[1])
+	oh, ow := (h-kh)/sh+1, (w-kw)/sw+1
+	ans := &testTensor{dims: []int{n, c, oh, ow}, data: make([]float64, n*c*oh*ow)}
+	for p := 0; p < n*c; p++ {
+		for i := 0; i < oh; i++ {
+			for j := 0; j < ow; j++ {
+				value := 0.0
+				if max {
+					value = math.Inf(-1)
+				}
+				for a := 0; a < kh; a++ {
+					for b := 0; b < kw; b++ {
+						v := x.data[(p*h+i*sh+a)*w+j*sw+b]
+						if max {
+							value = math.Max(value, v)
+						} else {
+							value += v / float64(kh*kw)
+						}
+					}
+				}
+				ans.data[(p*oh+i)*ow+j] = value
+			}
+		}
+	}
+	return ans
+}
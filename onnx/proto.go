@@ -0,0 +1,315 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+/*
+	Minimal protobuf encoder for subset of ONNX schema which is needed to export networks.
+	Field numbers are taken from onnx.proto (https://github.com/onnx/onnx/blob/main/onnx/onnx.proto), so no generated code and no dependencies are needed.
+*/
+
+// Wire types of protobuf
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// TensorProto.DataType
+const (
+	tensorFloat = 1
+	tensorInt64 = 7
+)
+
+// AttributeProto.AttributeType
+const (
+	attributeFloat  = 1
+	attributeInt    = 2
+	attributeString = 3
+	attributeInts   = 7
+)
+
+// message Protobuf message which can be encoded
+type message interface {
+	marshal(e *encoder)
+}
+
+// encoder Writes protobuf wire format into buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+// int64Field Write int64 field (zero values are omitted as in proto3)
+func (e *encoder) int64Field(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+// float32Field Write float field (always written, since zero could be meaningful value of attribute)
+func (e *encoder) float32Field(field int, v float32) {
+	e.tag(field, wireFixed32)
+	raw := make([]byte, 4)
+	binary.LittleEndian.PutUint32(raw, math.Float32bits(v))
+	e.buf = append(e.buf, raw...)
+}
+
+// bytesField Write bytes field (empty values are omitted as in proto3)
+func (e *encoder) bytesField(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) stringField(field int, s string) {
+	e.bytesField(field, []byte(s))
+}
+
+// repeatedStringField Write every string (including empty ones, since position matters, e.g. for optional inputs of node)
+func (e *encoder) repeatedStringField(field int, values []string) {
+	for _, s := range values {
+		e.tag(field, wireBytes)
+		e.varint(uint64(len(s)))
+		e.buf = append(e.buf, s...)
+	}
+}
+
+// packedInt64Field Write repeated int64 field in packed encoding
+func (e *encoder) packedInt64Field(field int, values []int64) {
+	if len(values) == 0 {
+		return
+	}
+	packed := &encoder{}
+	for _, v := range values {
+		packed.varint(uint64(v))
+	}
+	e.bytesField(field, packed.buf)
+}
+
+func (e *encoder) messageField(field int, m message) {
+	sub := &encoder{}
+	m.marshal(sub)
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(sub.buf)))
+	e.buf = append(e.buf, sub.buf...)
+}
+
+// modelProto ModelProto: top-level ONNX file
+type modelProto struct {
+	irVersion       int64
+	opsetImport     []*operatorSetIDProto
+	producerName    string
+	producerVersion string
+	docString       string
+	graph           *graphProto
+}
+
+func (m *modelProto) marshal(e *encoder) {
+	e.int64Field(1, m.irVersion)
+	e.stringField(2, m.producerName)
+	e.stringField(3, m.producerVersion)
+	e.stringField(6, m.docString)
+	e.messageField(7, m.graph)
+	for _, opset := range m.opsetImport {
+		e.messageField(8, opset)
+	}
+}
+
+// operatorSetIDProto OperatorSetIdProto: version of operators' set
+type operatorSetIDProto struct {
+	domain  string
+	version int64
+}
+
+func (m *operatorSetIDProto) marshal(e *encoder) {
+	e.stringField(1, m.domain)
+	e.int64Field(2, m.version)
+}
+
+// graphProto GraphProto: nodes, weights and inputs/outputs of network
+type graphProto struct {
+	node        []*nodeProto
+	name        string
+	initializer []*tensorProto
+	input       []*valueInfoProto
+	output      []*valueInfoProto
+}
+
+func (m *graphProto) marshal(e *encoder) {
+	for _, node := range m.node {
+		e.messageField(1, node)
+	}
+	e.stringField(2, m.name)
+	for _, tensor := range m.initializer {
+		e.messageField(5, tensor)
+	}
+	for _, input := range m.input {
+		e.messageField(11, input)
+	}
+	for _, output := range m.output {
+		e.messageField(12, output)
+	}
+}
+
+// nodeProto NodeProto: single operator
+type nodeProto struct {
+	input     []string
+	output    []string
+	name      string
+	opType    string
+	attribute []*attributeProto
+}
+
+func (m *nodeProto) marshal(e *encoder) {
+	e.repeatedStringField(1, m.input)
+	e.repeatedStringField(2, m.output)
+	e.stringField(3, m.name)
+	e.stringField(4, m.opType)
+	for _, attribute := range m.attribute {
+		e.messageField(5, attribute)
+	}
+}
+
+// attributeProto AttributeProto: named attribute of operator
+type attributeProto struct {
+	name string
+	kind int64
+	f    float32
+	i    int64
+	s    string
+	ints []int64
+}
+
+func (m *attributeProto) marshal(e *encoder) {
+	e.stringField(1, m.name)
+	switch m.kind {
+	case attributeFloat:
+		e.float32Field(2, m.f)
+		break
+	case attributeInt:
+		// Zero is valid value of attribute, so it is written explicitly
+		e.tag(3, wireVarint)
+		e.varint(uint64(m.i))
+		break
+	case attributeString:
+		e.stringField(4, m.s)
+		break
+	case attributeInts:
+		e.packedInt64Field(8, m.ints)
+		break
+	}
+	e.int64Field(20, m.kind)
+}
+
+func floatAttribute(name string, v float64) *attributeProto {
+	return &attributeProto{name: name, kind: attributeFloat, f: float32(v)}
+}
+
+func intAttribute(name string, v int64) *attributeProto {
+	return &attributeProto{name: name, kind: attributeInt, i: v}
+}
+
+func stringAttribute(name string, s string) *attributeProto {
+	return &attributeProto{name: name, kind: attributeString, s: s}
+}
+
+func intsAttribute(name string, values ...int64) *attributeProto {
+	return &attributeProto{name: name, kind: attributeInts, ints: values}
+}
+
+// tensorProto TensorProto: constant tensor (weights, shapes, etc.). Data is stored as raw little-endian bytes
+type tensorProto struct {
+	dims     []int64
+	dataType int64
+	name     string
+	rawData  []byte
+}
+
+func (m *tensorProto) marshal(e *encoder) {
+	e.packedInt64Field(1, m.dims)
+	e.int64Field(2, m.dataType)
+	e.stringField(8, m.name)
+	e.bytesField(9, m.rawData)
+}
+
+// floatTensor Returns float tensor (values are converted to float32)
+func floatTensor(name string, dims []int64, values []float64) *tensorProto {
+	raw := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(float32(v)))
+	}
+	return &tensorProto{dims: dims, dataType: tensorFloat, name: name, rawData: raw}
+}
+
+// int64Tensor Returns int64 tensor
+func int64Tensor(name string, dims []int64, values []int64) *tensorProto {
+	raw := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(raw[8*i:], uint64(v))
+	}
+	return &tensorProto{dims: dims, dataType: tensorInt64, name: name, rawData: raw}
+}
+
+// valueInfoProto ValueInfoProto: description of input or output of graph (float tensor)
+type valueInfoProto struct {
+	name string
+	// Dimensions of tensor: dimension is symbolic if its name is provided
+	dims      []int64
+	dimParams []string
+}
+
+func (m *valueInfoProto) marshal(e *encoder) {
+	e.stringField(1, m.name)
+	e.messageField(2, (*typeProto)(m))
+}
+
+// typeProto TypeProto with TypeProto.Tensor value (elem_type and shape)
+type typeProto valueInfoProto
+
+func (m *typeProto) marshal(e *encoder) {
+	e.messageField(1, (*typeProtoTensor)(m))
+}
+
+type typeProtoTensor valueInfoProto
+
+func (m *typeProtoTensor) marshal(e *encoder) {
+	e.int64Field(1, tensorFloat)
+	e.messageField(2, (*tensorShapeProto)(m))
+}
+
+// tensorShapeProto TensorShapeProto: list of dimensions
+type tensorShapeProto valueInfoProto
+
+func (m *tensorShapeProto) marshal(e *encoder) {
+	for d := range m.dims {
+		dim := &encoder{}
+		if d < len(m.dimParams) && m.dimParams[d] != "" {
+			dim.stringField(2, m.dimParams[d])
+		} else {
+			dim.tag(1, wireVarint)
+			dim.varint(uint64(m.dims[d]))
+		}
+		e.tag(1, wireBytes)
+		e.varint(uint64(len(dim.buf)))
+		e.buf = append(e.buf, dim.buf...)
+	}
+}
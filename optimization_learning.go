@@ -1,17 +1,30 @@
 package cnns
 
 import (
+	"encoding/json"
 	"fmt"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 // LearningParams - Parameters for training neural network.
 /*
 	LearningRate - η
 	Momentum - α
+	L2Decay - λ2, coefficient for L2 regularization (penalty λ2 * w is added to gradients)
+	L1Decay - λ1, coefficient for L1 regularization (penalty λ1 * sign(w) is added to gradients)
+	DecayBiases - should L1/L2 regularization be applied to biases also
+	BatchSize - number of samples in mini-batch (gradients are averaged over mini-batch before updating weights)
+	Optimizer - optimization algorithm (SGD with momentum is used if it is not set)
 */
 type LearningParams struct {
-	LearningRate float64 `json:"learning_rate"`
-	Momentum     float64 `json:"momentum"`
+	LearningRate float64   `json:"learning_rate"`
+	Momentum     float64   `json:"momentum"`
+	L2Decay      float64   `json:"l2_decay"`
+	L1Decay      float64   `json:"l1_decay"`
+	DecayBiases  bool      `json:"decay_biases"`
+	BatchSize    int       `json:"batch_size"`
+	Optimizer    Optimizer `json:"-"`
 }
 
 // NewLearningParametersDefault Constructor for LearningParams
@@ -19,6 +32,8 @@ func NewLearningParametersDefault() *LearningParams {
 	return &LearningParams{
 		LearningRate: 0.01,
 		Momentum:     0.6,
+		BatchSize:    1,
+		Optimizer:    NewOptimizerSGD(),
 	}
 }
 
@@ -40,11 +55,118 @@ func (lp *LearningParams) SetMomentum(v float64) error {
 	return nil
 }
 
-// SetL2Decay Set weight's decay
+// SetL2Decay Set weight's decay (L2 regularization). Zero value turns regularization off
 func (lp *LearningParams) SetL2Decay(v float64) error {
+	if v < 0 {
+		return fmt.Errorf("λ2 (L2 decay) can not be less than zero")
+	}
+	lp.L2Decay = v
+	return nil
+}
+
+// SetL1Decay Set coefficient for L1 regularization. Zero value turns regularization off
+func (lp *LearningParams) SetL1Decay(v float64) error {
+	if v < 0 {
+		return fmt.Errorf("λ1 (L1 decay) can not be less than zero")
+	}
+	lp.L1Decay = v
+	return nil
+}
+
+// SetBatchSize Set number of samples in mini-batch
+func (lp *LearningParams) SetBatchSize(v int) error {
 	if v <= 0 {
-		return fmt.Errorf("λ (momentum) can not be less or equal zero. Setting default value which is 0.005")
+		return fmt.Errorf("Batch size can not be less or equal zero. Setting default value which is 1")
+	}
+	lp.BatchSize = v
+	return nil
+}
+
+// getBatchSize Returns number of samples in mini-batch (1 by default)
+func (lp *LearningParams) getBatchSize() int {
+	if lp.BatchSize <= 0 {
+		return 1
+	}
+	return lp.BatchSize
+}
+
+// SetOptimizer Set optimization algorithm
+func (lp *LearningParams) SetOptimizer(opt Optimizer) error {
+	if opt == nil {
+		return fmt.Errorf("Optimizer can not be nil")
+	}
+	lp.Optimizer = opt
+	return nil
+}
+
+// getOptimizer Returns optimization algorithm (SGD with momentum by default)
+func (lp *LearningParams) getOptimizer() Optimizer {
+	if lp.Optimizer == nil {
+		return NewOptimizerSGD()
+	}
+	return lp.Optimizer
+}
+
+// updateParameters Apply regularization to gradients and then call optimizer for given parameters
+/*
+	params - parameters of layer
+	gradients - ΔE/Δw
+	state - optimizer's state for parameters
+	isBias - are parameters biases (they are not regularized unless DecayBiases is set)
+*/
+func (lp *LearningParams) updateParameters(params, gradients *mat.Dense, state *OptimizerState, isBias bool) {
+	if (lp.L2Decay != 0 || lp.L1Decay != 0) && (!isBias || lp.DecayBiases) {
+		// ΔE/Δw + λ2 * w + λ1 * sign(w)
+		regularized := mat.DenseCopyOf(gradients)
+		rawRegularized := regularized.RawMatrix().Data
+		rawParams := params.RawMatrix().Data
+		for i := range rawRegularized {
+			rawRegularized[i] += lp.L2Decay * rawParams[i]
+			switch {
+			case rawParams[i] > 0:
+				rawRegularized[i] += lp.L1Decay
+			case rawParams[i] < 0:
+				rawRegularized[i] -= lp.L1Decay
+			}
+		}
+		gradients = regularized
+	}
+	lp.getOptimizer().Update(lp, params, gradients, state)
+}
+
+// learningParamsAlias Is needed to prevent recursion in (Un)MarshalJSON
+type learningParamsAlias LearningParams
+
+// MarshalJSON Custom marshaling for LearningParams (optimizer is stored with its hyperparameters)
+func (lp *LearningParams) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		*learningParamsAlias
+		Optimizer *OptimizerJSON `json:"optimizer"`
+	}{
+		learningParamsAlias: (*learningParamsAlias)(lp),
+		Optimizer:           optimizerToJSON(lp.getOptimizer()),
+	})
+}
+
+// UnmarshalJSON Custom unmarshaling for LearningParams (optimizer is restored with its hyperparameters)
+func (lp *LearningParams) UnmarshalJSON(data []byte) error {
+	aux := &struct {
+		*learningParamsAlias
+		Optimizer *OptimizerJSON `json:"optimizer"`
+	}{
+		learningParamsAlias: (*learningParamsAlias)(lp),
+	}
+	err := json.Unmarshal(data, aux)
+	if err != nil {
+		return err
+	}
+	// Files without optimizer section have been created with SGD (which was the only option)
+	lp.Optimizer = NewOptimizerSGD()
+	if aux.Optimizer != nil {
+		lp.Optimizer, err = optimizerFromJSON(aux.Optimizer)
+		if err != nil {
+			return err
+		}
 	}
-	lp.Momentum = v
 	return nil
 }
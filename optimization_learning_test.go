@@ -0,0 +1,47 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSetL2Decay(t *testing.T) {
+	lp := NewLearningParametersDefault()
+	err := lp.SetL2Decay(0.005)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if lp.L2Decay != 0.005 {
+		t.Errorf("λ2 should be %f, but got %f", 0.005, lp.L2Decay)
+	}
+	if lp.Momentum != 0.6 {
+		t.Errorf("Momentum should stay %f, but got %f", 0.6, lp.Momentum)
+	}
+}
+
+func TestRegularization(t *testing.T) {
+	lp := &LearningParams{LearningRate: 0.1, Momentum: 0.0, L2Decay: 0.5, L1Decay: 0.1}
+	zeroGradients := mat.NewDense(1, 3, nil)
+
+	// w = w - η * (λ2 * w + λ1 * sign(w))
+	weights := mat.NewDense(1, 3, []float64{2, -2, 0})
+	lp.updateParameters(weights, zeroGradients, NewOptimizerState(1, 3), false)
+	correct := []float64{2 - 0.1*(1+0.1), -2 + 0.1*(1+0.1), 0}
+	for i, v := range weights.RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-12 {
+			t.Errorf("Weight in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+
+	// Biases are excluded from regularization by default
+	biases := mat.NewDense(1, 3, []float64{2, -2, 0})
+	lp.updateParameters(biases, zeroGradients, NewOptimizerState(1, 3), true)
+	for i, v := range biases.RawMatrix().Data {
+		if v != []float64{2, -2, 0}[i] {
+			t.Errorf("Bias in position %d should not be changed, but got %f", i, v)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	defaultBeta1   = 0.9
+	defaultBeta2   = 0.999
+	defaultEpsilon = 1e-8
+	defaultRho     = 0.9
+	// defaultAdamWDecay Default coefficient for decoupled weight decay (AdamW)
+	defaultAdamWDecay = 0.01
+)
+
+// Optimizer Interface for optimization algorithms. Layers hand their parameters and gradients to optimizer
+type Optimizer interface {
+	// Update Update parameters in-place
+	/*
+		lp - learning parameters (learning rate η and momentum α are taken from there)
+		params - w, parameters of layer
+		gradients - ΔE/Δw, gradients of loss function with respect to parameters
+		state - optimizer's state for this exact parameters (it is being updated also)
+	*/
+	Update(lp *LearningParams, params, gradients *mat.Dense, state *OptimizerState)
+
+	// GetType Returns type of optimizer in string representation
+	GetType() string
+}
+
+// OptimizerState Per-parameter state of optimizer
+/*
+	Velocity - momentum for SGD (or first moment estimation for Adam)
+	Cache - accumulated squared gradients (or second moment estimation for Adam)
+	Step - number of updates done
+*/
+type OptimizerState struct {
+	Velocity *mat.Dense
+	Cache    *mat.Dense
+	Step     int
+}
+
+// NewOptimizerState Constructor for optimizer's state. You need to specify dimensions of corresponding parameters
+func NewOptimizerState(r, c int) *OptimizerState {
+	return &OptimizerState{
+		Velocity: mat.NewDense(r, c, nil),
+		Cache:    mat.NewDense(r, c, nil),
+	}
+}
+
+// prepare Makes sure that state's buffers fit parameters' dimensions
+func (state *OptimizerState) prepare(params *mat.Dense) {
+	r, c := params.Dims()
+	if state.Velocity == nil || state.Velocity.IsEmpty() {
+		state.Velocity = mat.NewDense(r, c, nil)
+	}
+	if state.Cache == nil || state.Cache.IsEmpty() {
+		state.Cache = mat.NewDense(r, c, nil)
+	}
+}
+
+// OptimizerSGD Stochastic gradient descent with momentum (inertia)
+/*
+	v = α * v - η * (1 - α) * ΔE/Δw
+	w = w + v
+	Nesterov version evaluates gradient at "look-ahead" position:
+	w = w - α * v{prev} + (1 + α) * v
+*/
+type OptimizerSGD struct {
+	Nesterov bool
+}
+
+// NewOptimizerSGD Constructor for SGD (with momentum) optimizer. This is default optimizer
+func NewOptimizerSGD() Optimizer {
+	return &OptimizerSGD{}
+}
+
+// NewOptimizerNesterov Constructor for SGD optimizer with Nesterov momentum
+func NewOptimizerNesterov() Optimizer {
+	return &OptimizerSGD{Nesterov: true}
+}
+
+// Update See ref. Optimizer.Update()
+func (opt *OptimizerSGD) Update(lp *LearningParams, params, gradients *mat.Dense, state *OptimizerState) {
+	state.prepare(params)
+	state.Step++
+
+	Δw := &mat.Dense{}
+	Δw.Scale(-1.0*lp.LearningRate, gradients)
+
+	// Inertia (as separated Scale() call)
+	Δw.Scale(1.0-lp.Momentum, Δw)
+
+	if !opt.Nesterov {
+		state.Velocity.Scale(lp.Momentum, state.Velocity)
+		Δw.Add(Δw, state.Velocity)
+		state.Velocity.Copy(Δw)
+
+		// Update weights: w = w + Δw
+		params.Add(params, Δw)
+		return
+	}
+
+	previous := mat.DenseCopyOf(state.Velocity)
+	state.Velocity.Scale(lp.Momentum, state.Velocity)
+	state.Velocity.Add(state.Velocity, Δw)
+
+	// Update weights: w = w - α * v{prev} + (1 + α) * v
+	previous.Scale(-1.0*lp.Momentum, previous)
+	Δw.Scale(1.0+lp.Momentum, state.Velocity)
+	Δw.Add(Δw, previous)
+	params.Add(params, Δw)
+}
+
+// GetType Returns "sgd" or "nesterov" as optimizer's type
+func (opt *OptimizerSGD) GetType() string {
+	if opt.Nesterov {
+		return "nesterov"
+	}
+	return "sgd"
+}
+
+// OptimizerAdam Adaptive moment estimation. See ref. https://arxiv.org/abs/1412.6980
+/*
+	m = β1 * m + (1 - β1) * ΔE/Δw
+	v = β2 * v + (1 - β2) * (ΔE/Δw)^2
+	w = w - η * m' / (sqrt(v') + ε), where m' and v' are bias-corrected moments
+	For AdamW (Decoupled == true) weight decay is applied also: w = w - η * λ * w. See ref. https://arxiv.org/abs/1711.05101
+*/
+type OptimizerAdam struct {
+	Beta1       float64
+	Beta2       float64
+	Epsilon     float64
+	WeightDecay float64
+	Decoupled   bool
+}
+
+// NewOptimizerAdam Constructor for Adam optimizer with default hyperparameters (β1 = 0.9, β2 = 0.999, ε = 1e-8)
+func NewOptimizerAdam() Optimizer {
+	return &OptimizerAdam{
+		Beta1:   defaultBeta1,
+		Beta2:   defaultBeta2,
+		Epsilon: defaultEpsilon,
+	}
+}
+
+// NewOptimizerAdamW Constructor for AdamW optimizer with default hyperparameters (β1 = 0.9, β2 = 0.999, ε = 1e-8). You need to specify coefficient λ for decoupled weight decay
+func NewOptimizerAdamW(weightDecay float64) Optimizer {
+	if weightDecay < 0 {
+		fmt.Printf("Warning: λ (weight decay) can not be less than zero. Setting default value which is %v\n", defaultAdamWDecay)
+		weightDecay = defaultAdamWDecay
+	}
+	return &OptimizerAdam{
+		Beta1:       defaultBeta1,
+		Beta2:       defaultBeta2,
+		Epsilon:     defaultEpsilon,
+		WeightDecay: weightDecay,
+		Decoupled:   true,
+	}
+}
+
+// Update See ref. Optimizer.Update()
+func (opt *OptimizerAdam) Update(lp *LearningParams, params, gradients *mat.Dense, state *OptimizerState) {
+	state.prepare(params)
+	state.Step++
+
+	rawParams := params.RawMatrix().Data
+	rawGrads := gradients.RawMatrix().Data
+	rawM := state.Velocity.RawMatrix().Data
+	rawV := state.Cache.RawMatrix().Data
+
+	correction1 := 1.0 - math.Pow(opt.Beta1, float64(state.Step))
+	correction2 := 1.0 - math.Pow(opt.Beta2, float64(state.Step))
+	for i := range rawParams {
+		g := rawGrads[i]
+		rawM[i] = opt.Beta1*rawM[i] + (1.0-opt.Beta1)*g
+		rawV[i] = opt.Beta2*rawV[i] + (1.0-opt.Beta2)*g*g
+		if opt.Decoupled {
+			rawParams[i] -= lp.LearningRate * opt.WeightDecay * rawParams[i]
+		}
+		mHat := rawM[i] / correction1
+		vHat := rawV[i] / correction2
+		rawParams[i] -= lp.LearningRate * mHat / (math.Sqrt(vHat) + opt.Epsilon)
+	}
+}
+
+// GetType Returns "adam" or "adamw" as optimizer's type
+func (opt *OptimizerAdam) GetType() string {
+	if opt.Decoupled {
+		return "adamw"
+	}
+	return "adam"
+}
+
+// OptimizerRMSProp Root mean square propagation
+/*
+	c = ρ * c + (1 - ρ) * (ΔE/Δw)^2
+	w = w - η * ΔE/Δw / (sqrt(c) + ε)
+*/
+type OptimizerRMSProp struct {
+	Rho     float64
+	Epsilon float64
+}
+
+// NewOptimizerRMSProp Constructor for RMSProp optimizer with default hyperparameters (ρ = 0.9, ε = 1e-8)
+func NewOptimizerRMSProp() Optimizer {
+	return &OptimizerRMSProp{
+		Rho:     defaultRho,
+		Epsilon: defaultEpsilon,
+	}
+}
+
+// Update See ref. Optimizer.Update()
+func (opt *OptimizerRMSProp) Update(lp *LearningParams, params, gradients *mat.Dense, state *OptimizerState) {
+	state.prepare(params)
+	state.Step++
+
+	rawParams := params.RawMatrix().Data
+	rawGrads := gradients.RawMatrix().Data
+	rawCache := state.Cache.RawMatrix().Data
+	for i := range rawParams {
+		g := rawGrads[i]
+		rawCache[i] = opt.Rho*rawCache[i] + (1.0-opt.Rho)*g*g
+		rawParams[i] -= lp.LearningRate * g / (math.Sqrt(rawCache[i]) + opt.Epsilon)
+	}
+}
+
+// GetType Returns "rmsprop" as optimizer's type
+func (opt *OptimizerRMSProp) GetType() string {
+	return "rmsprop"
+}
+
+// OptimizerAdaGrad Adaptive gradient algorithm
+/*
+	c = c + (ΔE/Δw)^2
+	w = w - η * ΔE/Δw / (sqrt(c) + ε)
+*/
+type OptimizerAdaGrad struct {
+	Epsilon float64
+}
+
+// NewOptimizerAdaGrad Constructor for AdaGrad optimizer with default hyperparameters (ε = 1e-8)
+func NewOptimizerAdaGrad() Optimizer {
+	return &OptimizerAdaGrad{
+		Epsilon: defaultEpsilon,
+	}
+}
+
+// Update See ref. Optimizer.Update()
+func (opt *OptimizerAdaGrad) Update(lp *LearningParams, params, gradients *mat.Dense, state *OptimizerState) {
+	state.prepare(params)
+	state.Step++
+
+	rawParams := params.RawMatrix().Data
+	rawGrads := gradients.RawMatrix().Data
+	rawCache := state.Cache.RawMatrix().Data
+	for i := range rawParams {
+		g := rawGrads[i]
+		rawCache[i] += g * g
+		rawParams[i] -= lp.LearningRate * g / (math.Sqrt(rawCache[i]) + opt.Epsilon)
+	}
+}
+
+// GetType Returns "adagrad" as optimizer's type
+func (opt *OptimizerAdaGrad) GetType() string {
+	return "adagrad"
+}
+
+// OptimizerJSON JSON representation of optimizer and its hyperparameters. Hyperparameters which are missing in JSON take default values of corresponding constructor
+type OptimizerJSON struct {
+	OptimizerType string   `json:"optimizer_type"`
+	Beta1         *float64 `json:"beta1,omitempty"`
+	Beta2         *float64 `json:"beta2,omitempty"`
+	Epsilon       *float64 `json:"epsilon,omitempty"`
+	Rho           *float64 `json:"rho,omitempty"`
+	WeightDecay   *float64 `json:"weight_decay,omitempty"`
+}
+
+// optimizerToJSON Prepare JSON representation of optimizer
+func optimizerToJSON(opt Optimizer) *OptimizerJSON {
+	ans := &OptimizerJSON{
+		OptimizerType: opt.GetType(),
+	}
+	switch v := opt.(type) {
+	case *OptimizerAdam:
+		ans.Beta1 = jsonFloat(v.Beta1)
+		ans.Beta2 = jsonFloat(v.Beta2)
+		ans.Epsilon = jsonFloat(v.Epsilon)
+		ans.WeightDecay = jsonFloat(v.WeightDecay)
+		break
+	case *OptimizerRMSProp:
+		ans.Rho = jsonFloat(v.Rho)
+		ans.Epsilon = jsonFloat(v.Epsilon)
+		break
+	case *OptimizerAdaGrad:
+		ans.Epsilon = jsonFloat(v.Epsilon)
+		break
+	default:
+		break
+	}
+	return ans
+}
+
+// optimizerFromJSON Create optimizer from its JSON representation
+func optimizerFromJSON(data *OptimizerJSON) (Optimizer, error) {
+	switch data.OptimizerType {
+	case "sgd":
+		return NewOptimizerSGD(), nil
+	case "nesterov":
+		return NewOptimizerNesterov(), nil
+	case "adam", "adamw":
+		opt := NewOptimizerAdam().(*OptimizerAdam)
+		if data.OptimizerType == "adamw" {
+			opt = NewOptimizerAdamW(defaultAdamWDecay).(*OptimizerAdam)
+		}
+		overrideFloat(&opt.Beta1, data.Beta1)
+		overrideFloat(&opt.Beta2, data.Beta2)
+		overrideFloat(&opt.Epsilon, data.Epsilon)
+		overrideFloat(&opt.WeightDecay, data.WeightDecay)
+		return opt, nil
+	case "rmsprop":
+		opt := NewOptimizerRMSProp().(*OptimizerRMSProp)
+		overrideFloat(&opt.Rho, data.Rho)
+		overrideFloat(&opt.Epsilon, data.Epsilon)
+		return opt, nil
+	case "adagrad":
+		opt := NewOptimizerAdaGrad().(*OptimizerAdaGrad)
+		overrideFloat(&opt.Epsilon, data.Epsilon)
+		return opt, nil
+	default:
+		return nil, fmt.Errorf("Unrecognized optimizer type: %s", data.OptimizerType)
+	}
+}
+
+// jsonFloat Returns pointer to copy of value (for optional fields of JSON)
+func jsonFloat(v float64) *float64 {
+	return &v
+}
+
+// overrideFloat Sets value of hyperparameter if it is present in JSON
+func overrideFloat(dst *float64, src *float64) {
+	if src != nil {
+		*dst = *src
+	}
+}
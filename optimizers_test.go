@@ -0,0 +1,116 @@
+package cnns
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestOptimizerSGD(t *testing.T) {
+	lp := &LearningParams{LearningRate: 0.1, Momentum: 0.5}
+	params := mat.NewDense(1, 2, []float64{1, -1})
+	state := NewOptimizerState(1, 2)
+	opt := NewOptimizerSGD()
+	// v = 0.5 * 0 - 0.1 * 0.5 * g
+	opt.Update(lp, params, mat.NewDense(1, 2, []float64{2, -4}), state)
+	correct := []float64{0.9, -0.8}
+	for i, v := range params.RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-12 {
+			t.Errorf("Parameter in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+}
+
+// TestOptimizersConvergence Every optimizer should minimize f(w) = Σ(w - 3)^2
+func TestOptimizersConvergence(t *testing.T) {
+	cases := []struct {
+		opt          Optimizer
+		learningRate float64
+	}{
+		{NewOptimizerSGD(), 0.05},
+		{NewOptimizerNesterov(), 0.05},
+		{NewOptimizerAdam(), 0.05},
+		{NewOptimizerAdamW(0.0001), 0.05},
+		{NewOptimizerRMSProp(), 0.05},
+		{NewOptimizerAdaGrad(), 0.5},
+	}
+	for _, c := range cases {
+		opt := c.opt
+		lp := &LearningParams{LearningRate: c.learningRate, Momentum: 0.6, Optimizer: opt}
+		params := mat.NewDense(2, 2, []float64{-1, 0, 5, 10})
+		state := NewOptimizerState(2, 2)
+		for step := 0; step < 3000; step++ {
+			grads := mat.NewDense(2, 2, nil)
+			grads.Apply(func(i, j int, v float64) float64 {
+				return 2 * (v - 3)
+			}, params)
+			lp.getOptimizer().Update(lp, params, grads, state)
+		}
+		for i, v := range params.RawMatrix().Data {
+			if math.Abs(v-3) > 0.05 {
+				t.Errorf("Optimizer '%s': parameter in position %d should converge to 3, but got %f", opt.GetType(), i, v)
+			}
+		}
+		if state.Step != 3000 {
+			t.Errorf("Optimizer '%s': number of steps should be %d, but got %d", opt.GetType(), 3000, state.Step)
+		}
+	}
+}
+
+func TestLearningParamsJSON(t *testing.T) {
+	lp := NewLearningParametersDefault()
+	opt := NewOptimizerAdamW(0.02).(*OptimizerAdam)
+	opt.Beta1 = 0.8
+	lp.SetOptimizer(opt)
+	bytes, err := json.Marshal(lp)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	restored := &LearningParams{}
+	err = json.Unmarshal(bytes, restored)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if restored.LearningRate != lp.LearningRate || restored.Momentum != lp.Momentum {
+		t.Errorf("Learning rate and momentum should be %f and %f, but got %f and %f", lp.LearningRate, lp.Momentum, restored.LearningRate, restored.Momentum)
+	}
+	adamw, ok := restored.Optimizer.(*OptimizerAdam)
+	if !ok || adamw.GetType() != "adamw" {
+		t.Errorf("Optimizer should be 'adamw', but got '%s'", restored.Optimizer.GetType())
+		return
+	}
+	if adamw.Beta1 != 0.8 || adamw.Beta2 != defaultBeta2 || adamw.WeightDecay != 0.02 {
+		t.Errorf("Hyperparameters of optimizer have not been restored: %+v", adamw)
+	}
+}
+
+func TestOptimizerJSONDefaults(t *testing.T) {
+	cases := map[string]Optimizer{
+		`{"optimizer_type":"adam"}`:                          NewOptimizerAdam(),
+		`{"optimizer_type":"adamw"}`:                         NewOptimizerAdamW(defaultAdamWDecay),
+		`{"optimizer_type":"rmsprop"}`:                       NewOptimizerRMSProp(),
+		`{"optimizer_type":"adagrad"}`:                       NewOptimizerAdaGrad(),
+		`{"optimizer_type":"adam","beta2":0,"epsilon":1e-6}`: &OptimizerAdam{Beta1: defaultBeta1, Beta2: 0, Epsilon: 1e-6},
+	}
+	for source, expected := range cases {
+		data := &OptimizerJSON{}
+		err := json.Unmarshal([]byte(source), data)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		opt, err := optimizerFromJSON(data)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(opt, expected) {
+			t.Errorf("Optimizer restored from %s should be %+v, but got %+v", source, expected, opt)
+		}
+	}
+}
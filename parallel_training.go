@@ -0,0 +1,444 @@
+package cnns
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// replicableLayer Layer which can be copied for worker goroutine (see Predict() and CalculateBatchGradients())
+type replicableLayer interface {
+	// replicate Returns new layer with the same configuration, but with own buffers for outputs and gradients
+	replicate() Layer
+}
+
+// trainableReplica Layer with trainable parameters which can be trained in data-parallel way
+type trainableReplica interface {
+	// mergeGradients Adds gradients accumulated by replica to layer's gradients and resets replica's ones
+	mergeGradients(replica Layer)
+}
+
+// batchStatisticsLayer Layer which output and gradients depend on whole mini-batch (e.g. batch normalization layer). See CalculateBatchGradients()
+type batchStatisticsLayer interface {
+	// resetBatchStatistics Drop statistics (and sums of gradients) of previous mini-batch
+	resetBatchStatistics()
+	// accumulateBatchStatistics Accumulate statistics for single sample of mini-batch
+	accumulateBatchStatistics(input *mat.Dense) error
+	// mergeBatchStatistics Adds statistics accumulated by replica to layer's ones and resets replica's ones
+	mergeBatchStatistics(replica Layer)
+	// finalizeBatchStatistics Evaluate statistics of mini-batch after all samples have been accumulated
+	finalizeBatchStatistics() error
+	// shareBatchStatistics Copies statistics of mini-batch to replica
+	shareBatchStatistics(replica Layer)
+	// resetBatchGradients Drop sums of incoming gradients
+	resetBatchGradients()
+	// accumulateBatchGradients Accumulate sums of incoming gradients for single sample (for input of last forward pass)
+	accumulateBatchGradients(errorsDense *mat.Dense) error
+	// mergeBatchGradients Adds sums of incoming gradients accumulated by replica to layer's ones and resets replica's ones
+	mergeBatchGradients(replica Layer)
+	// finalizeBatchGradients Marks sums of incoming gradients as ready for backward pass
+	finalizeBatchGradients()
+	// shareBatchGradients Copies sums of incoming gradients to replica
+	shareBatchGradients(replica Layer)
+	// minBatchSize Returns minimal number of samples in mini-batch which layer can be trained with
+	minBatchSize() int
+}
+
+// batchTrainer Replicas of net's layers for worker goroutines (worker #0 uses net's layers themselves)
+/*
+	source - layers of net which replicas have been made of
+	replicas - layers of workers #1, #2 and so on
+	rands - sources of randomness of workers (for random layers, e.g. dropout)
+*/
+type batchTrainer struct {
+	source   []Layer
+	replicas [][]Layer
+	rands    []*rand.Rand
+}
+
+// getTrainer Returns replicas of net's layers for provided number of workers (they are reused while layers of net are the same)
+func (wh *WholeNet) getTrainer(workersNum int) (*batchTrainer, error) {
+	trainer := wh.trainer
+	if trainer == nil || !sameLayers(trainer.source, wh.Layers) {
+		trainer = &batchTrainer{
+			source:   make([]Layer, len(wh.Layers)),
+			replicas: [][]Layer{},
+			rands:    []*rand.Rand{rand.New(newCountingSource(0))},
+		}
+		copy(trainer.source, wh.Layers)
+		wh.trainer = trainer
+	}
+	for w := len(trainer.replicas) + 1; w < workersNum; w++ {
+		replica := make([]Layer, len(wh.Layers))
+		r := rand.New(newCountingSource(0))
+		for l := range wh.Layers {
+			layer, ok := wh.Layers[l].(replicableLayer)
+			if !ok {
+				return nil, fmt.Errorf("Layer #%d of type '%s' does not support data-parallel training", l, wh.Layers[l].GetType())
+			}
+			replica[l] = layer.replicate()
+			if trainMode, ok := replica[l].(trainModeLayer); ok {
+				trainMode.SetTrainMode(true)
+			}
+			if randomized, ok := replica[l].(randomizedLayer); ok {
+				randomized.setRand(r)
+			}
+		}
+		trainer.replicas = append(trainer.replicas, replica)
+		trainer.rands = append(trainer.rands, r)
+	}
+	return trainer, nil
+}
+
+// checkBatchSize Checks if every layer can be trained with mini-batches which are made of provided number of samples
+/*
+	batchSize - size of mini-batch
+	samplesNum - number of training samples (last mini-batch could be smaller than others)
+*/
+func (wh *WholeNet) checkBatchSize(batchSize, samplesNum int) error {
+	if samplesNum == 0 {
+		return nil
+	}
+	smallest := batchSize
+	if samplesNum < batchSize {
+		smallest = samplesNum
+	} else if samplesNum%batchSize != 0 {
+		smallest = samplesNum % batchSize
+	}
+	for l := range wh.Layers {
+		layer, ok := wh.Layers[l].(batchStatisticsLayer)
+		if !ok {
+			continue
+		}
+		if need := layer.minBatchSize(); smallest < need {
+			return errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s) needs at least %d samples in mini-batch, but there is mini-batch of %d samples (%d samples, batch size %d). See LearningParams.SetBatchSize()", l, wh.Layers[l].GetType(), need, smallest, samplesNum, batchSize)
+		}
+	}
+	return nil
+}
+
+// batchPass Forward and backward passes over mini-batch split between workers (see CalculateBatchGradients())
+/*
+	workers - layers of every worker. Sample i is processed by worker i % len(workers)
+	rands - sources of randomness of workers
+	seeds - seeds of random layers for every sample (nil if random layers use their own sources)
+	statistics - indices of layers which depend on whole mini-batch (see batchStatisticsLayer)
+	inputs - input data of every stage for every sample: inputs[k][i] is input of i-th sample for layer statistics[k-1] (inputs[0] is input of net)
+*/
+type batchPass struct {
+	workers    [][]Layer
+	rands      []*rand.Rand
+	seeds      []int64
+	statistics []int
+	inputs     [][]*mat.Dense
+}
+
+// newBatchPass Returns pass over mini-batch for provided layers of workers
+func (wh *WholeNet) newBatchPass(workers [][]Layer, inputs []*mat.Dense) *batchPass {
+	pass := &batchPass{
+		workers:    workers,
+		statistics: []int{},
+		inputs:     [][]*mat.Dense{inputs},
+	}
+	for l := range wh.Layers {
+		if _, ok := wh.Layers[l].(batchStatisticsLayer); ok {
+			pass.statistics = append(pass.statistics, l)
+		}
+	}
+	return pass
+}
+
+// layerSeed Returns seed of random layer for sample, so sample gets the same random values whenever layer is evaluated
+func (pass *batchPass) layerSeed(i, l int) int64 {
+	return int64(restoreCountingSource(pass.seeds[i], uint64(l)).Uint64())
+}
+
+// forward Forward pass of i-th sample through layers [from; to) of its worker. Returns output of last layer
+func (pass *batchPass) forward(i, from, to int, input *mat.Dense) (*mat.Dense, error) {
+	w := i % len(pass.workers)
+	layers := pass.workers[w]
+	for l := from; l < to; l++ {
+		if _, ok := layers[l].(randomizedLayer); ok && pass.seeds != nil {
+			pass.rands[w].Seed(pass.layerSeed(i, l))
+		}
+		err := layers[l].FeedForward(input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't call FeedForward() on layer #%d for input #%d", l, i)
+		}
+		input = layers[l].GetActivatedOutput()
+	}
+	return input, nil
+}
+
+// backward Backward pass of i-th sample through layers [from; to) of its worker. Returns gradients for input of layer from
+func (pass *batchPass) backward(i, from, to int, errorsDense *mat.Dense) (*mat.Dense, error) {
+	layers := pass.workers[i%len(pass.workers)]
+	for l := to - 1; l >= from; l-- {
+		err := layers[l].CalculateGradients(errorsDense)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't call CalculateGradients() on layer #%d for input #%d", l, i)
+		}
+		errorsDense = layers[l].GetGradients()
+	}
+	return errorsDense, nil
+}
+
+// prepareStatistics Evaluate statistics of mini-batch for every batchStatisticsLayer: every layer is evaluated once for every sample.
+// Inputs of batchStatisticsLayer are kept for backward pass
+func (pass *batchPass) prepareStatistics() error {
+	samplesNum := len(pass.inputs[0])
+	for k, b := range pass.statistics {
+		from := 0
+		if k > 0 {
+			from = pass.statistics[k-1]
+		}
+		for w := range pass.workers {
+			pass.workers[w][b].(batchStatisticsLayer).resetBatchStatistics()
+		}
+		stageInputs := make([]*mat.Dense, samplesNum)
+		err := parallelFor(samplesNum, len(pass.workers), func(i int) error {
+			output, err := pass.forward(i, from, b, pass.inputs[k][i])
+			if err != nil {
+				return err
+			}
+			stageInputs[i] = mat.DenseCopyOf(output)
+			return pass.workers[i%len(pass.workers)][b].(batchStatisticsLayer).accumulateBatchStatistics(output)
+		})
+		if err != nil {
+			return err
+		}
+		pass.inputs = append(pass.inputs, stageInputs)
+		// Statistics of workers are merged in order of workers, so result does not depend on goroutines scheduling
+		layer := pass.workers[0][b].(batchStatisticsLayer)
+		for w := 1; w < len(pass.workers); w++ {
+			layer.mergeBatchStatistics(pass.workers[w][b])
+		}
+		err = layer.finalizeBatchStatistics()
+		if err != nil {
+			return errors.Wrapf(err, "Layer #%d", b)
+		}
+		for w := 1; w < len(pass.workers); w++ {
+			layer.shareBatchStatistics(pass.workers[w][b])
+		}
+	}
+	return nil
+}
+
+// calculateGradients Backward pass over mini-batch (statistics should be prepared already, see prepareStatistics()). Returns summed value of loss function
+/*
+	Layers are split into stages by batchStatisticsLayer: stage k starts with layer statistics[k-1] and ends before layer statistics[k].
+	Stages are processed from last one. Every sample is fed through stage again (from kept input), then gradients are propagated down to first layer of stage,
+	since gradients of batchStatisticsLayer need sums of incoming gradients over whole mini-batch
+*/
+func (pass *batchPass) calculateGradients(lossFunc Loss, desired []*mat.Dense) (float64, error) {
+	samplesNum := len(desired)
+	layersNum := len(pass.workers[0])
+	losses := make([]float64, samplesNum)
+	// Gradients for output of batchStatisticsLayer which ends current stage
+	var stageErrors []*mat.Dense
+	for k := len(pass.statistics); k >= 0; k-- {
+		from := 0
+		if k > 0 {
+			from = pass.statistics[k-1]
+		}
+		to := layersNum
+		if k < len(pass.statistics) {
+			to = pass.statistics[k]
+		}
+		if k > 0 {
+			for w := range pass.workers {
+				pass.workers[w][from].(batchStatisticsLayer).resetBatchGradients()
+			}
+		}
+		nextErrors := make([]*mat.Dense, samplesNum)
+		err := parallelFor(samplesNum, len(pass.workers), func(i int) error {
+			layers := pass.workers[i%len(pass.workers)]
+			// Layer which ends stage is evaluated again also, since worker has processed other samples since then
+			top := to
+			if k < len(pass.statistics) {
+				top = to + 1
+			}
+			output, err := pass.forward(i, from, top, pass.inputs[k][i])
+			if err != nil {
+				return err
+			}
+			var errorsDense *mat.Dense
+			if k < len(pass.statistics) {
+				// Gradients for output of layer which ends stage are known from previous stage
+				errorsDense = stageErrors[i]
+			} else {
+				// Error on last layer is defined by loss function (see WholeNet.CalculateGradients())
+				losses[i] = lossFunc.Value(desired[i], output)
+				if softmax, ok := layers[layersNum-1].(*SoftmaxLayer); ok && isCategoricalCrossEntropy(lossFunc) {
+					err = softmax.calculateCrossEntropyGradients(desired[i])
+					if err != nil {
+						return errors.Wrapf(err, "Can't call CalculateGradients() on last layer for input #%d", i)
+					}
+					errorsDense = softmax.GetGradients()
+					top = layersNum - 1
+				} else {
+					errorsDense = lossFunc.Gradient(desired[i], output)
+				}
+			}
+			if k == 0 {
+				_, err = pass.backward(i, 0, top, errorsDense)
+				return err
+			}
+			errorsDense, err = pass.backward(i, from+1, top, errorsDense)
+			if err != nil {
+				return err
+			}
+			nextErrors[i] = mat.DenseCopyOf(errorsDense)
+			return layers[from].(batchStatisticsLayer).accumulateBatchGradients(errorsDense)
+		})
+		if err != nil {
+			return 0.0, err
+		}
+		if k > 0 {
+			layer := pass.workers[0][from].(batchStatisticsLayer)
+			for w := 1; w < len(pass.workers); w++ {
+				layer.mergeBatchGradients(pass.workers[w][from])
+			}
+			layer.finalizeBatchGradients()
+			for w := 1; w < len(pass.workers); w++ {
+				layer.shareBatchGradients(pass.workers[w][from])
+			}
+		}
+		stageErrors = nextErrors
+	}
+	loss := 0.0
+	for i := range losses {
+		loss += losses[i]
+	}
+	return loss, nil
+}
+
+// CalculateBatchGradients Forward and backward passes over mini-batch without updating weights. Gradients are accumulated in layers until UpdateWeights() is called
+/*
+	inputs - input data of mini-batch
+	desired - target outputs of mini-batch
+
+	Layers which depend on whole mini-batch (e.g. batch normalization layer) get statistics and gradients of mini-batch.
+	Random layers (e.g. dropout layer) are seeded from net's source of randomness (see SetSeed()) for every sample
+	Returns summed value of loss function over mini-batch (evaluated in training mode before weights update)
+*/
+func (wh *WholeNet) CalculateBatchGradients(inputs []*mat.Dense, desired []*mat.Dense) (float64, error) {
+	return wh.calculateBatchGradients(inputs, desired, 1)
+}
+
+// calculateBatchGradients See CalculateBatchGradients()
+/*
+	workersNum - number of worker goroutines. Every worker owns replica of net's layers and processes its own shard of mini-batch,
+		then gradients (and statistics of mini-batch) of replicas are summed up in net's layers. Result does not depend on it up to floating point rounding
+*/
+func (wh *WholeNet) calculateBatchGradients(inputs []*mat.Dense, desired []*mat.Dense, workersNum int) (float64, error) {
+	if len(wh.Layers) == 0 {
+		return 0.0, ErrNoLayers
+	}
+	if len(inputs) != len(desired) {
+		return 0.0, fmt.Errorf("number of inputs not equal to number of desired")
+	}
+	if workersNum > len(inputs) {
+		workersNum = len(inputs)
+	}
+	if workersNum < 1 {
+		workersNum = 1
+	}
+	trainer, err := wh.getTrainer(workersNum)
+	if err != nil {
+		return 0.0, errors.Wrap(err, "Can't train net in data-parallel way")
+	}
+	workers := append([][]Layer{wh.Layers}, trainer.replicas[:workersNum-1]...)
+	for l := range wh.Layers {
+		if layer, ok := wh.Layers[l].(inferenceReplica); ok {
+			for w := 1; w < workersNum; w++ {
+				layer.shareParameters(workers[w][l])
+			}
+		}
+	}
+
+	pass := wh.newBatchPass(workers, inputs)
+	pass.rands = trainer.rands
+	for l := range wh.Layers {
+		if _, ok := wh.Layers[l].(randomizedLayer); !ok {
+			continue
+		}
+		if pass.seeds == nil {
+			// Seeds are drawn in order of samples, so random layers do not depend on number of workers
+			pass.seeds = make([]int64, len(inputs))
+			for i := range pass.seeds {
+				pass.seeds[i] = wh.int63()
+			}
+			// Layers of net are used by worker #0
+			defer wh.setRand(wh.rand)
+		}
+		wh.Layers[l].(randomizedLayer).setRand(trainer.rands[0])
+	}
+
+	err = pass.prepareStatistics()
+	if err != nil {
+		return 0.0, errors.Wrap(err, "Can't prepare statistics of mini-batch")
+	}
+	loss, err := pass.calculateGradients(wh.getLoss(), desired)
+	if err != nil {
+		return 0.0, errors.Wrap(err, "Can't calculate gradients for mini-batch")
+	}
+
+	// Gradients are reduced in order of workers, so result does not depend on goroutines scheduling
+	for l := range wh.Layers {
+		layer, ok := wh.Layers[l].(trainableReplica)
+		if !ok {
+			continue
+		}
+		for w := 1; w < workersNum; w++ {
+			layer.mergeGradients(workers[w][l])
+		}
+	}
+	return loss, nil
+}
+
+// parallelFor Calls f for every index in [0; n) using worker goroutines
+/*
+	n - number of indices
+	workersNum - number of worker goroutines. Indices are processed sequentially if it is <= 1
+	f - function for single index
+
+	Index i is always processed by worker i % workersNum, so indices of the same worker never run concurrently
+	Returns error of first failed worker (workers are checked in order, so result does not depend on goroutines scheduling)
+*/
+func parallelFor(n, workersNum int, f func(i int) error) error {
+	if workersNum <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			err := f(i)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, workersNum)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workersNum && w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workersNum {
+				err := f(i)
+				if err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cnns
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestTrainParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	inputs := make([]*mat.Dense, 20)
+	targets := make([]*mat.Dense, 20)
+	for i := range inputs {
+		inputs[i] = mat.NewDense(6, 6, nil)
+		for j := range inputs[i].RawMatrix().Data {
+			inputs[i].RawMatrix().Data[j] = r.Float64()
+		}
+		targets[i] = mat.NewDense(3, 1, nil)
+		targets[i].Set(i%3, 0, 1)
+	}
+
+	build := func() *WholeNet {
+		layersRand := rand.New(rand.NewSource(1))
+		net, err := NewSequential(&tensor.TDsize{X: 6, Y: 6, Z: 1}).
+			Conv(3, 3, 1, WithBias(), WithRand(layersRand)).
+			BatchNorm("channel").
+			PReLU().
+			Dropout(0.2).
+			Conv(3, 2, 1, WithBias(), WithRand(layersRand), WithPadding("same")).
+			MaxPool(2, 2).
+			Dense(3, WithBias(), WithRand(layersRand)).
+			Softmax().
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		net.LP.SetBatchSize(6)
+		net.Loss = NewLossCategoricalCrossEntropy()
+		net.SetSeed(3)
+		return net
+	}
+
+	single := build()
+	singleTrain, _, err := single.Train(inputs, targets, nil, nil, 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, workersNum := range []int{2, 4, 7} {
+		parallel := build()
+		parallelTrain, _, err := parallel.TrainParallel(inputs, targets, nil, nil, 3, workersNum)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if math.Abs(singleTrain-parallelTrain) > 1e-9 {
+			t.Errorf("Training error with %d workers should be %f, but got %f", workersNum, singleTrain, parallelTrain)
+		}
+		for l := range single.Layers {
+			if single.Layers[l].GetType() != "conv" && single.Layers[l].GetType() != "fc" && single.Layers[l].GetType() != "batchnorm" && single.Layers[l].GetType() != "prelu" {
+				continue
+			}
+			singleWeights := single.Layers[l].GetWeights()
+			parallelWeights := parallel.Layers[l].GetWeights()
+			for i := range singleWeights {
+				if !mat.EqualApprox(singleWeights[i], parallelWeights[i], 1e-9) {
+					t.Errorf("Weights #%d of layer #%d trained with %d workers should match single-threaded training", i, l, workersNum)
+				}
+			}
+		}
+	}
+}
@@ -75,9 +75,11 @@ func pool2D(matrix *mat.Dense, flattenMatrix []float64, y, startYi, startYj, out
 			flattenMatrix[y*outCols+x] = maxPool(part)
 			break
 		case poolMIN:
-			panic("poolMIN is not implemented")
+			flattenMatrix[y*outCols+x] = minPool(part)
+			break
 		case poolAVG:
-			panic("poolAVG is not implemented")
+			flattenMatrix[y*outCols+x] = avgPool(part)
+			break
 		default:
 			panic("default behaviour for pool_%TYPE% is not implemented")
 		}
@@ -98,9 +100,22 @@ func pool2DWithMasks(matrix, masks *mat.Dense, partialMasksIndices [][][2]int, f
 			flattenMatrix[y*outCols+x] = k
 			break
 		case poolMIN:
-			panic("poolMIN is not implemented (with masks)")
+			minX, minY, k := minPoolIdx(part)
+			partMask.Set(minX, minY, 1)
+			partialMasks[x] = [2]int{minX, minY}
+			flattenMatrix[y*outCols+x] = k
+			break
 		case poolAVG:
-			panic("poolAVG is not implemented (with masks)")
+			// Every element of window takes part in output, so there is no single index
+			rows, cols := partMask.Dims()
+			for i := 0; i < rows; i++ {
+				for j := 0; j < cols; j++ {
+					partMask.Set(i, j, partMask.At(i, j)+1.0/float64(rows*cols))
+				}
+			}
+			partialMasks[x] = [2]int{-1, -1}
+			flattenMatrix[y*outCols+x] = avgPool(part)
+			break
 		default:
 			panic("default behaviour for pool_%TYPE% is not implemented (with masks)")
 		}
@@ -129,3 +144,30 @@ func maxPoolIdx(m mat.Matrix) (int, int, float64) {
 func maxPool(m mat.Matrix) float64 {
 	return mat.Max(m)
 }
+
+func minPoolIdx(m mat.Matrix) (int, int, float64) {
+	min := math.Inf(1)
+	mini := -1
+	minj := -1
+	rows, cols := m.Dims()
+	for x := 0; x < rows; x++ {
+		for y := 0; y < cols; y++ {
+			val := m.At(x, y)
+			if val < min {
+				min = val
+				mini = x
+				minj = y
+			}
+		}
+	}
+	return mini, minj, min
+}
+
+func minPool(m mat.Matrix) float64 {
+	return mat.Min(m)
+}
+
+func avgPool(m mat.Matrix) float64 {
+	rows, cols := m.Dims()
+	return mat.Sum(m) / float64(rows*cols)
+}
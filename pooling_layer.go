@@ -215,13 +215,31 @@ func (pool *PoolingLayer) CalculateGradients(errorsDense *mat.Dense) error {
 		partialErrRows, partialErrCols := partialErrors.Dims()
 		partialMask := ExtractChannel(pool.Masks, maskR, maskC, channels, c)
 		partialMaskIndices := pool.masksIndices[c*maskIndicesSplit : maskIndicesSplit+c*maskIndicesSplit]
+		if pool.PoolingType == poolAVG {
+			// Mask contains weights of forward pass, so reset it before distributing gradients
+			partialMask.Zero()
+		}
 		for y := 0; y < partialErrRows; y++ {
 			startYi := y * stride
 			startYj := startYi + windowSize
 			for x := 0; x < partialErrCols; x++ {
 				startX := x * stride
 				part := partialMask.Slice(startYi, startYj, startX, startX+windowSize).(*mat.Dense)
-				part.Set(partialMaskIndices[y][x][0], partialMaskIndices[y][x][1], partialErrors.At(y, x))
+				switch pool.PoolingType {
+				case poolAVG:
+					// Gradient is distributed evenly over window
+					share := partialErrors.At(y, x) / float64(windowSize*windowSize)
+					for i := 0; i < windowSize; i++ {
+						for j := 0; j < windowSize; j++ {
+							part.Set(i, j, part.At(i, j)+share)
+						}
+					}
+					break
+				default:
+					// Gradient goes to max (or min) element of window only
+					part.Set(partialMaskIndices[y][x][0], partialMaskIndices[y][x][1], partialErrors.At(y, x))
+					break
+				}
 			}
 		}
 	}
@@ -264,3 +282,13 @@ func (pool *PoolingLayer) GetStride() int {
 func (pool *PoolingLayer) GetType() string {
 	return "pool"
 }
+
+// SetTrainMode Switch pooling layer to training (true) or inference (false) mode
+func (pool *PoolingLayer) SetTrainMode(mode bool) {
+	pool.trainMode = mode
+}
+
+// replicate Returns new pooling layer with the same configuration (see TrainParallel())
+func (pool *PoolingLayer) replicate() Layer {
+	return NewPoolingLayer(pool.inputSize, pool.Stride, pool.ExtendFilter, pool.PoolingType.String(), pool.ZeroPadding.String())
+}
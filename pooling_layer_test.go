@@ -0,0 +1,85 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestPoolingAvg(t *testing.T) {
+	pool := NewPoolingLayer(&tensor.TDsize{X: 4, Y: 4, Z: 1}, 2, 2, "avg", "valid")
+	input := mat.NewDense(4, 4, []float64{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+		13, 14, 15, 16,
+	})
+	err := pool.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{3.5, 5.5, 11.5, 13.5}
+	for i, v := range pool.GetActivatedOutput().RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-12 {
+			t.Errorf("Output in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+
+	err = pool.CalculateGradients(mat.NewDense(2, 2, []float64{4, 8, 12, 16}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correctGradients := []float64{
+		1, 1, 2, 2,
+		1, 1, 2, 2,
+		3, 3, 4, 4,
+		3, 3, 4, 4,
+	}
+	for i, v := range pool.GetGradients().RawMatrix().Data {
+		if math.Abs(v-correctGradients[i]) > 1e-12 {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, correctGradients[i], v)
+		}
+	}
+}
+
+func TestPoolingMin(t *testing.T) {
+	pool := NewPoolingLayer(&tensor.TDsize{X: 4, Y: 4, Z: 1}, 2, 2, "min", "valid")
+	input := mat.NewDense(4, 4, []float64{
+		1, 2, 3, 4,
+		5, 6, 0, 8,
+		9, 10, 11, 12,
+		13, -1, 15, 16,
+	})
+	err := pool.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{1, 0, -1, 11}
+	for i, v := range pool.GetActivatedOutput().RawMatrix().Data {
+		if v != correct[i] {
+			t.Errorf("Output in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+
+	err = pool.CalculateGradients(mat.NewDense(2, 2, []float64{4, 8, 12, 16}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correctGradients := []float64{
+		4, 0, 0, 0,
+		0, 0, 8, 0,
+		0, 0, 16, 0,
+		0, 12, 0, 0,
+	}
+	for i, v := range pool.GetGradients().RawMatrix().Data {
+		if v != correctGradients[i] {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, correctGradients[i], v)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package cnns
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// inferenceReplica Layer with parameters which can be shared with replica for inference
+type inferenceReplica interface {
+	// shareParameters Makes replica use the same (read-only) parameters as layer
+	shareParameters(replica Layer)
+}
+
+// predictor Replica of net's layers with own buffers for outputs (see Predict())
+/*
+	source - layers of net which replica has been made of
+	layers - replicas of layers
+*/
+type predictor struct {
+	source []Layer
+	layers []Layer
+}
+
+// newPredictor Returns replica of net's layers for inference
+func (wh *WholeNet) newPredictor() (*predictor, error) {
+	p := &predictor{
+		source: make([]Layer, len(wh.Layers)),
+		layers: make([]Layer, len(wh.Layers)),
+	}
+	copy(p.source, wh.Layers)
+	for l := range wh.Layers {
+		layer, ok := wh.Layers[l].(replicableLayer)
+		if !ok {
+			return nil, fmt.Errorf("Layer #%d of type '%s' does not support Predict()", l, wh.Layers[l].GetType())
+		}
+		// Replica is in inference mode by default
+		p.layers[l] = layer.replicate()
+	}
+	return p, nil
+}
+
+// matches Checks if predictor has been made of provided layers
+func (p *predictor) matches(layers []Layer) bool {
+	return sameLayers(p.source, layers)
+}
+
+// sameLayers Checks if both slices contain the same layers (not copies)
+func sameLayers(a, b []Layer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for l := range a {
+		if a[l] != b[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// getPredictor Returns predictor from pool (or new one if pool is empty or layers of net have been changed)
+func (wh *WholeNet) getPredictor() (*predictor, error) {
+	pool := wh.getPredictorsPool()
+	if p, ok := pool.Get().(*predictor); ok && p.matches(wh.Layers) {
+		return p, nil
+	}
+	return wh.newPredictor()
+}
+
+// getPredictorsPool Returns pool of predictors (it is created once on first call)
+func (wh *WholeNet) getPredictorsPool() *sync.Pool {
+	wh.predictorsOnce.Do(func() {
+		wh.predictors = &sync.Pool{}
+	})
+	return wh.predictors
+}
+
+// Predict Evaluates output of net for provided input in inference mode.
+// Layers of net are not modified (every call uses its own buffers for outputs), so it is safe to call Predict() from many goroutines
+// as long as weights are not changed (e.g. by Train()) at the same time
+/*
+	input - input data
+
+	Returns copy of net's output, so caller owns it
+*/
+func (wh *WholeNet) Predict(input *mat.Dense) (*mat.Dense, error) {
+	if len(wh.Layers) == 0 {
+		return nil, ErrNoLayers
+	}
+	p, err := wh.getPredictor()
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't call Predict() on neural net")
+	}
+	// Predictor is returned to pool even if forward pass fails: its buffers are overwritten by next call anyway
+	defer wh.getPredictorsPool().Put(p)
+	for l := range wh.Layers {
+		if layer, ok := wh.Layers[l].(inferenceReplica); ok {
+			layer.shareParameters(p.layers[l])
+		}
+	}
+	output, err := p.feedForward(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't call Predict() on neural net")
+	}
+	return output, nil
+}
+
+// feedForward Forward pass through replicas of layers. Returns copy of output of last layer
+func (p *predictor) feedForward(input *mat.Dense) (*mat.Dense, error) {
+	for l := range p.layers {
+		err := p.layers[l].FeedForward(input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Layer #%d", l)
+		}
+		input = p.layers[l].GetActivatedOutput()
+	}
+	return mat.DenseCopyOf(input), nil
+}
+
+// batchInferenceLayer Layer which can evaluate outputs for several inputs at once
+type batchInferenceLayer interface {
+	// predictBatch Returns outputs for every input in inference mode without modifying layer
+	predictBatch(inputs []*mat.Dense) ([]*mat.Dense, error)
+}
+
+// PredictBatch Evaluates outputs of net for several inputs in inference mode (see Predict()).
+// Fully-connected layers process all inputs by single matrix multiplication, convolutional layers apply im2col to all inputs at once;
+// other layers process inputs one by one. It is safe to call PredictBatch() from many goroutines as long as weights are not changed at the same time
+/*
+	inputs - input data
+
+	Returns outputs (owned by caller) in the same order as inputs
+*/
+func (wh *WholeNet) PredictBatch(inputs []*mat.Dense) ([]*mat.Dense, error) {
+	if len(wh.Layers) == 0 {
+		return nil, ErrNoLayers
+	}
+	if len(inputs) == 0 {
+		return []*mat.Dense{}, nil
+	}
+	p, err := wh.getPredictor()
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't call PredictBatch() on neural net")
+	}
+	defer wh.getPredictorsPool().Put(p)
+	outputs := inputs
+	for l := range wh.Layers {
+		if layer, ok := wh.Layers[l].(batchInferenceLayer); ok {
+			outputs, err = layer.predictBatch(outputs)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Can't call PredictBatch() on neural net: layer #%d", l)
+			}
+			continue
+		}
+		if layer, ok := wh.Layers[l].(inferenceReplica); ok {
+			layer.shareParameters(p.layers[l])
+		}
+		layerOutputs := make([]*mat.Dense, len(outputs))
+		for n := range outputs {
+			err = p.layers[l].FeedForward(outputs[n])
+			if err != nil {
+				return nil, errors.Wrapf(err, "Can't call PredictBatch() on neural net: layer #%d, input #%d", l, n)
+			}
+			// Buffers of replica are reused for next input
+			layerOutputs[n] = mat.DenseCopyOf(p.layers[l].GetActivatedOutput())
+		}
+		outputs = layerOutputs
+	}
+	return outputs, nil
+}
+
+// PredictBatchParallel Evaluates outputs of net for several inputs in inference mode (see PredictBatch()): inputs are split into chunks which are processed by worker goroutines
+/*
+	inputs - input data
+	workersNum - number of worker goroutines. If workersNum <= 1 then it is the same as PredictBatch()
+
+	Returns outputs (owned by caller) in the same order as inputs
+*/
+func (wh *WholeNet) PredictBatchParallel(inputs []*mat.Dense, workersNum int) ([]*mat.Dense, error) {
+	if workersNum <= 1 || len(inputs) <= 1 {
+		return wh.PredictBatch(inputs)
+	}
+	chunkSize := (len(inputs) + workersNum - 1) / workersNum
+	outputs := make([]*mat.Dense, len(inputs))
+	errs := make([]error, workersNum)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workersNum; w++ {
+		chunkStart := w * chunkSize
+		chunkEnd := chunkStart + chunkSize
+		if chunkEnd > len(inputs) {
+			chunkEnd = len(inputs)
+		}
+		if chunkStart >= chunkEnd {
+			break
+		}
+		wg.Add(1)
+		go func(w, chunkStart, chunkEnd int) {
+			defer wg.Done()
+			chunkOutputs, err := wh.PredictBatch(inputs[chunkStart:chunkEnd])
+			if err != nil {
+				errs[w] = errors.Wrapf(err, "Worker #%d", w)
+				return
+			}
+			copy(outputs[chunkStart:chunkEnd], chunkOutputs)
+		}(w, chunkStart, chunkEnd)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
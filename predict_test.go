@@ -0,0 +1,206 @@
+package cnns
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestPredict(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	net, err := NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 1}).
+		Conv(3, 2, 1, WithBias(), WithRand(r), WithPadding("same")).
+		BatchNorm("channel").
+		PReLU().
+		AvgPool(2, 2).
+		Dropout(0.5).
+		Dense(4, WithRand(r)).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	inputs := make([]*mat.Dense, 10)
+	expected := make([]*mat.Dense, len(inputs))
+	for i := range inputs {
+		inputs[i] = mat.NewDense(8, 8, nil)
+		for j := range inputs[i].RawMatrix().Data {
+			inputs[i].RawMatrix().Data[j] = r.NormFloat64()
+		}
+		err := net.FeedForward(inputs[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		expected[i] = mat.DenseCopyOf(net.GetOutput())
+	}
+	lastOutput := mat.DenseCopyOf(net.GetOutput())
+
+	wg := sync.WaitGroup{}
+	errs := make([]error, 8)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for k := 0; k < 50; k++ {
+				i := (w + k) % len(inputs)
+				out, err := net.Predict(inputs[i])
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				if !mat.Equal(out, expected[i]) {
+					t.Errorf("Prediction for input #%d should be %v, but got %v", i, expected[i].RawMatrix().Data, out.RawMatrix().Data)
+					return
+				}
+				// Caller owns output
+				out.Zero()
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if !mat.Equal(net.GetOutput(), lastOutput) {
+		t.Errorf("Predict() should not modify layers of net")
+	}
+
+	// Changed weights should be used by next prediction
+	fc := net.Layers[5]
+	fc.SetCustomWeights([]*mat.Dense{mat.NewDense(4, 32, nil)})
+	out, err := net.Predict(inputs[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, v := range out.RawMatrix().Data {
+		if v != 0.25 {
+			t.Errorf("Prediction for zero weights should be uniform, but got %v", out.RawMatrix().Data)
+			break
+		}
+	}
+
+	// Layers of net have been changed
+	net.Layers = net.Layers[:6]
+	out, err = net.Predict(inputs[0])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(out, mat.NewDense(4, 1, nil)) {
+		t.Errorf("Prediction without softmax layer should be zero, but got %v", out.RawMatrix().Data)
+	}
+}
+
+func TestPredictBatch(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	net, err := NewSequential(&tensor.TDsize{X: 9, Y: 9, Z: 1}).
+		Conv(3, 2, 2, WithBias(), WithRand(r)).
+		ReLU().
+		Conv(2, 3, 1, WithRand(r), WithPaddingSize(1), WithPaddingMode("reflect")).
+		BatchNorm("channel").
+		Dense(5, WithBias(), WithRand(r)).
+		Dense(3, WithRand(r)).
+		Activation("sigmoid").
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	net.Layers[0].SetCustomWeights(append(net.Layers[0].GetWeights()[:2], mat.NewDense(2, 1, []float64{0.1, -0.2})))
+	inputs := make([]*mat.Dense, 11)
+	for i := range inputs {
+		inputs[i] = mat.NewDense(9, 9, nil)
+		for j := range inputs[i].RawMatrix().Data {
+			inputs[i].RawMatrix().Data[j] = r.NormFloat64()
+		}
+	}
+	for _, workersNum := range []int{1, 3, 20} {
+		outputs, err := net.PredictBatchParallel(inputs, workersNum)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(outputs) != len(inputs) {
+			t.Errorf("Number of outputs should be %d, but got %d", len(inputs), len(outputs))
+			return
+		}
+		for i := range inputs {
+			expected, err := net.Predict(inputs[i])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !mat.EqualApprox(outputs[i], expected, 1e-12) {
+				t.Errorf("Batch prediction (%d workers) for input #%d should be %v, but got %v", workersNum, i, expected.RawMatrix().Data, outputs[i].RawMatrix().Data)
+			}
+		}
+	}
+	// 10x9 input gives the same number of patches for kernel 3 and stride 2, but it is not 9x9 still
+	for _, wrong := range []*mat.Dense{mat.NewDense(3, 3, nil), mat.NewDense(10, 9, nil), mat.NewDense(9, 10, nil)} {
+		for _, batch := range [][]*mat.Dense{{inputs[0], wrong}, {wrong, inputs[0]}} {
+			_, err = net.PredictBatch(batch)
+			if errors.Cause(err) != ErrDimensionsAreNotEqual {
+				r, c := wrong.Dims()
+				t.Errorf("Batch prediction should fail with ErrDimensionsAreNotEqual for input of size %dx%d, but got %v", r, c, err)
+			}
+		}
+	}
+}
+
+func TestPredictorsPool(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 3, Y: 1, Z: 1}).Seed(3).Dense(2).Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Concurrent first calls share the same pool
+	pools := make([]*sync.Pool, 8)
+	wg := sync.WaitGroup{}
+	for i := range pools {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pools[i] = net.getPredictorsPool()
+		}(i)
+	}
+	wg.Wait()
+	for i := range pools {
+		if pools[i] != pools[0] {
+			t.Errorf("Pool #%d should be the same as first one", i)
+		}
+	}
+
+	// Failed prediction does not break next ones
+	_, err = net.Predict(mat.NewDense(2, 1, nil))
+	if err == nil {
+		t.Errorf("Input of wrong size should cause error")
+	}
+	_, err = net.PredictBatch([]*mat.Dense{mat.NewDense(2, 1, nil)})
+	if err == nil {
+		t.Errorf("Input of wrong size should cause error")
+	}
+	input := mat.NewDense(3, 1, []float64{0.1, -0.2, 0.3})
+	output, err := net.Predict(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = net.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !mat.Equal(output, net.GetOutput()) {
+		t.Errorf("Output of Predict() should be equal to output of FeedForward()")
+	}
+}
@@ -0,0 +1,223 @@
+package cnns
+
+import (
+	"fmt"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+// PReLULayer Parametric Rectified Linear Unit layer (activation: x for x >= 0 and a{c}*x for x < 0, where a{c} is trainable slope of c-th channel)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+	Slopes - a{c}, trainable slope for negative input of each channel
+	SlopesState - optimizer's state for slopes
+	SlopesGradients - ΔE/Δa{c}, gradients accumulated over mini-batch (they are applied in UpdateWeights())
+*/
+type PReLULayer struct {
+	Oj              *mat.Dense
+	Ok              *mat.Dense
+	LocalDelta      *mat.Dense
+	Slopes          *mat.Dense
+	SlopesState     *OptimizerState
+	SlopesGradients *mat.Dense
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	accumulatedSamples int
+	trainMode          bool
+}
+
+// NewPReLULayer - Constructor for new PReLU layer. You need to specify input size. Slopes are initialized with 0.25
+/*
+	inSize - input layer's size
+*/
+func NewPReLULayer(inSize *tensor.TDsize) Layer {
+	newLayer := &PReLULayer{
+		inputSize:       inSize,
+		Oj:              mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:              mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta:      mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Slopes:          mat.NewDense(inSize.Z, 1, nil),
+		SlopesState:     NewOptimizerState(inSize.Z, 1),
+		SlopesGradients: mat.NewDense(inSize.Z, 1, nil),
+		OutputSize:      &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:       false,
+	}
+	for c := 0; c < inSize.Z; c++ {
+		newLayer.Slopes.Set(c, 0, 0.25)
+	}
+	return newLayer
+}
+
+// channel Returns index of channel for i-th element of raw data (every channel is X*Y contiguous values)
+func (prelu *PReLULayer) channel(i int) int {
+	return i / (prelu.inputSize.X * prelu.inputSize.Y)
+}
+
+// SetCustomWeights Set user's slopes for PReLU layer (make it carefully)
+/*
+	t - slice of length 1 with slopes (one per channel)
+*/
+func (prelu *PReLULayer) SetCustomWeights(t []*mat.Dense) {
+	if len(t) != 1 {
+		fmt.Println("You can provide array of length 1 only (for PReLU layer)")
+		return
+	}
+	r, c := t[0].Dims()
+	if r*c != prelu.inputSize.Z {
+		fmt.Printf("Number of slopes should be %d (for PReLU layer)\n", prelu.inputSize.Z)
+		return
+	}
+	prelu.Slopes = mat.NewDense(prelu.inputSize.Z, 1, nil)
+	prelu.Slopes.Copy(t[0])
+	prelu.SlopesState = NewOptimizerState(prelu.inputSize.Z, 1)
+	prelu.SlopesGradients.Zero()
+	prelu.accumulatedSamples = 0
+}
+
+// GetInputSize Returns dimensions of incoming data for PReLU layer
+func (prelu *PReLULayer) GetInputSize() *tensor.TDsize {
+	return prelu.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of PReLU layer
+func (prelu *PReLULayer) GetOutputSize() *tensor.TDsize {
+	return prelu.OutputSize
+}
+
+// GetActivatedOutput Returns PReLU layer's output
+func (prelu *PReLULayer) GetActivatedOutput() *mat.Dense {
+	return prelu.Ok
+}
+
+// GetWeights Returns PReLU layer's slopes
+func (prelu *PReLULayer) GetWeights() []*mat.Dense {
+	return []*mat.Dense{prelu.Slopes}
+}
+
+// GetGradients Returns PReLU layer's gradients
+func (prelu *PReLULayer) GetGradients() *mat.Dense {
+	return prelu.LocalDelta
+}
+
+// FeedForward - Feed data to PReLU layer
+func (prelu *PReLULayer) FeedForward(t *mat.Dense) error {
+	prelu.Oj = t
+	prelu.doActivation()
+	return nil
+}
+
+// doActivation PReLU layer's output activation
+func (prelu *PReLULayer) doActivation() {
+	rawOj := prelu.Oj.RawMatrix().Data
+	rawOk := prelu.Ok.RawMatrix().Data
+	for j := range rawOj {
+		if rawOj[j] < 0 {
+			rawOk[j] = prelu.Slopes.At(prelu.channel(j), 0) * rawOj[j]
+		} else {
+			rawOk[j] = rawOj[j]
+		}
+	}
+}
+
+// CalculateGradients Evaluate PReLU layer's gradients
+func (prelu *PReLULayer) CalculateGradients(errorsDense *mat.Dense) error {
+	raw := prelu.Oj.RawMatrix().Data
+	rawDelta := prelu.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	for i := range raw {
+		if raw[i] < 0 {
+			c := prelu.channel(i)
+			rawDelta[i] = prelu.Slopes.At(c, 0) * rawErrors[i]
+			// ΔO/Δa{c} = x for negative input
+			prelu.SlopesGradients.Set(c, 0, prelu.SlopesGradients.At(c, 0)+rawErrors[i]*raw[i])
+		} else {
+			rawDelta[i] = rawErrors[i]
+		}
+	}
+	prelu.accumulatedSamples++
+	return nil
+}
+
+// UpdateWeights Update PReLU layer's slopes (gradients are averaged over accumulated samples)
+func (prelu *PReLULayer) UpdateWeights(lp *LearningParams) {
+	if prelu.accumulatedSamples == 0 {
+		return
+	}
+	prelu.SlopesGradients.Scale(1.0/float64(prelu.accumulatedSamples), prelu.SlopesGradients)
+	// Slopes are not regularized (the same way as biases), otherwise they are pushed to zero (to ReLU)
+	lp.updateParameters(prelu.Slopes, prelu.SlopesGradients, prelu.SlopesState, true)
+	prelu.SlopesGradients.Zero()
+	prelu.accumulatedSamples = 0
+}
+
+// PrintOutput Pretty print PReLU layer's output
+func (prelu *PReLULayer) PrintOutput() {
+	fmt.Println("Printing PReLU Layer output...")
+}
+
+// PrintWeights Pretty print PReLU layer's slopes
+func (prelu *PReLULayer) PrintWeights() {
+	fmt.Println("Printing PReLU Layer slopes...")
+	fmt.Printf("\t%v\n", prelu.Slopes.RawMatrix().Data)
+}
+
+// SetActivationFunc Set activation function for layer
+func (prelu *PReLULayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for PReLU layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (prelu *PReLULayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for PReLU layer")
+}
+
+// GetStride Returns stride of layer
+func (prelu *PReLULayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "prelu" as layer's type
+func (prelu *PReLULayer) GetType() string {
+	return "prelu"
+}
+
+// SetTrainMode Switch PReLU layer to training (true) or inference (false) mode
+func (prelu *PReLULayer) SetTrainMode(mode bool) {
+	prelu.trainMode = mode
+}
+
+// replicate Returns new PReLU layer with own buffers (see Predict() and CalculateBatchGradients()). Slopes are shared by shareParameters()
+func (prelu *PReLULayer) replicate() Layer {
+	return NewPReLULayer(prelu.inputSize)
+}
+
+// mergeGradients Adds gradients accumulated by replica to layer's gradients and resets replica's ones
+func (prelu *PReLULayer) mergeGradients(replica Layer) {
+	replicaPReLU := replica.(*PReLULayer)
+	prelu.SlopesGradients.Add(prelu.SlopesGradients, replicaPReLU.SlopesGradients)
+	replicaPReLU.SlopesGradients.Zero()
+	prelu.accumulatedSamples += replicaPReLU.accumulatedSamples
+	replicaPReLU.accumulatedSamples = 0
+}
+
+// shareParameters Makes replica use the same slopes as layer (see Predict() and CalculateBatchGradients())
+func (prelu *PReLULayer) shareParameters(replica Layer) {
+	replica.(*PReLULayer).Slopes = prelu.Slopes
+}
+
+// trainableParameters Returns slopes of PReLU layer
+func (prelu *PReLULayer) trainableParameters() []*mat.Dense {
+	return []*mat.Dense{prelu.Slopes}
+}
+
+// optimizerStates Returns optimizer's states for slopes of PReLU layer
+func (prelu *PReLULayer) optimizerStates() []*OptimizerState {
+	return []*OptimizerState{prelu.SlopesState}
+}
@@ -0,0 +1,114 @@
+package cnns
+
+import (
+	"math/rand"
+)
+
+// countingSource Source of randomness which counts number of draws, so its state can be described by seed and number of draws
+/*
+	It is SplitMix64 generator: n-th value is evaluated from seed and n directly, so source is restored in constant time (see restoreCountingSource())
+*/
+type countingSource struct {
+	seed  int64
+	draws uint64
+}
+
+// splitMixGamma Increment of SplitMix64 state (odd constant from golden ratio)
+const splitMixGamma = 0x9E3779B97F4A7C15
+
+// newCountingSource Constructor for counting source
+/*
+	seed - seed of source
+*/
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{
+		seed:  seed,
+		draws: 0,
+	}
+}
+
+// restoreCountingSource Returns counting source in state after provided number of draws
+/*
+	seed - seed of source
+	draws - number of draws which have been done already
+*/
+func restoreCountingSource(seed int64, draws uint64) *countingSource {
+	src := newCountingSource(seed)
+	src.draws = draws
+	return src
+}
+
+// Int63 See rand.Source
+func (src *countingSource) Int63() int64 {
+	return int64(src.Uint64() >> 1)
+}
+
+// Uint64 See rand.Source64
+func (src *countingSource) Uint64() uint64 {
+	src.draws++
+	z := uint64(src.seed) + src.draws*splitMixGamma
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// Seed See rand.Source
+func (src *countingSource) Seed(seed int64) {
+	src.seed = seed
+	src.draws = 0
+}
+
+// randomizedLayer Layer which uses source of randomness during training (e.g. dropout layer)
+type randomizedLayer interface {
+	// setRand Set source of randomness
+	setRand(r *rand.Rand)
+}
+
+// SetSeed Set seed for net's source of randomness. It is used for shuffling of training data and by layers which use randomness during training (e.g. dropout layer)
+/*
+	seed - seed itself. The same seed (and the same initial weights) gives bit-identical training
+
+	Should be called after layers have been added to net.
+	Note: weights are initialized in layers' constructors, so use Sequential.Seed() (or WithRand() option of constructors) for reproducible initial weights
+*/
+func (wh *WholeNet) SetSeed(seed int64) {
+	wh.randSource = newCountingSource(seed)
+	wh.setRand(rand.New(wh.randSource))
+}
+
+// SetRand Set net's source of randomness (see SetSeed())
+func (wh *WholeNet) SetRand(r *rand.Rand) {
+	wh.randSource = nil
+	wh.setRand(r)
+}
+
+// GetRand Returns net's source of randomness (nil means global source from math/rand)
+func (wh *WholeNet) GetRand() *rand.Rand {
+	return wh.rand
+}
+
+// setRand Set net's source of randomness and hand it to layers which need it
+func (wh *WholeNet) setRand(r *rand.Rand) {
+	wh.rand = r
+	for i := range wh.Layers {
+		if layer, ok := wh.Layers[i].(randomizedLayer); ok {
+			layer.setRand(r)
+		}
+	}
+}
+
+// int63 Returns non-negative pseudo-random 63-bit integer from net's source of randomness (or from global one)
+func (wh *WholeNet) int63() int64 {
+	if wh.rand != nil {
+		return wh.rand.Int63()
+	}
+	return rand.Int63()
+}
+
+// intn Returns pseudo-random number in [0,n) from net's source of randomness (or from global one)
+func (wh *WholeNet) intn(n int) int {
+	if wh.rand != nil {
+		return wh.rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
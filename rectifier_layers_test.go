@@ -0,0 +1,97 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestRectifierLayersGradients(t *testing.T) {
+	inSize := &tensor.TDsize{X: 3, Y: 2, Z: 2}
+	layers := []Layer{
+		NewLeakyReLULayer(inSize, 0.01),
+		NewPReLULayer(inSize),
+		NewELULayer(inSize, 1.0),
+		NewSELULayer(inSize),
+		NewGELULayer(inSize),
+	}
+	input := mat.NewDense(6, 2, []float64{
+		-2, -0.5,
+		0.3, 1.5,
+		-0.1, 2,
+		0.7, -1.2,
+		-3, 0.05,
+		1, -0.8,
+	})
+	// Loss is Σ(w * O), so ΔE/ΔO = w
+	outputWeights := mat.NewDense(6, 2, []float64{
+		0.5, -1,
+		2, 0.1,
+		-0.3, 0.7,
+		1, 1,
+		-2, 0.4,
+		0.6, -0.9,
+	})
+	for _, layer := range layers {
+		loss := func() float64 {
+			err := layer.FeedForward(input)
+			if err != nil {
+				t.Error(err)
+			}
+			product := &mat.Dense{}
+			product.MulElem(layer.GetActivatedOutput(), outputWeights)
+			return mat.Sum(product)
+		}
+		loss()
+		err := layer.CalculateGradients(outputWeights)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		gradients := layer.GetGradients().RawMatrix().Data
+		eps := 1e-6
+		for i := range input.RawMatrix().Data {
+			initial := input.RawMatrix().Data[i]
+			input.RawMatrix().Data[i] = initial + eps
+			plus := loss()
+			input.RawMatrix().Data[i] = initial - eps
+			minus := loss()
+			input.RawMatrix().Data[i] = initial
+			numerical := (plus - minus) / (2 * eps)
+			if math.Abs(numerical-gradients[i]) > 1e-6 {
+				t.Errorf("Gradient of '%s' layer in position %d should be %f, but got %f", layer.GetType(), i, numerical, gradients[i])
+			}
+		}
+	}
+}
+
+func TestPReLUSlopesGradients(t *testing.T) {
+	prelu := NewPReLULayer(&tensor.TDsize{X: 2, Y: 1, Z: 2})
+	prelu.SetCustomWeights([]*mat.Dense{mat.NewDense(2, 1, []float64{0.1, 0.2})})
+	input := mat.NewDense(4, 1, []float64{-1, 2, -3, -4})
+	err := prelu.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{-0.1, 2, -0.6, -0.8}
+	for i, v := range prelu.GetActivatedOutput().RawMatrix().Data {
+		if math.Abs(v-correct[i]) > 1e-12 {
+			t.Errorf("Output in position %d should be %f, but got %f", i, correct[i], v)
+		}
+	}
+	err = prelu.CalculateGradients(mat.NewDense(4, 1, []float64{1, 1, 1, 1}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// ΔE/Δa{c} = Σ(ΔE/ΔO * x) over negative inputs of channel
+	correctSlopes := []float64{-1, -7}
+	for c, v := range prelu.(*PReLULayer).SlopesGradients.RawMatrix().Data {
+		if math.Abs(v-correctSlopes[c]) > 1e-12 {
+			t.Errorf("Gradient of slope for channel %d should be %f, but got %f", c, correctSlopes[c], v)
+		}
+	}
+}
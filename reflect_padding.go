@@ -0,0 +1,57 @@
+package cnns
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+// ReflectPadding Apply reflect padding to source matrix (values are mirrored around edge without repeating edge itself)
+/*
+	matrix - source matrix
+	num - number of columns to add and fill with reflected values (should be less than number of rows and columns of source matrix)
+*/
+func ReflectPadding(matrix *mat.Dense, num int) *mat.Dense {
+	r, c := matrix.Dims()
+	outRows := r + num*2
+	outCols := c + num*2
+	flattenMatrix := make([]float64, outRows*outCols)
+	for y := 0; y < outRows; y++ {
+		reflectPadding(matrix, flattenMatrix, r, c, outCols, num, y)
+	}
+	return mat.NewDense(outRows, outCols, flattenMatrix)
+}
+
+// reflectPadding See ReflectPadding()
+func reflectPadding(matrix *mat.Dense, newFlattenMatrix []float64, rows, cols, outCols int, w, y int) {
+	sourceY := paddingSourceIndex(y, rows, w, paddingREFLECT)
+	for x := 0; x < outCols; x++ {
+		newFlattenMatrix[y*outCols+x] = matrix.At(sourceY, paddingSourceIndex(x, cols, w, paddingREFLECT))
+	}
+}
+
+// paddingSourceIndex Returns index in source matrix for index in padded matrix (-1 if there is no source, e.g. for zero padding)
+/*
+	i - index in padded matrix (row or column)
+	size - number of rows (or columns) in source matrix
+	num - number of added rows (or columns) on each side
+	mode - type of padding
+*/
+func paddingSourceIndex(i, size, num int, mode paddingMode) int {
+	k := i - num
+	if k >= 0 && k < size {
+		return k
+	}
+	switch mode {
+	case paddingEDGE:
+		if k < 0 {
+			return 0
+		}
+		return size - 1
+	case paddingREFLECT:
+		if k < 0 {
+			return -k
+		}
+		return 2*(size-1) - k
+	default:
+		return -1
+	}
+}
@@ -142,3 +142,13 @@ func (relu *ReLULayer) GetStride() int {
 func (relu *ReLULayer) GetType() string {
 	return "relu"
 }
+
+// SetTrainMode Switch ReLU layer to training (true) or inference (false) mode
+func (relu *ReLULayer) SetTrainMode(mode bool) {
+	relu.trainMode = mode
+}
+
+// replicate Returns new ReLU layer with the same configuration (see TrainParallel())
+func (relu *ReLULayer) replicate() Layer {
+	return NewReLULayer(relu.inputSize)
+}
@@ -0,0 +1,163 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Self-normalizing constants for SELU. See ref. https://arxiv.org/abs/1706.02515
+const (
+	seluAlpha  = 1.6732632423543772848170429916717
+	seluLambda = 1.0507009873554804934193349852946
+)
+
+// SELULayer Scaled Exponential Linear Unit layer (activation: λ*x for x >= 0 and λ*α*(exp(x)-1) for x < 0)
+/*
+	Oj - Input data
+	Ok - Output data
+	LocalDelta - Incoming gradients*weights (backpropagation)
+*/
+type SELULayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	trainMode bool
+}
+
+// NewSELULayer - Constructor for new SELU layer. You need to specify input size
+/*
+	inSize - input layer's size
+*/
+func NewSELULayer(inSize *tensor.TDsize) Layer {
+	newLayer := &SELULayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for SELU layer (make it carefully)
+func (selu *SELULayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for SELU layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for SELU layer
+func (selu *SELULayer) GetInputSize() *tensor.TDsize {
+	return selu.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of SELU layer
+func (selu *SELULayer) GetOutputSize() *tensor.TDsize {
+	return selu.OutputSize
+}
+
+// GetActivatedOutput Returns SELU layer's output
+func (selu *SELULayer) GetActivatedOutput() *mat.Dense {
+	return selu.Ok
+}
+
+// GetWeights Returns SELU layer's weights
+func (selu *SELULayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for SELU layer")
+	return nil
+}
+
+// GetGradients Returns SELU layer's gradients
+func (selu *SELULayer) GetGradients() *mat.Dense {
+	return selu.LocalDelta
+}
+
+// FeedForward - Feed data to SELU layer
+func (selu *SELULayer) FeedForward(t *mat.Dense) error {
+	selu.Oj = t
+	selu.doActivation()
+	return nil
+}
+
+// doActivation SELU layer's output activation
+func (selu *SELULayer) doActivation() {
+	rawOj := selu.Oj.RawMatrix().Data
+	rawOk := selu.Ok.RawMatrix().Data
+	for j := range rawOj {
+		if rawOj[j] < 0 {
+			rawOk[j] = seluLambda * seluAlpha * (math.Exp(rawOj[j]) - 1)
+		} else {
+			rawOk[j] = seluLambda * rawOj[j]
+		}
+	}
+}
+
+// CalculateGradients Evaluate SELU layer's gradients
+func (selu *SELULayer) CalculateGradients(errorsDense *mat.Dense) error {
+	raw := selu.Oj.RawMatrix().Data
+	rawOk := selu.Ok.RawMatrix().Data
+	rawDelta := selu.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	for i := range raw {
+		if raw[i] < 0 {
+			// Derivative is λ*α*exp(x) = O + λ*α
+			rawDelta[i] = rawErrors[i] * (rawOk[i] + seluLambda*seluAlpha)
+		} else {
+			rawDelta[i] = rawErrors[i] * seluLambda
+		}
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that SELU layer does NOT updating weights
+func (selu *SELULayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for SELU layer
+}
+
+// PrintOutput Pretty print SELU layer's output
+func (selu *SELULayer) PrintOutput() {
+	fmt.Println("Printing SELU Layer output...")
+}
+
+// PrintWeights Just to point, that SELU layer has not weights
+func (selu *SELULayer) PrintWeights() {
+	fmt.Println("There are no weights for SELU layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (selu *SELULayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for SELU layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (selu *SELULayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for SELU layer")
+}
+
+// GetStride Returns stride of layer
+func (selu *SELULayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "selu" as layer's type
+func (selu *SELULayer) GetType() string {
+	return "selu"
+}
+
+// SetTrainMode Switch SELU layer to training (true) or inference (false) mode
+func (selu *SELULayer) SetTrainMode(mode bool) {
+	selu.trainMode = mode
+}
+
+// replicate Returns new SELU layer with the same configuration (see TrainParallel())
+func (selu *SELULayer) replicate() Layer {
+	return NewSELULayer(selu.inputSize)
+}
@@ -0,0 +1,384 @@
+package cnns
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+)
+
+// Sequential Builder for neural net where every layer is stacked on top of previous one.
+// Input size of every layer is inferred from output size of previous layer, parameters are validated before layer creation.
+/*
+	Usage:
+		net, err := cnns.NewSequential(&tensor.TDsize{X: 28, Y: 28, Z: 1}).
+			Conv(3, 8, 1).
+			ReLU().
+			MaxPool(2, 2).
+			Dense(10).
+			Softmax().
+			Build()
+	First error stops building: every next call is ignored and error is returned by Build()
+	Call Seed() first for reproducible initial weights and training
+*/
+type Sequential struct {
+	inputSize  *tensor.TDsize
+	layers     []Layer
+	err        error
+	rand       *rand.Rand
+	randSource *countingSource
+}
+
+// NewSequential Constructor for sequential net builder
+/*
+	inputSize - dimensions of net's input
+*/
+func NewSequential(inputSize *tensor.TDsize) *Sequential {
+	seq := &Sequential{
+		inputSize: inputSize,
+		layers:    []Layer{},
+	}
+	if inputSize == nil || inputSize.X <= 0 || inputSize.Y <= 0 || inputSize.Z <= 0 {
+		seq.err = errors.Wrap(ErrInvalidLayerConfiguration, "Input size should have positive dimensions")
+	}
+	return seq
+}
+
+// Seed Set seed for source of randomness of net: it is used for initialization of weights of layers added after this call and then by net itself (see WholeNet.SetSeed())
+/*
+	seed - seed itself. The same seed gives the same initial weights and bit-identical training
+
+	Layers with explicit WithRand() option use provided source for initialization of weights
+*/
+func (seq *Sequential) Seed(seed int64) *Sequential {
+	seq.randSource = newCountingSource(seed)
+	seq.rand = rand.New(seq.randSource)
+	return seq
+}
+
+// layerOptions Returns options for layer constructor: builder's source of randomness (see Seed()) goes first, so it can be overridden by WithRand()
+func (seq *Sequential) layerOptions(options []LayerOption) []LayerOption {
+	if seq.rand == nil {
+		return options
+	}
+	return append([]LayerOption{WithRand(seq.rand)}, options...)
+}
+
+// currentSize Returns output size of last added layer (or input size of the net if there are no layers yet)
+func (seq *Sequential) currentSize() *tensor.TDsize {
+	if len(seq.layers) == 0 {
+		return seq.inputSize
+	}
+	return seq.layers[len(seq.layers)-1].GetOutputSize()
+}
+
+// fail Stores error for layer which is going to be added next
+func (seq *Sequential) fail(layerType string, format string, args ...interface{}) {
+	inSize := seq.currentSize()
+	seq.err = errors.Wrapf(ErrInvalidLayerConfiguration, "Layer #%d (%s) with input size %dx%dx%d: "+format, append([]interface{}{len(seq.layers), layerType, inSize.X, inSize.Y, inSize.Z}, args...)...)
+}
+
+// add Appends layer made by constructor if there were no errors before
+func (seq *Sequential) add(constructor func(inSize *tensor.TDsize) Layer) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	seq.layers = append(seq.layers, constructor(seq.currentSize()))
+	return seq
+}
+
+// Conv Adds convolutional layer
+/*
+	kernelSize - width==height of kernel
+	numberFilters - number of kernels
+	stride - step on convolve operation
+	options - optional parameters (see NewConvLayer())
+*/
+func (seq *Sequential) Conv(kernelSize, numberFilters, stride int, options ...LayerOption) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	if kernelSize <= 0 || numberFilters <= 0 || stride <= 0 {
+		seq.fail("conv", "kernel size (%d), number of filters (%d) and stride (%d) should be positive", kernelSize, numberFilters, stride)
+		return seq
+	}
+	opts := newLayerOptions(options...)
+	if opts.unknownPadding != "" {
+		seq.fail("conv", "padding '%s' is not supported. Use 'valid' or 'same'", opts.unknownPadding)
+		return seq
+	}
+	padding := opts.padding
+	if opts.samePadding {
+		if kernelSize%2 == 0 {
+			seq.fail("conv", "padding 'same' is not supported for even kernel size %d", kernelSize)
+			return seq
+		}
+		padding = (kernelSize - 1) / 2
+	}
+	inSize := seq.currentSize()
+	if strings.ToLower(opts.paddingMode) == "reflect" && (padding >= inSize.X || padding >= inSize.Y) {
+		seq.fail("conv", "reflect padding %d should be less than input size %dx%d", padding, inSize.X, inSize.Y)
+		return seq
+	}
+	paddedX, paddedY := inSize.X+2*padding, inSize.Y+2*padding
+	if kernelSize > paddedX || kernelSize > paddedY {
+		seq.fail("conv", "kernel size %d is greater than padded input %dx%d", kernelSize, paddedX, paddedY)
+		return seq
+	}
+	if (paddedX-kernelSize)%stride != 0 || (paddedY-kernelSize)%stride != 0 {
+		seq.fail("conv", "stride %d does not divide padded input %dx%d minus kernel size %d", stride, paddedX, paddedY, kernelSize)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewConvLayer(inSize, stride, kernelSize, numberFilters, seq.layerOptions(options)...)
+	})
+}
+
+// Pool Adds pooling layer
+/*
+	windowSize - width==height of pooling window
+	stride - step of pooling window
+	poolingType - "max", "min" or "avg"
+	zeroPad - "valid" (window and stride should fit input exactly) or "same" (input is zero-padded if needed)
+*/
+func (seq *Sequential) Pool(windowSize, stride int, poolingType string, zeroPad string) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	switch strings.ToLower(poolingType) {
+	case "max", "min", "avg":
+		break
+	default:
+		seq.fail("pool", "pooling type '%s' is not supported. Use 'max', 'min' or 'avg'", poolingType)
+		return seq
+	}
+	if windowSize <= 0 || stride <= 0 {
+		seq.fail("pool", "window size (%d) and stride (%d) should be positive", windowSize, stride)
+		return seq
+	}
+	inSize := seq.currentSize()
+	if windowSize > inSize.X || windowSize > inSize.Y {
+		seq.fail("pool", "window size %d is greater than input %dx%d", windowSize, inSize.X, inSize.Y)
+		return seq
+	}
+	switch strings.ToLower(zeroPad) {
+	case "same":
+		break
+	case "valid":
+		if (inSize.X-windowSize)%stride != 0 || (inSize.Y-windowSize)%stride != 0 {
+			seq.fail("pool", "stride %d does not divide input %dx%d minus window size %d (use 'same' zero padding)", stride, inSize.X, inSize.Y, windowSize)
+			return seq
+		}
+		break
+	default:
+		seq.fail("pool", "zero padding '%s' is not supported. Use 'valid' or 'same'", zeroPad)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewPoolingLayer(inSize, stride, windowSize, poolingType, zeroPad)
+	})
+}
+
+// MaxPool Adds max pooling layer without zero padding. See Pool()
+func (seq *Sequential) MaxPool(windowSize, stride int) *Sequential {
+	return seq.Pool(windowSize, stride, "max", "valid")
+}
+
+// MinPool Adds min pooling layer without zero padding. See Pool()
+func (seq *Sequential) MinPool(windowSize, stride int) *Sequential {
+	return seq.Pool(windowSize, stride, "min", "valid")
+}
+
+// AvgPool Adds average pooling layer without zero padding. See Pool()
+func (seq *Sequential) AvgPool(windowSize, stride int) *Sequential {
+	return seq.Pool(windowSize, stride, "avg", "valid")
+}
+
+// GlobalPool Adds global pooling layer
+/*
+	poolingType - "max", "min" or "avg"
+*/
+func (seq *Sequential) GlobalPool(poolingType string) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	switch strings.ToLower(poolingType) {
+	case "max", "min", "avg":
+		break
+	default:
+		seq.fail("global_pool", "pooling type '%s' is not supported. Use 'max', 'min' or 'avg'", poolingType)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewGlobalPoolingLayer(inSize, poolingType)
+	})
+}
+
+// Dense Adds fully connected layer
+/*
+	outSize - number of neurons
+	options - optional parameters (see NewFullyConnectedLayer())
+*/
+func (seq *Sequential) Dense(outSize int, options ...LayerOption) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	if outSize <= 0 {
+		seq.fail("fc", "number of neurons (%d) should be positive", outSize)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewFullyConnectedLayer(inSize, outSize, seq.layerOptions(options)...)
+	})
+}
+
+// Activation Sets activation function (by name, see RegisterActivation()) for last added layer. Only fully connected layers (and user's layers with SetActivation(name string) error method) support it
+func (seq *Sequential) Activation(name string) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	if len(seq.layers) == 0 {
+		seq.err = errors.Wrapf(ErrInvalidLayerConfiguration, "Activation '%s' can be set for fully connected layer only", name)
+		return seq
+	}
+	last := len(seq.layers) - 1
+	layer, ok := seq.layers[last].(activationLayer)
+	if !ok {
+		seq.err = errors.Wrapf(ErrInvalidLayerConfiguration, "Activation '%s' can be set for fully connected layer only", name)
+		return seq
+	}
+	err := layer.SetActivation(name)
+	if err != nil {
+		seq.err = errors.Wrapf(err, "Layer #%d (%s)", last, seq.layers[last].GetType())
+	}
+	return seq
+}
+
+// Dropout Adds dropout layer
+/*
+	rate - probability of dropping neuron, should be in [0; 1)
+	options - optional parameters (see NewDropoutLayer())
+*/
+func (seq *Sequential) Dropout(rate float64, options ...LayerOption) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	if rate < 0 || rate >= 1 {
+		seq.fail("dropout", "rate %f should be in [0; 1)", rate)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewDropoutLayer(inSize, rate, seq.layerOptions(options)...)
+	})
+}
+
+// BatchNorm Adds batch normalization layer
+/*
+	normType - "channel" or "feature" (see NewBatchNormLayer())
+*/
+func (seq *Sequential) BatchNorm(normType string) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	switch strings.ToLower(normType) {
+	case "channel", "feature":
+		break
+	default:
+		seq.fail("batchnorm", "normalization type '%s' is not supported. Use 'channel' or 'feature'", normType)
+		return seq
+	}
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewBatchNormLayer(inSize, normType)
+	})
+}
+
+// ReLU Adds ReLU layer
+func (seq *Sequential) ReLU() *Sequential {
+	return seq.add(NewReLULayer)
+}
+
+// LeakyReLU Adds leaky ReLU layer
+/*
+	alpha - slope for negative input
+*/
+func (seq *Sequential) LeakyReLU(alpha float64) *Sequential {
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewLeakyReLULayer(inSize, alpha)
+	})
+}
+
+// PReLU Adds PReLU layer
+func (seq *Sequential) PReLU() *Sequential {
+	return seq.add(NewPReLULayer)
+}
+
+// ELU Adds ELU layer
+/*
+	alpha - saturation value for negative input
+*/
+func (seq *Sequential) ELU(alpha float64) *Sequential {
+	return seq.add(func(inSize *tensor.TDsize) Layer {
+		return NewELULayer(inSize, alpha)
+	})
+}
+
+// SELU Adds SELU layer
+func (seq *Sequential) SELU() *Sequential {
+	return seq.add(NewSELULayer)
+}
+
+// GELU Adds GELU layer
+func (seq *Sequential) GELU() *Sequential {
+	return seq.add(NewGELULayer)
+}
+
+// Softmax Adds softmax layer
+func (seq *Sequential) Softmax() *Sequential {
+	return seq.add(NewSoftmaxLayer)
+}
+
+// Add Adds custom layer. Input size of layer should be equal to output size of previous layer
+func (seq *Sequential) Add(layer Layer) *Sequential {
+	if seq.err != nil {
+		return seq
+	}
+	if layer == nil {
+		seq.fail("unknown", "layer is nil")
+		return seq
+	}
+	inSize := seq.currentSize()
+	layerInput := layer.GetInputSize()
+	if layerInput == nil {
+		seq.fail(layer.GetType(), "layer has no input size")
+		return seq
+	}
+	if layerInput.Total() != inSize.Total() {
+		seq.fail(layer.GetType(), "layer expects input size %dx%dx%d", layerInput.X, layerInput.Y, layerInput.Z)
+		return seq
+	}
+	seq.layers = append(seq.layers, layer)
+	return seq
+}
+
+// Build Returns neural net made of added layers with default learning parameters (or first error occurred while building)
+/*
+	If Seed() has been called, then net continues to use the same source of randomness (e.g. for shuffling of training data and dropout masks)
+*/
+func (seq *Sequential) Build() (*WholeNet, error) {
+	if seq.err != nil {
+		return nil, errors.Wrap(seq.err, "Can't build sequential net")
+	}
+	if len(seq.layers) == 0 {
+		return nil, errors.Wrap(ErrNoLayers, "Can't build sequential net")
+	}
+	net := &WholeNet{
+		Layers: seq.layers,
+		LP:     NewLearningParametersDefault(),
+	}
+	if seq.rand != nil {
+		net.randSource = seq.randSource
+		net.setRand(seq.rand)
+	}
+	return net, nil
+}
@@ -0,0 +1,132 @@
+package cnns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSequential(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 10, Y: 10, Z: 1}).
+		Conv(3, 8, 1).
+		ReLU().
+		MaxPool(2, 2).
+		Dense(10).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correctTypes := []string{"conv", "relu", "pool", "fc", "softmax"}
+	correctSizes := []tensor.TDsize{{X: 8, Y: 8, Z: 8}, {X: 8, Y: 8, Z: 8}, {X: 4, Y: 4, Z: 8}, {X: 10, Y: 1, Z: 1}, {X: 10, Y: 1, Z: 1}}
+	if len(net.Layers) != len(correctTypes) {
+		t.Errorf("Number of layers should be %d, but got %d", len(correctTypes), len(net.Layers))
+		return
+	}
+	for i := range net.Layers {
+		if net.Layers[i].GetType() != correctTypes[i] {
+			t.Errorf("Type of layer #%d should be '%s', but got '%s'", i, correctTypes[i], net.Layers[i].GetType())
+		}
+		if *net.Layers[i].GetOutputSize() != correctSizes[i] {
+			t.Errorf("Output size of layer #%d should be %v, but got %v", i, correctSizes[i], *net.Layers[i].GetOutputSize())
+		}
+		if i > 0 && net.Layers[i].GetInputSize().Total() != net.Layers[i-1].GetOutputSize().Total() {
+			t.Errorf("Input size of layer #%d does not match output of previous layer", i)
+		}
+	}
+	err = net.FeedForward(mat.NewDense(10, 10, nil))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSequentialValidation(t *testing.T) {
+	tests := []struct {
+		seq     *Sequential
+		message string
+	}{
+		{NewSequential(&tensor.TDsize{X: 9, Y: 8, Z: 1}).Conv(3, 1, 1).MaxPool(2, 2), "Layer #1 (pool) with input size 7x6x1"},
+		{NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 1}).Conv(3, 1, 2), "Layer #0 (conv) with input size 8x8x1"},
+		{NewSequential(&tensor.TDsize{X: 2, Y: 2, Z: 1}).ReLU().Conv(3, 1, 1), "Layer #1 (conv)"},
+		{NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}).Dense(0).ReLU(), "Layer #0 (fc)"},
+		{NewSequential(&tensor.TDsize{X: 1, Y: 3, Z: 1}).Conv(1, 1, 1, WithPaddingSize(1), WithPaddingMode("reflect")), "reflect padding 1 should be less than input size 1x3"},
+		{NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 1}).Conv(2, 1, 1, WithPadding("same")), "even kernel size 2"},
+		{NewSequential(&tensor.TDsize{X: 8, Y: 8, Z: 1}).Conv(3, 1, 1, WithPadding("full")), "padding 'full' is not supported"},
+		{NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}).Dropout(1.5), "Layer #0 (dropout)"},
+		{NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}).ReLU().Activation("tanh"), "fully connected layer only"},
+		{NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}).Add(NewReLULayer(&tensor.TDsize{X: 3, Y: 3, Z: 1})), "Layer #0 (relu)"},
+		{NewSequential(&tensor.TDsize{X: 4, Y: 4, Z: 1}), "No layers in network"},
+	}
+	for i, test := range tests {
+		net, err := test.seq.Build()
+		if err == nil {
+			t.Errorf("Test #%d: building should fail", i)
+			continue
+		}
+		if net != nil {
+			t.Errorf("Test #%d: net should be nil on error", i)
+		}
+		if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Test #%d: error should contain '%s', but got '%s'", i, test.message, err.Error())
+		}
+		if errors.Cause(err) != ErrInvalidLayerConfiguration && errors.Cause(err) != ErrNoLayers {
+			t.Errorf("Test #%d: unexpected cause of error: %s", i, err.Error())
+		}
+	}
+	// Padding "same" makes convolution fit input
+	_, err := NewSequential(&tensor.TDsize{X: 9, Y: 9, Z: 1}).Conv(3, 2, 2, WithPadding("same")).Dense(3).Activation("relu").Build()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSequentialSeed(t *testing.T) {
+	inputs := make([]*mat.Dense, 8)
+	targets := make([]*mat.Dense, 8)
+	for i := range inputs {
+		inputs[i] = mat.NewDense(5, 5, nil)
+		for j := range inputs[i].RawMatrix().Data {
+			inputs[i].RawMatrix().Data[j] = float64((i*7+j*3)%11)/11 - 0.5
+		}
+		targets[i] = mat.NewDense(2, 1, nil)
+		targets[i].Set(i%2, 0, 1)
+	}
+	train := func(seed int64) *WholeNet {
+		net, err := NewSequential(&tensor.TDsize{X: 5, Y: 5, Z: 1}).
+			Seed(seed).
+			Conv(3, 2, 1, WithBias()).
+			ReLU().
+			Dropout(0.3).
+			Dense(2, WithBias()).
+			Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		net.LP.SetBatchSize(4)
+		_, err = net.Fit(inputs, targets, &TrainOptions{Epochs: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return net
+	}
+	first := train(11)
+	second := train(11)
+	third := train(12)
+	for _, l := range []int{0, 3} {
+		firstWeights := first.Layers[l].GetWeights()
+		secondWeights := second.Layers[l].GetWeights()
+		thirdWeights := third.Layers[l].GetWeights()
+		for i := range firstWeights {
+			if !mat.Equal(firstWeights[i], secondWeights[i]) {
+				t.Errorf("Weights #%d of layer #%d should be the same for the same seed", i, l)
+			}
+		}
+		if mat.Equal(firstWeights[0], thirdWeights[0]) {
+			t.Errorf("Weights of layer #%d should differ for different seeds", l)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cnns
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/LdDl/cnns/tensor"
+	"github.com/pkg/errors"
+	"gonum.org/v1/gonum/mat"
+)
+
+// SoftmaxLayer Softmax layer (activation: exp(x{i}) / Σexp(x{j}))
+/*
+	Oj - Input data
+	Ok - Output data (probabilities)
+	LocalDelta - Incoming gradients*weights (backpropagation)
+*/
+type SoftmaxLayer struct {
+	Oj         *mat.Dense
+	Ok         *mat.Dense
+	LocalDelta *mat.Dense
+
+	OutputSize *tensor.TDsize
+	inputSize  *tensor.TDsize
+
+	trainMode bool
+}
+
+// NewSoftmaxLayer - Constructor for new softmax layer. You need to specify input size
+/*
+	inSize - input layer's size
+*/
+func NewSoftmaxLayer(inSize *tensor.TDsize) Layer {
+	newLayer := &SoftmaxLayer{
+		inputSize:  inSize,
+		Oj:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		Ok:         mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		LocalDelta: mat.NewDense(inSize.X*inSize.Z, inSize.Y, nil),
+		OutputSize: &tensor.TDsize{X: inSize.X, Y: inSize.Y, Z: inSize.Z},
+		trainMode:  false,
+	}
+	return newLayer
+}
+
+// SetCustomWeights Set user's weights for softmax layer (make it carefully)
+func (softmax *SoftmaxLayer) SetCustomWeights(t []*mat.Dense) {
+	fmt.Println("There are no weights for softmax layer")
+}
+
+// GetInputSize Returns dimensions of incoming data for softmax layer
+func (softmax *SoftmaxLayer) GetInputSize() *tensor.TDsize {
+	return softmax.inputSize
+}
+
+// GetOutputSize Returns output size (dimensions) of softmax layer
+func (softmax *SoftmaxLayer) GetOutputSize() *tensor.TDsize {
+	return softmax.OutputSize
+}
+
+// GetActivatedOutput Returns softmax layer's output
+func (softmax *SoftmaxLayer) GetActivatedOutput() *mat.Dense {
+	return softmax.Ok
+}
+
+// GetWeights Returns softmax layer's weights
+func (softmax *SoftmaxLayer) GetWeights() []*mat.Dense {
+	fmt.Println("There are no weights for softmax layer")
+	return nil
+}
+
+// GetGradients Returns softmax layer's gradients
+func (softmax *SoftmaxLayer) GetGradients() *mat.Dense {
+	return softmax.LocalDelta
+}
+
+// FeedForward - Feed data to softmax layer
+func (softmax *SoftmaxLayer) FeedForward(t *mat.Dense) error {
+	if t.RawMatrix().Rows*t.RawMatrix().Cols != softmax.inputSize.Total() {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call FeedForward() on softmax layer")
+	}
+	softmax.Oj = t
+	softmax.doActivation()
+	return nil
+}
+
+// doActivation Softmax layer's output activation
+/*
+	Numerically stable version: max value is subtracted from each input before exponentiation
+*/
+func (softmax *SoftmaxLayer) doActivation() {
+	rawOj := softmax.Oj.RawMatrix().Data
+	rawOk := softmax.Ok.RawMatrix().Data
+	max := math.Inf(-1)
+	for j := range rawOj {
+		if rawOj[j] > max {
+			max = rawOj[j]
+		}
+	}
+	sum := 0.0
+	for j := range rawOj {
+		rawOk[j] = math.Exp(rawOj[j] - max)
+		sum += rawOk[j]
+	}
+	for j := range rawOk {
+		rawOk[j] /= sum
+	}
+}
+
+// CalculateGradients Evaluate softmax layer's gradients
+/*
+	Jacobian of softmax is:
+		ΔO{i}/ΔΣ(j) = O{i} * (δ{i}{j} - O{j})
+	So gradient for previous layer is:
+		δ{j} = O{j} * (E{j} - Σ(E{i} * O{i}))
+*/
+func (softmax *SoftmaxLayer) CalculateGradients(errorsDense *mat.Dense) error {
+	rawOk := softmax.Ok.RawMatrix().Data
+	rawDelta := softmax.LocalDelta.RawMatrix().Data
+	rawErrors := errorsDense.RawMatrix().Data
+	if len(rawErrors) != len(rawOk) {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call CalculateGradients() on softmax layer")
+	}
+	dot := 0.0
+	for i := range rawOk {
+		dot += rawErrors[i] * rawOk[i]
+	}
+	for i := range rawOk {
+		rawDelta[i] = rawOk[i] * (rawErrors[i] - dot)
+	}
+	return nil
+}
+
+// calculateCrossEntropyGradients Evaluate softmax layer's gradients when it is paired with categorical cross-entropy loss
+/*
+	Jacobian of softmax multiplied by derivative of cross-entropy is simplified to:
+		δ{j} = O{j} - T{j}
+	Note: it is assumed that Σ(T{j}) = 1
+*/
+func (softmax *SoftmaxLayer) calculateCrossEntropyGradients(Tk *mat.Dense) error {
+	rawOk := softmax.Ok.RawMatrix().Data
+	rawDelta := softmax.LocalDelta.RawMatrix().Data
+	rawTk := Tk.RawMatrix().Data
+	if len(rawTk) != len(rawOk) {
+		return errors.Wrap(ErrDimensionsAreNotEqual, "Can't call calculateCrossEntropyGradients() on softmax layer")
+	}
+	for i := range rawOk {
+		rawDelta[i] = rawOk[i] - rawTk[i]
+	}
+	return nil
+}
+
+// UpdateWeights Just to point, that softmax layer does NOT updating weights
+func (softmax *SoftmaxLayer) UpdateWeights(lp *LearningParams) {
+	// There are no weights to update for softmax layer
+}
+
+// PrintOutput Pretty print softmax layer's output
+func (softmax *SoftmaxLayer) PrintOutput() {
+	fmt.Println("Printing softmax Layer output...")
+	rows, _ := softmax.Ok.Dims()
+	for r := 0; r < rows; r++ {
+		fmt.Printf("\t%v\n", softmax.Ok.RawRowView(r))
+	}
+}
+
+// PrintWeights Just to point, that softmax layer has not weights
+func (softmax *SoftmaxLayer) PrintWeights() {
+	fmt.Println("There are no weights for softmax layer")
+}
+
+// SetActivationFunc Set activation function for layer
+func (softmax *SoftmaxLayer) SetActivationFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set activation function for softmax layer")
+}
+
+// SetActivationDerivativeFunc Set derivative of activation function
+func (softmax *SoftmaxLayer) SetActivationDerivativeFunc(f func(v float64) float64) {
+	// Nothing here. Just for interface.
+	fmt.Println("You can not set derivative of activation function for softmax layer")
+}
+
+// GetStride Returns stride of layer
+func (softmax *SoftmaxLayer) GetStride() int {
+	return 0
+}
+
+// GetType Returns "softmax" as layer's type
+func (softmax *SoftmaxLayer) GetType() string {
+	return "softmax"
+}
+
+// SetTrainMode Switch softmax layer to training (true) or inference (false) mode
+func (softmax *SoftmaxLayer) SetTrainMode(mode bool) {
+	softmax.trainMode = mode
+}
+
+// replicate Returns new softmax layer with the same configuration (see TrainParallel())
+func (softmax *SoftmaxLayer) replicate() Layer {
+	return NewSoftmaxLayer(softmax.inputSize)
+}
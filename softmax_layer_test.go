@@ -0,0 +1,60 @@
+package cnns
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSoftmaxFeedForward(t *testing.T) {
+	softmax := NewSoftmaxLayer(&tensor.TDsize{X: 3, Y: 1, Z: 1})
+	// Large values should not overflow
+	err := softmax.FeedForward(mat.NewDense(3, 1, []float64{1000, 1001, 1002}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	correct := []float64{0.09003057317038046, 0.24472847105479764, 0.6652409557748219}
+	got := softmax.GetActivatedOutput().RawMatrix().Data
+	for i := range correct {
+		if math.Abs(correct[i]-got[i]) > 1e-12 {
+			t.Errorf("Element in position %d should be %f, but got %f", i, correct[i], got[i])
+		}
+	}
+}
+
+func TestSoftmaxCrossEntropyGradients(t *testing.T) {
+	input := mat.NewDense(4, 1, []float64{0.3, -1.2, 2.5, 0.1})
+	target := mat.NewDense(4, 1, []float64{0, 0, 1, 0})
+	softmax := NewSoftmaxLayer(&tensor.TDsize{X: 4, Y: 1, Z: 1})
+	err := softmax.FeedForward(input)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	loss := NewLossCategoricalCrossEntropy()
+
+	// Full Jacobian path
+	err = softmax.CalculateGradients(loss.Gradient(target, softmax.GetActivatedOutput()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	jacobian := mat.DenseCopyOf(softmax.GetGradients())
+
+	// Fused path
+	err = softmax.(*SoftmaxLayer).calculateCrossEntropyGradients(target)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fused := softmax.GetGradients()
+
+	for i := 0; i < 4; i++ {
+		if math.Abs(jacobian.At(i, 0)-fused.At(i, 0)) > 1e-9 {
+			t.Errorf("Gradient in position %d should be %f, but got %f", i, fused.At(i, 0), jacobian.At(i, 0))
+		}
+	}
+}
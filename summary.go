@@ -0,0 +1,144 @@
+package cnns
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/LdDl/cnns/tensor"
+)
+
+// float64Size Size of single value in bytes
+const float64Size = 8
+
+// LayerSummary Description of single layer of neural net
+/*
+	Index - position of layer in net
+	Type - type of layer (see Layer.GetType())
+	InputSize - dimensions of incoming data
+	OutputSize - dimensions of output data
+	Params - number of trainable parameters (weights, biases, γ and β of batch normalization, PReLU slopes)
+	MACs - estimated number of multiply-accumulate operations for single sample (only convolutional, fully connected and batch normalization layers are taken into account)
+	ActivationMemory - memory for output of layer in bytes (for single sample)
+*/
+type LayerSummary struct {
+	Index            int
+	Type             string
+	InputSize        tensor.TDsize
+	OutputSize       tensor.TDsize
+	Params           int
+	MACs             int
+	ActivationMemory int
+}
+
+// NetSummary Description of neural net: layers and totals
+type NetSummary struct {
+	Layers                []LayerSummary
+	TotalParams           int
+	TotalMACs             int
+	TotalActivationMemory int
+}
+
+// Summary Returns description of neural net (shapes, number of parameters, estimated MACs and memory for activations)
+func (wh *WholeNet) Summary() *NetSummary {
+	summary := &NetSummary{
+		Layers: make([]LayerSummary, len(wh.Layers)),
+	}
+	for i, layer := range wh.Layers {
+		layerSummary := LayerSummary{
+			Index:      i,
+			Type:       layer.GetType(),
+			InputSize:  *layer.GetInputSize(),
+			OutputSize: *layer.GetOutputSize(),
+		}
+		layerSummary.Params, layerSummary.MACs = layerComplexity(layer)
+		layerSummary.ActivationMemory = layerSummary.OutputSize.Total() * float64Size
+		summary.Layers[i] = layerSummary
+		summary.TotalParams += layerSummary.Params
+		summary.TotalMACs += layerSummary.MACs
+		summary.TotalActivationMemory += layerSummary.ActivationMemory
+	}
+	return summary
+}
+
+// layerComplexity Returns number of trainable parameters and estimated number of multiply-accumulate operations for layer
+func layerComplexity(layer Layer) (int, int) {
+	params, macs := 0, 0
+	switch l := layer.(type) {
+	case *ConvLayer:
+		for _, kernel := range l.Kernels {
+			r, c := kernel.Dims()
+			params += r * c
+		}
+		if l.Biases != nil {
+			params += len(l.Kernels)
+		}
+		// Every output value is a dot product of kernel and window of every input channel
+		macs = l.OutputSize.Total() * l.KernelSize * l.KernelSize * l.inputSize.Z
+		break
+	case *FullyConnectedLayer:
+		r, c := l.Weights.Dims()
+		params = r * c
+		if l.Biases != nil {
+			params += r
+		}
+		macs = r * c
+		break
+	case *BatchNormLayer:
+		r, c := l.Gamma.Dims()
+		params = 2 * r * c
+		// Scale and shift of every normalized value
+		macs = l.inputSize.Total()
+		break
+	case *PReLULayer:
+		r, c := l.Slopes.Dims()
+		params = r * c
+		break
+	default:
+		break
+	}
+	return params, macs
+}
+
+// String Renders summary as text table
+func (summary *NetSummary) String() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tType\tInput\tOutput\tParams\tMACs\tMemory")
+	for _, layer := range summary.Layers {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			layer.Index,
+			layer.Type,
+			tdSizeString(layer.InputSize),
+			tdSizeString(layer.OutputSize),
+			layer.Params,
+			layer.MACs,
+			memoryString(layer.ActivationMemory),
+		)
+	}
+	fmt.Fprintf(w, "Total\t\t\t\t%d\t%d\t%s\n", summary.TotalParams, summary.TotalMACs, memoryString(summary.TotalActivationMemory))
+	w.Flush()
+	return buf.String()
+}
+
+// PrintSummary Pretty print summary of neural net
+func (wh *WholeNet) PrintSummary() {
+	fmt.Print(wh.Summary().String())
+}
+
+// tdSizeString Returns dimensions in "XxYxZ" form
+func tdSizeString(size tensor.TDsize) string {
+	return fmt.Sprintf("%dx%dx%d", size.X, size.Y, size.Z)
+}
+
+// memoryString Returns human readable amount of memory
+func memoryString(bytesNum int) string {
+	switch {
+	case bytesNum >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(bytesNum)/(1<<20))
+	case bytesNum >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(bytesNum)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", bytesNum)
+	}
+}
@@ -0,0 +1,58 @@
+package cnns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LdDl/cnns/tensor"
+)
+
+func TestSummary(t *testing.T) {
+	net, err := NewSequential(&tensor.TDsize{X: 10, Y: 10, Z: 2}).
+		Conv(3, 8, 1, WithBias()).
+		BatchNorm("channel").
+		ReLU().
+		MaxPool(2, 2).
+		Dense(10, WithBias()).
+		Softmax().
+		Build()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	summary := net.Summary()
+	correct := []LayerSummary{
+		{Index: 0, Type: "conv", InputSize: tensor.TDsize{X: 10, Y: 10, Z: 2}, OutputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, Params: 3*3*2*8 + 8, MACs: 8 * 8 * 8 * 3 * 3 * 2, ActivationMemory: 512 * 8},
+		{Index: 1, Type: "batchnorm", InputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, OutputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, Params: 16, MACs: 512, ActivationMemory: 512 * 8},
+		{Index: 2, Type: "relu", InputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, OutputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, Params: 0, MACs: 0, ActivationMemory: 512 * 8},
+		{Index: 3, Type: "pool", InputSize: tensor.TDsize{X: 8, Y: 8, Z: 8}, OutputSize: tensor.TDsize{X: 4, Y: 4, Z: 8}, Params: 0, MACs: 0, ActivationMemory: 128 * 8},
+		{Index: 4, Type: "fc", InputSize: tensor.TDsize{X: 4, Y: 4, Z: 8}, OutputSize: tensor.TDsize{X: 10, Y: 1, Z: 1}, Params: 128*10 + 10, MACs: 128 * 10, ActivationMemory: 10 * 8},
+		{Index: 5, Type: "softmax", InputSize: tensor.TDsize{X: 10, Y: 1, Z: 1}, OutputSize: tensor.TDsize{X: 10, Y: 1, Z: 1}, Params: 0, MACs: 0, ActivationMemory: 10 * 8},
+	}
+	if len(summary.Layers) != len(correct) {
+		t.Errorf("Number of layers in summary should be %d, but got %d", len(correct), len(summary.Layers))
+		return
+	}
+	totalParams, totalMACs, totalMemory := 0, 0, 0
+	for i := range correct {
+		if summary.Layers[i] != correct[i] {
+			t.Errorf("Summary of layer #%d should be %+v, but got %+v", i, correct[i], summary.Layers[i])
+		}
+		totalParams += correct[i].Params
+		totalMACs += correct[i].MACs
+		totalMemory += correct[i].ActivationMemory
+	}
+	if summary.TotalParams != totalParams || summary.TotalMACs != totalMACs || summary.TotalActivationMemory != totalMemory {
+		t.Errorf("Totals should be %d, %d, %d, but got %d, %d, %d", totalParams, totalMACs, totalMemory, summary.TotalParams, summary.TotalMACs, summary.TotalActivationMemory)
+	}
+	text := summary.String()
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) != len(correct)+2 {
+		t.Errorf("Text summary should have %d lines, but got %d:\n%s", len(correct)+2, len(lines), text)
+	}
+	for _, part := range []string{"10x10x2", "4x4x8", "1290", "Total"} {
+		if !strings.Contains(text, part) {
+			t.Errorf("Text summary should contain '%s':\n%s", part, text)
+		}
+	}
+}
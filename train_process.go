@@ -3,12 +3,37 @@ package cnns
 import (
 	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"time"
 
+	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/mat"
 )
 
+// TrainOptions Parameters of training (see Fit())
+/*
+	Epochs - number of epochs
+	Workers - number of worker goroutines for data-parallel training (see TrainParallel()). Training is single-threaded if it is <= 1
+	ValidationData - input data for validation after every epoch (optional)
+	ValidationDesired - target outputs for validation data
+	Callbacks - hooks which are called after every mini-batch and epoch (e.g. EarlyStopping)
+	CheckpointFile - file for periodic checkpoints (see Checkpoint). Empty string means no periodic checkpoints
+	CheckpointEvery - period of checkpoints in epochs (every epoch if it is <= 0)
+	CheckpointBestFile - file for checkpoint of epoch with the best validation loss. Empty string means no such checkpoints
+	Resume - checkpoint to continue training from (network should be restored from it by RestoreCheckpoint() before). Epochs is total number of epochs including finished ones
+*/
+type TrainOptions struct {
+	Epochs             int
+	Workers            int
+	ValidationData     []*mat.Dense
+	ValidationDesired  []*mat.Dense
+	Callbacks          []Callback
+	CheckpointFile     string
+	CheckpointEvery    int
+	CheckpointBestFile string
+	Resume             *Checkpoint
+}
+
 // Train Train neural network
 /*
 	inputs - input data for training
@@ -18,56 +43,43 @@ import (
 	testDesired - target outputs for testing
 
 	epochsNum - number of epochs
+
+	Training data is shuffled with net's source of randomness (see SetSeed()), provided slices are not modified
+	Weights are updated once per mini-batch (see LearningParams.BatchSize)
+	Net is switched to training mode for training and back to inference mode for evaluating errors
+	Returns summed values of net's loss function for training and testing data
+	Use Fit() for per-epoch history, validation and callbacks (e.g. early stopping)
 */
 func (n *WholeNet) Train(inputs []*mat.Dense, desired []*mat.Dense, testData []*mat.Dense, testDesired []*mat.Dense, epochsNum int) (float64, float64, error) {
+	return n.TrainParallel(inputs, desired, testData, testDesired, epochsNum, 1)
+}
+
+// TrainParallel Train neural network with data-parallel mini-batches (see Train())
+/*
+	workersNum - number of worker goroutines. Every worker owns replica of net's layers and processes its own share of mini-batch (see CalculateBatchGradients()),
+		then gradients are summed up and weights of net are updated once per mini-batch.
+		Result matches single-threaded training up to floating point rounding (gradients are summed in different order)
+		If workersNum <= 1 then training is single-threaded
+*/
+func (n *WholeNet) TrainParallel(inputs []*mat.Dense, desired []*mat.Dense, testData []*mat.Dense, testDesired []*mat.Dense, epochsNum int, workersNum int) (float64, float64, error) {
 	var err error
 	trainError := 0.0
 	testError := 0.0
 
-	if len(inputs) != len(desired) {
-		return trainError, testError, fmt.Errorf("number of inputs not equal to number of desired")
-	}
-
 	if len(testData) != len(testDesired) {
 		return trainError, testError, fmt.Errorf("number of inputs for test not equal to number of desired for test")
 	}
 
-	// Initial shuffling of input data
-	for i := range inputs {
-		j := rand.Intn(i + 1)
-		inputs[i], inputs[j] = inputs[j], inputs[i]
-		desired[i], desired[j] = desired[j], desired[i]
-	}
-
-	start := time.Now()
-	for e := 0; e < epochsNum; e++ {
-		// Shuffle training data every epoch
-		for i := range inputs {
-			j := rand.Intn(i + 1)
-			inputs[i], inputs[j] = inputs[j], inputs[i]
-			desired[i], desired[j] = desired[j], desired[i]
-		}
-
-		st := time.Now()
-		for i := range inputs {
-			in := inputs[i]
-			err := n.FeedForward(in)
-			if err != nil {
-				log.Printf("Feedforward caused error: %s", err.Error())
-				return 0.0, 0.0, err
-			}
-			target := desired[i]
-			err = n.Backpropagate(target)
-			if err != nil {
-				log.Printf("Backpropagate caused error: %s", err.Error())
-				return 0.0, 0.0, err
-			}
-		}
-		log.Printf("Epoch #%v done in %v", e, time.Since(st))
+	_, err = n.Fit(inputs, desired, &TrainOptions{
+		Epochs:  epochsNum,
+		Workers: workersNum,
+	})
+	if err != nil {
+		return 0.0, 0.0, err
 	}
-	log.Printf("Training %v epochs done in %v", epochsNum, time.Since(start))
 
 	fmt.Println("Evaluating errors...")
+	lossFunc := n.getLoss()
 
 	for i := range inputs {
 		in := inputs[i]
@@ -78,7 +90,7 @@ func (n *WholeNet) Train(inputs []*mat.Dense, desired []*mat.Dense, testData []*
 			return 0.0, 0.0, err
 		}
 		out := n.GetOutput()
-		loss := mse(target, out)
+		loss := lossFunc.Value(target, out)
 		trainError += loss
 	}
 
@@ -87,17 +99,255 @@ func (n *WholeNet) Train(inputs []*mat.Dense, desired []*mat.Dense, testData []*
 		target := testDesired[i]
 		n.FeedForward(in)
 		out := n.GetOutput()
-		loss := mse(target, out)
+		loss := lossFunc.Value(target, out)
 		testError += loss
 	}
 
 	return trainError, testError, err
 }
 
-func mse(t1, t2 *mat.Dense) float64 {
-	tmp := &mat.Dense{}
-	tmp.Sub(t1, t2)
-	tmpPow := &mat.Dense{}
-	tmpPow.MulElem(tmp, tmp)
-	return mat.Sum(tmpPow)
+// Fit Train neural network and collect per-epoch history
+/*
+	inputs - input data for training
+	desired - target outputs for input
+	options - parameters of training (number of epochs, workers, validation data, callbacks)
+
+	Training data is shuffled with net's source of randomness (see SetSeed()), provided slices are not modified
+	Weights are updated once per mini-batch (see LearningParams.BatchSize and CalculateBatchGradients()). Error is returned if some layer
+	can't be trained with mini-batches of such size (e.g. batch normalization layer after fully-connected one needs at least 2 samples)
+	Net is switched to training mode for training and to inference mode for validation (and it is left in inference mode)
+	If callback returns ErrStopTraining (or error caused by it, see errors.Cause()) then training is stopped and history is returned without error
+	States of callbacks (e.g. EarlyStopping) are reset when training starts, and EarlyStopping restores parameters of the best epoch when training is finished
+	Checkpoints are saved after callbacks of epoch (periodic checkpoint is saved also when training is stopped by callback) with states of callbacks (see Checkpoint.Callbacks).
+	Resumed training is bit-identical to uninterrupted one
+	if net's source of randomness has been set by SetSeed() or Sequential.Seed() (random layers are seeded from it for every sample of mini-batch, see CalculateBatchGradients())
+*/
+func (n *WholeNet) Fit(inputs []*mat.Dense, desired []*mat.Dense, options *TrainOptions) (*History, error) {
+	history := &History{
+		Epochs: []EpochInfo{},
+	}
+	if options == nil {
+		options = &TrainOptions{}
+	}
+
+	if len(inputs) != len(desired) {
+		return history, fmt.Errorf("number of inputs not equal to number of desired")
+	}
+
+	if len(options.ValidationData) != len(options.ValidationDesired) {
+		return history, fmt.Errorf("number of inputs for validation not equal to number of desired for validation")
+	}
+
+	// States of callbacks are reset before they are restored from checkpoint
+	for _, callback := range options.Callbacks {
+		if c, ok := callback.(trainingCallback); ok {
+			c.onTrainBegin()
+		}
+	}
+
+	// Training data is shuffled via permutation of indices, so provided slices stay untouched
+	order := make([]int, len(inputs))
+	startEpoch := 0
+	bestValidationLoss := math.Inf(1)
+	if options.Resume != nil {
+		if len(options.Resume.Order) != len(inputs) {
+			return history, fmt.Errorf("number of inputs (%d) not equal to number of inputs in checkpoint (%d)", len(inputs), len(options.Resume.Order))
+		}
+		copy(order, options.Resume.Order)
+		startEpoch = options.Resume.Epoch
+		if options.Resume.History != nil {
+			history.Epochs = append(history.Epochs, options.Resume.History.Epochs...)
+		}
+		for _, info := range history.Epochs {
+			if info.HasValidation && info.ValidationLoss < bestValidationLoss {
+				bestValidationLoss = info.ValidationLoss
+			}
+		}
+		err := options.Resume.restoreCallbacks(options.Callbacks)
+		if err != nil {
+			return history, err
+		}
+	} else {
+		for i := range order {
+			order[i] = i
+		}
+		// Initial shuffling of input data
+		n.shuffle(order)
+	}
+
+	batchSize := n.LP.getBatchSize()
+	err := n.checkBatchSize(batchSize, len(inputs))
+	if err != nil {
+		return history, err
+	}
+	n.SetTrainMode(true)
+	// Make sure that net is left in inference mode even if training fails
+	defer n.SetTrainMode(false)
+	start := time.Now()
+	for e := startEpoch; e < options.Epochs; e++ {
+		// Shuffle training data every epoch
+		n.shuffle(order)
+
+		st := time.Now()
+		epochLoss := 0.0
+		batchNum := 0
+		for batchStart := 0; batchStart < len(inputs); batchStart += batchSize {
+			batchEnd := batchStart + batchSize
+			if batchEnd > len(inputs) {
+				batchEnd = len(inputs)
+			}
+			batch := make([]*mat.Dense, 0, batchEnd-batchStart)
+			batchDesired := make([]*mat.Dense, 0, batchEnd-batchStart)
+			for i := batchStart; i < batchEnd; i++ {
+				batch = append(batch, inputs[order[i]])
+				batchDesired = append(batchDesired, desired[order[i]])
+			}
+			batchLoss, err := n.calculateBatchGradients(batch, batchDesired, options.Workers)
+			if err != nil {
+				log.Printf("Evaluation of gradients caused error: %s", err.Error())
+				return history, err
+			}
+			// Apply gradients averaged over mini-batch
+			n.UpdateWeights()
+			epochLoss += batchLoss
+
+			for _, callback := range options.Callbacks {
+				err := callback.OnBatchEnd(n, BatchInfo{Epoch: e, Batch: batchNum, Size: len(batch), Loss: batchLoss / float64(len(batch))})
+				if errors.Cause(err) == ErrStopTraining {
+					history.Stopped = true
+					return history, n.endTraining(options.Callbacks)
+				}
+				if err != nil {
+					return history, errors.Wrap(err, "Callback OnBatchEnd() caused error")
+				}
+			}
+			batchNum++
+		}
+
+		info := EpochInfo{
+			Epoch: e,
+		}
+		if len(inputs) > 0 {
+			info.TrainLoss = epochLoss / float64(len(inputs))
+		}
+		if len(options.ValidationData) > 0 {
+			n.SetTrainMode(false)
+			info.HasValidation = true
+			var err error
+			info.ValidationLoss, info.ValidationAccuracy, err = n.evaluate(options.ValidationData, options.ValidationDesired)
+			if err != nil {
+				log.Printf("Validation caused error: %s", err.Error())
+				return history, err
+			}
+			n.SetTrainMode(true)
+		}
+		info.Duration = time.Since(st)
+		history.Epochs = append(history.Epochs, info)
+		log.Printf("Epoch #%v done in %v", e, info.Duration)
+
+		stopped := false
+		for _, callback := range options.Callbacks {
+			err := callback.OnEpochEnd(n, info)
+			if errors.Cause(err) == ErrStopTraining {
+				stopped = true
+				history.Stopped = true
+				break
+			}
+			if err != nil {
+				return history, errors.Wrap(err, "Callback OnEpochEnd() caused error")
+			}
+		}
+
+		// Checkpoints are saved after callbacks, so states of callbacks include finished epoch
+		checkpointEvery := options.CheckpointEvery
+		if checkpointEvery <= 0 {
+			checkpointEvery = 1
+		}
+		if options.CheckpointFile != "" && ((e+1)%checkpointEvery == 0 || stopped) {
+			err := n.saveCheckpoint(options.CheckpointFile, e+1, order, history, options.Callbacks)
+			if err != nil {
+				return history, err
+			}
+		}
+		if options.CheckpointBestFile != "" && info.HasValidation && info.ValidationLoss < bestValidationLoss {
+			bestValidationLoss = info.ValidationLoss
+			err := n.saveCheckpoint(options.CheckpointBestFile, e+1, order, history, options.Callbacks)
+			if err != nil {
+				return history, err
+			}
+		}
+
+		if stopped {
+			log.Printf("Training has been stopped after %v epochs in %v", e+1, time.Since(start))
+			return history, n.endTraining(options.Callbacks)
+		}
+	}
+	log.Printf("Training %v epochs done in %v", options.Epochs, time.Since(start))
+	return history, n.endTraining(options.Callbacks)
+}
+
+// endTraining Notify callbacks that training has been finished (see trainingCallback)
+func (n *WholeNet) endTraining(callbacks []Callback) error {
+	for _, callback := range callbacks {
+		c, ok := callback.(trainingCallback)
+		if !ok {
+			continue
+		}
+		err := c.onTrainEnd(n)
+		if err != nil {
+			return errors.Wrap(err, "Callback can't finish training")
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint Capture full state of training and save it to file (see Checkpoint)
+func (n *WholeNet) saveCheckpoint(fname string, epoch int, order []int, history *History, callbacks []Callback) error {
+	checkpoint, err := n.newCheckpoint(epoch, order, history, callbacks)
+	if err != nil {
+		return err
+	}
+	return checkpoint.SaveToFile(fname)
+}
+
+// evaluate Returns mean value of loss function and accuracy (share of samples where index of max output is equal to index of max target) for provided data
+func (n *WholeNet) evaluate(inputs []*mat.Dense, desired []*mat.Dense) (float64, float64, error) {
+	if len(inputs) == 0 {
+		return 0.0, 0.0, nil
+	}
+	lossFunc := n.getLoss()
+	loss := 0.0
+	correct := 0
+	for i := range inputs {
+		err := n.FeedForward(inputs[i])
+		if err != nil {
+			return 0.0, 0.0, err
+		}
+		out := n.GetOutput()
+		loss += lossFunc.Value(desired[i], out)
+		if argMax(out) == argMax(desired[i]) {
+			correct++
+		}
+	}
+	return loss / float64(len(inputs)), float64(correct) / float64(len(inputs)), nil
+}
+
+// argMax Returns index of max element in raw data of matrix
+func argMax(matrix *mat.Dense) int {
+	raw := matrix.RawMatrix().Data
+	idx := 0
+	for i := range raw {
+		if raw[i] > raw[idx] {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// shuffle Shuffle indices in-place with net's source of randomness
+func (n *WholeNet) shuffle(order []int) {
+	for i := range order {
+		j := n.intn(i + 1)
+		order[i], order[j] = order[j], order[i]
+	}
 }